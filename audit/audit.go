@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	bufferSize       = 1024            // Number of events that can be queued before Record blocks
+	maxWriteAttempts = 10              // Attempts to store an event before it is dropped
+	maxRetryDelay    = 5 * time.Second // Longest wait between attempts
+)
+
+var (
+	events          chan models.AuditEvent
+	store           *MongoSink // Holds the chain
+	sinks           []Sink     // Other destinations, such as a file
+	done            chan struct{}
+	lastHash        string
+	sequence        int64
+	personalDataKey []byte
+	mu              sync.Mutex
+)
+
+// Start loads the tip of the hash chain and starts the background writer.
+// Events are written to MongoDB and, when cfg.FilePath is set, appended to that file.
+func Start(cfg config.AuditConfig) error {
+	store = NewMongoSink()
+	personalDataKey = []byte(cfg.PersonalDataKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+
+	// Continue the chain from the last stored event
+	if err := loadHead(ctx); err != nil {
+		return err
+	}
+
+	sinks = nil
+	if cfg.FilePath != "" {
+		fileSink, err := NewFileSink(cfg.FilePath)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, fileSink)
+	}
+
+	events = make(chan models.AuditEvent, bufferSize)
+	done = make(chan struct{})
+	go run()
+
+	return nil
+}
+
+// Record queues an event to be chained and written by the background writer.
+// Personal data in its changes and metadata is replaced by keyed hashes first.
+func Record(event models.AuditEvent) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if events == nil {
+		slog.Warn("Audit log not started, dropping event", "action", event.Action)
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+	protectPersonalData(&event)
+	events <- event
+}
+
+// Close flushes the queued events and stops the background writer
+func Close(ctx context.Context) error {
+	mu.Lock()
+	if events == nil {
+		mu.Unlock()
+		return nil
+	}
+	close(events)
+	events = nil
+	mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := store.Close(); err != nil {
+		return err
+	}
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run links each queued event to the chain and writes it to every sink
+func run() {
+	defer close(done)
+
+	for event := range events {
+		if !appendToChain(&event) {
+			continue
+		}
+		for _, sink := range sinks {
+			writeWithRetry(sink, event)
+		}
+	}
+}
+
+// appendToChain links an event to the head of the chain and stores it. The head only advances once the
+// event is stored. Instances sharing the log take turns through the unique sequence index: when another
+// one stored the next event first, the head is reloaded and the event linked to it. An event that still
+// cannot be stored after several attempts is dropped, leaving the chain unbroken.
+func appendToChain(event *models.AuditEvent) bool {
+	event.ID = primitive.NewObjectID()
+	event.Timestamp = event.Timestamp.UTC().Truncate(time.Millisecond)
+
+	var err error
+	delay := 100 * time.Millisecond
+	for attempt := 1; attempt <= maxWriteAttempts; {
+		event.Sequence = sequence + 1
+		event.PrevHash = lastHash
+		event.Hash = Hash(*event)
+
+		if err = store.Write(*event); err == nil {
+			sequence, lastHash = event.Sequence, event.Hash
+			return true
+		}
+
+		if mongo.IsDuplicateKeyError(err) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			var stored bool
+			if err = loadHead(ctx); err == nil {
+				// An earlier attempt may have been stored without being acknowledged
+				stored, err = store.Has(ctx, event.ID)
+			}
+			cancel()
+			if stored {
+				return true
+			}
+			if err == nil {
+				continue
+			}
+		}
+
+		attempt++
+		time.Sleep(delay)
+		delay = min(delay*2, maxRetryDelay)
+	}
+	slog.Error("Failed to write audit event, dropping it", "action", event.Action, "error", err)
+	return false
+}
+
+// loadHead sets the head of the chain to the last stored event
+func loadHead(ctx context.Context) error {
+	last, err := store.Last(ctx)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		lastHash = last.Hash
+		sequence = last.Sequence
+	} else {
+		lastHash = ""
+		sequence = 0
+	}
+	return nil
+}
+
+// writeWithRetry writes an event to a sink, retrying briefly on failure
+func writeWithRetry(sink Sink, event models.AuditEvent) {
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err = sink.Write(event); err == nil {
+			return
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	slog.Error("Failed to write audit event", "sequence", event.Sequence, "error", err)
+}
+
+// Hash computes the chain hash of an event from its content and the previous event's hash
+func Hash(event models.AuditEvent) string {
+	// Fields are listed explicitly so the hash does not depend on storage encoding
+	fields := []interface{}{
+		event.Sequence,
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		event.Action,
+		event.Outcome,
+		event.ActorID,
+		event.ActorRole,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		event.Changes,
+		event.Metadata,
+		event.PrevHash,
+	}
+	// Added after the chain began, so events without it hash as they always did
+	if event.ImpersonatorID != "" {
+		fields = append(fields, event.ImpersonatorID)
+	}
+	canonical, _ := json.Marshal(fields)
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"myfibergotemplate/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// redactedFields are recorded as changed without revealing their values
+var redactedFields = map[string]bool{
+	"password":           true,
+	"verification_token": true,
+	"invitation_token":   true,
+}
+
+// personalFields hold personal data, which is recorded as a keyed hash so that events about the same
+// value can be matched without the log revealing it
+var personalFields = map[string]bool{
+	"email":            true,
+	"phone_number":     true,
+	"address":          true,
+	"person_in_charge": true,
+}
+
+// Pseudonymize returns the keyed hash recorded in place of a personal data value
+func Pseudonymize(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, personalDataKey)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// protectPersonalData replaces the personal data in an event's changes and metadata by keyed hashes
+func protectPersonalData(event *models.AuditEvent) {
+	if len(event.Changes) > 0 {
+		changes := make(map[string]models.AuditChange, len(event.Changes))
+		for field, change := range event.Changes {
+			if personalFields[field] {
+				change = models.AuditChange{Before: Pseudonymize(change.Before), After: Pseudonymize(change.After)}
+			}
+			changes[field] = change
+		}
+		event.Changes = changes
+	}
+	if len(event.Metadata) > 0 {
+		metadata := make(map[string]string, len(event.Metadata))
+		for key, value := range event.Metadata {
+			if personalFields[key] {
+				value = Pseudonymize(value)
+			}
+			metadata[key] = value
+		}
+		event.Metadata = metadata
+	}
+}
+
+// NewEvent creates an event for the given action, filled in with the request's actor and client details
+func NewEvent(c *fiber.Ctx, action string) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:    action,
+		Outcome:   models.AuditSuccess,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+
+	// Prefer the ID assigned by the request ID middleware
+	if requestID, ok := c.Locals("requestID").(string); ok {
+		event.RequestID = requestID
+	} else {
+		event.RequestID = c.Get(fiber.HeaderXRequestID)
+	}
+
+	if actorID, ok := c.Locals("userID").(string); ok {
+		event.ActorID = actorID
+	}
+	if actorRole, ok := c.Locals("userRole").(string); ok {
+		event.ActorRole = actorRole
+	}
+	if impersonatorID, ok := c.Locals("impersonatorID").(string); ok {
+		event.ImpersonatorID = impersonatorID
+	}
+
+	return event
+}
+
+// Diff returns the fields whose values differ between before and after
+func Diff(before, after map[string]interface{}) map[string]models.AuditChange {
+	changes := make(map[string]models.AuditChange)
+
+	for field, newValue := range after {
+		oldValue := render(before[field])
+		if _, existed := before[field]; !existed {
+			oldValue = ""
+		}
+
+		if render(newValue) == oldValue {
+			continue
+		}
+		if redactedFields[field] {
+			changes[field] = models.AuditChange{Before: "[redacted]", After: "[redacted]"}
+			continue
+		}
+		changes[field] = models.AuditChange{Before: oldValue, After: render(newValue)}
+	}
+
+	return changes
+}
+
+// render formats a value for storage in an audit change
+func render(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
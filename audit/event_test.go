@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"myfibergotemplate/models"
+)
+
+func TestProtectPersonalData(t *testing.T) {
+	personalDataKey = []byte("test key")
+
+	event := models.AuditEvent{
+		Changes: Diff(
+			map[string]interface{}{"email": "old@example.com", "role": "merchant"},
+			map[string]interface{}{"email": "new@example.com", "role": "administrator"},
+		),
+		Metadata: map[string]string{"email": "jane@example.com", "method": "password"},
+	}
+	protectPersonalData(&event)
+
+	email := event.Changes["email"]
+	if email.Before != Pseudonymize("old@example.com") || email.After != Pseudonymize("new@example.com") {
+		t.Errorf("email change recorded as %+v, want keyed hashes", email)
+	}
+	if strings.Contains(email.Before+email.After, "example.com") {
+		t.Error("email change reveals the addresses")
+	}
+	if role := event.Changes["role"]; role.Before != "merchant" || role.After != "administrator" {
+		t.Errorf("role change recorded as %+v, want the values", role)
+	}
+	if event.Metadata["email"] != Pseudonymize("jane@example.com") || event.Metadata["method"] != "password" {
+		t.Errorf("metadata recorded as %v", event.Metadata)
+	}
+}
+
+func TestPseudonymize(t *testing.T) {
+	personalDataKey = []byte("test key")
+	hash := Pseudonymize("jane@example.com")
+
+	if hash != Pseudonymize("jane@example.com") {
+		t.Error("the same value hashed differently")
+	}
+	if hash == Pseudonymize("john@example.com") {
+		t.Error("different values hashed the same")
+	}
+	if Pseudonymize("") != "" {
+		t.Error("an empty value was hashed")
+	}
+
+	// Without the key the hash cannot be recomputed from a guessed value
+	personalDataKey = []byte("other key")
+	if hash == Pseudonymize("jane@example.com") {
+		t.Error("the hash does not depend on the key")
+	}
+}
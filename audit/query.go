@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"context"
+
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventsForUser returns every event in which the user was the actor or the target, oldest first
+func EventsForUser(ctx context.Context, userID string) ([]models.AuditEvent, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"actor_id": userID}, bson.M{"target_id": userID}}}
+
+	cursor, err := Collection().Find(ctx, filter, options.Find().SetSort(bson.M{"sequence": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
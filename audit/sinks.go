@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sink is a destination audit events are written to
+type Sink interface {
+	Write(event models.AuditEvent) error
+	Close() error
+}
+
+// MongoSink stores audit events in the "audit_events" collection
+type MongoSink struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSink creates a sink backed by the "audit_events" collection
+func NewMongoSink() *MongoSink {
+	return &MongoSink{collection: Collection()}
+}
+
+// Collection returns the collection that holds the audit events
+func Collection() *mongo.Collection {
+	return database.GetMongoClient().Database("talentdevgo").Collection("audit_events")
+}
+
+// EnsureIndexes creates the indexes used by the chain and by queries.
+// The unique sequence index prevents two writers from forking the chain.
+func (s *MongoSink) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sequence", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	return err
+}
+
+// Last returns the most recent event, or nil if the log is empty
+func (s *MongoSink) Last(ctx context.Context) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	err := s.collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"sequence": -1})).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Has reports whether the event with the given ID is stored
+func (s *MongoSink) Has(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (s *MongoSink) Write(event models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (s *MongoSink) Close() error {
+	return nil
+}
+
+// FileSink appends audit events to a file as newline-delimited JSON
+type FileSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileSink opens the file at path for appending, creating it if needed
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(event models.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
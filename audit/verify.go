@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VerificationResult describes the state of the audit hash chain
+type VerificationResult struct {
+	Valid          bool   `json:"valid"`
+	EventsChecked  int64  `json:"events_checked"`
+	BrokenSequence int64  `json:"broken_sequence,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// VerifyChain walks the stored events in order and checks every hash and link
+func VerifyChain(ctx context.Context) (VerificationResult, error) {
+	result := VerificationResult{Valid: true}
+
+	cursor, err := Collection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"sequence": 1}))
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+
+	prevHash := ""
+	expected := int64(0)
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return result, err
+		}
+		expected++
+		result.EventsChecked++
+
+		switch {
+		case event.Sequence != expected:
+			result.Reason = "missing or reordered event"
+		case event.PrevHash != prevHash:
+			result.Reason = "previous hash does not match"
+		case Hash(event) != event.Hash:
+			result.Reason = "event content does not match its hash"
+		}
+		if result.Reason != "" {
+			result.Valid = false
+			result.BrokenSequence = expected
+			return result, nil
+		}
+
+		prevHash = event.Hash
+	}
+
+	return result, cursor.Err()
+}
@@ -1,21 +1,568 @@
 package config
 
 import (
-	"log" // log: package for logging
-	"os"  // os: package for operating system functionality
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environments the application can run in
+const (
+	Development = "development"
+	Production  = "production"
+)
+
+// Insecure defaults that are only acceptable outside of production
+const (
+	defaultJWTSecret     = "your_jwt_secret_key"
+	defaultAdminEmail    = "admin@example.com"
+	defaultAdminPassword = "securepassword"
+)
+
+// Config holds all application settings
+type Config struct {
+	Environment string           `yaml:"environment" toml:"environment"`
+	Server      ServerConfig     `yaml:"server" toml:"server"`
+	CORS        CORSConfig       `yaml:"cors" toml:"cors"`
+	Security    SecurityConfig   `yaml:"security" toml:"security"`
+	Mongo       MongoConfig      `yaml:"mongo" toml:"mongo"`
+	Auth        AuthConfig       `yaml:"auth" toml:"auth"`
+	OAuth       OAuthConfig      `yaml:"oauth" toml:"oauth"`
+	OIDC        OIDCConfig       `yaml:"oidc" toml:"oidc"`
+	Federation  FederationConfig `yaml:"federation" toml:"federation"`
+	SAML        SAMLConfig       `yaml:"saml" toml:"saml"`
+	MagicLink   MagicLinkConfig  `yaml:"magic_link" toml:"magic_link"`
+	WebAuthn    WebAuthnConfig   `yaml:"webauthn" toml:"webauthn"`
+	SMS         SMSConfig        `yaml:"sms" toml:"sms"`
+	Sessions    SessionsConfig   `yaml:"sessions" toml:"sessions"`
+	Admin       AdminConfig      `yaml:"admin" toml:"admin"`
+	Email       EmailConfig      `yaml:"email" toml:"email"`
+	Logging     LoggingConfig    `yaml:"logging" toml:"logging"`
+	Metrics     MetricsConfig    `yaml:"metrics" toml:"metrics"`
+	Tracing     TracingConfig    `yaml:"tracing" toml:"tracing"`
+	Audit       AuditConfig      `yaml:"audit" toml:"audit"`
+	Retention   RetentionConfig  `yaml:"retention" toml:"retention"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port            string        `yaml:"port" toml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	BackendURL      string        `yaml:"backend_url" toml:"backend_url"`
+	FrontendURL     string        `yaml:"frontend_url" toml:"frontend_url"`
+	TrustedProxies  []string      `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	ProxyHeader     string        `yaml:"proxy_header" toml:"proxy_header"`
+}
+
+// CORSConfig holds the cross-origin request settings.
+// Origins may use a wildcard subdomain, e.g. https://*.example.com, or be "*" to allow any origin.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age" toml:"max_age"`
+}
+
+// SecurityConfig holds the values of the security response headers; an empty value omits the header
+type SecurityConfig struct {
+	HSTSMaxAge            int    `yaml:"hsts_max_age" toml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains"`
+	ContentSecurityPolicy string `yaml:"content_security_policy" toml:"content_security_policy"`
+	FrameOptions          string `yaml:"frame_options" toml:"frame_options"`
+	ReferrerPolicy        string `yaml:"referrer_policy" toml:"referrer_policy"`
+}
+
+// MongoConfig holds the database connection settings
+type MongoConfig struct {
+	URI string `yaml:"uri" toml:"uri"`
+}
+
+// AuthConfig holds the token signing settings. With cookie mode on, browser clients can ask for
+// their session in an HttpOnly cookie instead of a token in the response body.
+type AuthConfig struct {
+	JWTSecret        string        `yaml:"jwt_secret" toml:"jwt_secret"`
+	CookieMode       bool          `yaml:"cookie_mode" toml:"cookie_mode"`
+	CookieName       string        `yaml:"cookie_name" toml:"cookie_name"`
+	CookieDomain     string        `yaml:"cookie_domain" toml:"cookie_domain"`
+	CookieSameSite   string        `yaml:"cookie_same_site" toml:"cookie_same_site"`
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" toml:"impersonation_ttl"`
+}
+
+// OAuthConfig holds the lifetimes of what the OAuth 2.0 authorization server issues
+type OAuthConfig struct {
+	CodeTTL         time.Duration `yaml:"code_ttl" toml:"code_ttl"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+}
+
+// OIDCConfig holds the OpenID Connect provider settings.
+// The issuer defaults to the backend URL; without a signing key file an ephemeral key is generated in development.
+type OIDCConfig struct {
+	Issuer         string `yaml:"issuer" toml:"issuer"`
+	SigningKeyFile string `yaml:"signing_key_file" toml:"signing_key_file"`
+}
 
-	"github.com/joho/godotenv" // godotenv: package for reading .env files
+// Types of external identity providers
+const (
+	ProviderGoogle    = "google"
+	ProviderMicrosoft = "microsoft"
+	ProviderOIDC      = "oidc" // Any other OpenID Connect provider, configured by issuer
 )
 
-func LoadEnv() { // LoadEnv: function to load environment variables
-	if err := godotenv.Load(); err != nil { // godotenv.Load: function to load .env file
-		log.Fatalf("Error loading .env file") // log.Fatalf: function to log fatal error
+// FederationConfig holds the external OpenID Connect providers users can sign in with
+type FederationConfig struct {
+	Providers []IdentityProviderConfig `yaml:"providers" toml:"providers"`
+}
+
+// IdentityProviderConfig describes one external identity provider.
+// Google and Microsoft providers only need client credentials; other providers need an issuer.
+type IdentityProviderConfig struct {
+	Name         string   `yaml:"name" toml:"name"` // Used in URLs, e.g. /auth/federated/google/start
+	Type         string   `yaml:"type" toml:"type"`
+	DisplayName  string   `yaml:"display_name" toml:"display_name"`
+	Issuer       string   `yaml:"issuer" toml:"issuer"`
+	Tenant       string   `yaml:"tenant" toml:"tenant"` // Microsoft only: organizations, common or a tenant ID
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// SAMLConfig holds the key pair the SAML service provider signs requests with and publishes in its metadata.
+// Without them a temporary self-signed pair is generated in development.
+type SAMLConfig struct {
+	CertificateFile string `yaml:"certificate_file" toml:"certificate_file"`
+	KeyFile         string `yaml:"key_file" toml:"key_file"`
+}
+
+// MagicLinkConfig holds the passwordless sign-in settings. Links can be bound to the IP address
+// and the browser that requested them, so a forwarded or intercepted email cannot be used elsewhere.
+type MagicLinkConfig struct {
+	Enabled    bool          `yaml:"enabled" toml:"enabled"`
+	TTL        time.Duration `yaml:"ttl" toml:"ttl"`
+	BindIP     bool          `yaml:"bind_ip" toml:"bind_ip"`
+	BindDevice bool          `yaml:"bind_device" toml:"bind_device"`
+}
+
+// WebAuthnConfig holds the relying party passkeys are registered with.
+// The relying party ID and origin default to the frontend URL's host and origin.
+type WebAuthnConfig struct {
+	RPID          string   `yaml:"rp_id" toml:"rp_id"`
+	RPDisplayName string   `yaml:"rp_display_name" toml:"rp_display_name"`
+	Origins       []string `yaml:"origins" toml:"origins"`
+}
+
+// SMS providers that verification codes can be sent through
+const (
+	SMSProviderLog  = "log"  // Write messages to the log, or to a file, for development and tests
+	SMSProviderHTTP = "http" // Post messages to an HTTP SMS gateway
+)
+
+// SMSConfig holds the SMS provider settings. Without a provider, phone verification is unavailable.
+// Phone numbers without a country code are completed with DefaultCountryCode.
+type SMSConfig struct {
+	Provider           string        `yaml:"provider" toml:"provider"`
+	FilePath           string        `yaml:"file_path" toml:"file_path"`
+	GatewayURL         string        `yaml:"gateway_url" toml:"gateway_url"`
+	GatewayToken       string        `yaml:"gateway_token" toml:"gateway_token"`
+	Sender             string        `yaml:"sender" toml:"sender"`
+	DefaultCountryCode string        `yaml:"default_country_code" toml:"default_country_code"`
+	CodeTTL            time.Duration `yaml:"code_ttl" toml:"code_ttl"`
+}
+
+// SessionsConfig holds the sign-in session settings. Session locations are looked up in an offline
+// MaxMind GeoIP2 or GeoLite2 City database; without one, sessions are recorded without a location.
+type SessionsConfig struct {
+	GeoIPDatabaseFile string `yaml:"geoip_database_file" toml:"geoip_database_file"`
+	NewDeviceAlerts   bool   `yaml:"new_device_alerts" toml:"new_device_alerts"`
+}
+
+// AdminConfig holds the credentials of the seeded administrator
+type AdminConfig struct {
+	Email     string `yaml:"email" toml:"email"`
+	Password  string `yaml:"password" toml:"password"`
+	SeedToken string `yaml:"seed_token" toml:"seed_token"`
+}
+
+// EmailConfig holds the SMTP settings used to send emails
+type EmailConfig struct {
+	SMTPHost string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort int    `yaml:"smtp_port" toml:"smtp_port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// LoggingConfig holds the log output settings
+type LoggingConfig struct {
+	Format string `yaml:"format" toml:"format"`
+	Level  string `yaml:"level" toml:"level"`
+}
+
+// MetricsConfig holds the Prometheus endpoint settings
+type MetricsConfig struct {
+	Token string `yaml:"token" toml:"token"`
+}
+
+// TracingConfig holds the trace exporter settings.
+// The OTLP exporter reads its endpoint, headers and TLS settings from the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	File     string `yaml:"file" toml:"file"`
+}
+
+// AuditConfig holds the audit log settings
+type AuditConfig struct {
+	FilePath        string `yaml:"file_path" toml:"file_path"`
+	PersonalDataKey string `yaml:"personal_data_key" toml:"personal_data_key"` // Keys the hashes recorded in place of personal data; defaults to the JWT secret
+}
+
+// RetentionConfig holds the settings for purging soft-deleted users
+type RetentionConfig struct {
+	UserRetentionDays int    `yaml:"user_retention_days" toml:"user_retention_days"`
+	PurgeMode         string `yaml:"purge_mode" toml:"purge_mode"`
+}
+
+// UserRetentionPeriod returns how long soft-deleted users can still be restored
+func (r RetentionConfig) UserRetentionPeriod() time.Duration {
+	return time.Duration(r.UserRetentionDays) * 24 * time.Hour
+}
+
+// Default returns the settings used when no source overrides them
+func Default() *Config {
+	return &Config{
+		Environment: Development,
+		Server: ServerConfig{
+			Port:            "8080",
+			ShutdownTimeout: 30 * time.Second,
+			BackendURL:      "http://localhost:8080",
+			FrontendURL:     "http://localhost:3000",
+			ProxyHeader:     "X-Forwarded-For",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"http://localhost:3000"},
+			MaxAge:         600,
+		},
+		Security: SecurityConfig{
+			HSTSMaxAge:            31536000, // One year
+			HSTSIncludeSubdomains: true,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "no-referrer",
+		},
+		Auth: AuthConfig{
+			JWTSecret:        defaultJWTSecret,
+			CookieName:       "fa_session",
+			CookieSameSite:   "lax",
+			ImpersonationTTL: 15 * time.Minute,
+		},
+		OAuth: OAuthConfig{
+			CodeTTL:         5 * time.Minute,
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		MagicLink: MagicLinkConfig{
+			TTL: 15 * time.Minute,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPDisplayName: "TalentDev ID",
+		},
+		SMS: SMSConfig{
+			CodeTTL: 10 * time.Minute,
+		},
+		Sessions: SessionsConfig{
+			NewDeviceAlerts: true,
+		},
+		Admin: AdminConfig{
+			Email:    defaultAdminEmail,
+			Password: defaultAdminPassword,
+		},
+		Email: EmailConfig{
+			SMTPHost: "smtp.office365.com",
+			SMTPPort: 587,
+		},
+		Logging: LoggingConfig{
+			Format: "json",
+			Level:  "info",
+		},
+		Retention: RetentionConfig{
+			UserRetentionDays: 30,
+			PurgeMode:         "delete",
+		},
+	}
+}
+
+// IsProduction reports whether the application runs in production mode
+func (c *Config) IsProduction() bool {
+	return c.Environment == Production
+}
+
+// Validate checks that the settings are usable and, in production, that no insecure defaults remain
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Environment != Development && c.Environment != Production {
+		invalid("environment must be %q or %q", Development, Production)
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		invalid("server.port must be a port number")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout must be positive")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				invalid("server.trusted_proxies entry %q must be an IP address or CIDR range", proxy)
+			}
+		}
+	}
+	if len(c.Server.TrustedProxies) > 0 && c.Server.ProxyHeader == "" {
+		invalid("server.proxy_header is required when server.trusted_proxies is set")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if !validOrigin(origin) {
+			invalid("cors.allowed_origins entry %q must be *, or a scheme and host such as https://app.example.com or https://*.example.com", origin)
+		}
+		if origin == "*" && c.CORS.AllowCredentials {
+			invalid("cors.allowed_origins cannot contain * when cors.allow_credentials is enabled")
+		}
+	}
+	if c.CORS.MaxAge < 0 || c.Security.HSTSMaxAge < 0 {
+		invalid("cors.max_age and security.hsts_max_age cannot be negative")
+	}
+	if c.Mongo.URI == "" {
+		invalid("mongo.uri is required")
+	}
+	if c.Auth.JWTSecret == "" {
+		invalid("auth.jwt_secret is required")
+	}
+	if c.Auth.CookieMode && c.Auth.CookieName == "" {
+		invalid("auth.cookie_name is required when auth.cookie_mode is enabled")
+	}
+	if c.Auth.CookieSameSite != "strict" && c.Auth.CookieSameSite != "lax" && c.Auth.CookieSameSite != "none" {
+		invalid("auth.cookie_same_site must be strict, lax or none")
+	}
+	if c.Auth.ImpersonationTTL <= 0 || c.Auth.ImpersonationTTL > time.Hour {
+		invalid("auth.impersonation_ttl must be positive and at most 1h")
+	}
+	if c.OAuth.CodeTTL <= 0 || c.OAuth.CodeTTL > 10*time.Minute {
+		invalid("oauth.code_ttl must be positive and at most 10m")
+	}
+	if c.OAuth.AccessTokenTTL <= 0 || c.OAuth.RefreshTokenTTL <= 0 {
+		invalid("oauth.access_token_ttl and oauth.refresh_token_ttl must be positive")
+	}
+	if c.MagicLink.TTL <= 0 || c.MagicLink.TTL > time.Hour {
+		invalid("magic_link.ttl must be positive and at most 1h")
+	}
+	if c.WebAuthn.RPID == "" || len(c.WebAuthn.Origins) == 0 {
+		invalid("webauthn.rp_id and webauthn.origins are required")
+	}
+	for _, origin := range c.WebAuthn.Origins {
+		if strings.Contains(origin, "*") || !validOrigin(origin) {
+			invalid("webauthn.origins entry %q must be a scheme and host such as https://app.example.com", origin)
+		}
+	}
+	switch c.SMS.Provider {
+	case "", SMSProviderLog:
+	case SMSProviderHTTP:
+		if u, err := url.Parse(c.SMS.GatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("sms.gateway_url must be an HTTP URL when sms.provider is http")
+		}
+	default:
+		invalid("sms.provider must be empty, %q or %q", SMSProviderLog, SMSProviderHTTP)
+	}
+	for _, r := range c.SMS.DefaultCountryCode {
+		if r < '0' || r > '9' {
+			invalid("sms.default_country_code must be digits only, such as 60")
+			break
+		}
+	}
+	if c.SMS.CodeTTL <= 0 || c.SMS.CodeTTL > time.Hour {
+		invalid("sms.code_ttl must be positive and at most 1h")
+	}
+	names := make(map[string]bool)
+	for _, provider := range c.Federation.Providers {
+		if !validProviderName(provider.Name) {
+			invalid("federation provider name %q must use lowercase letters, digits and dashes", provider.Name)
+		}
+		if names[provider.Name] {
+			invalid("federation provider %q is configured twice", provider.Name)
+		}
+		names[provider.Name] = true
+		if provider.Type != ProviderGoogle && provider.Type != ProviderMicrosoft && provider.Type != ProviderOIDC {
+			invalid("federation provider %q type must be google, microsoft or oidc", provider.Name)
+		}
+		if !validIssuer(provider.Issuer) {
+			invalid("federation provider %q needs an HTTPS issuer", provider.Name)
+		}
+		if provider.ClientID == "" || provider.ClientSecret == "" {
+			invalid("federation provider %q needs a client_id and client_secret", provider.Name)
+		}
+	}
+	if c.Email.SMTPHost == "" || c.Email.SMTPPort < 1 || c.Email.SMTPPort > 65535 {
+		invalid("email.smtp_host and email.smtp_port are required")
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		invalid("logging.format must be json or text")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		invalid("logging.level must be debug, info, warn or error")
 	}
+	switch c.Tracing.Exporter {
+	case "otlp", "file", "console", "none":
+	default:
+		invalid("tracing.exporter must be otlp, file, console or none")
+	}
+	if c.Retention.UserRetentionDays < 0 {
+		invalid("retention.user_retention_days cannot be negative")
+	}
+	if c.Retention.PurgeMode != "delete" && c.Retention.PurgeMode != "anonymize" {
+		invalid("retention.purge_mode must be delete or anonymize")
+	}
+
+	// Refuse to run production with the development defaults
+	if c.IsProduction() {
+		if c.Auth.JWTSecret == defaultJWTSecret || len(c.Auth.JWTSecret) < 32 {
+			invalid("auth.jwt_secret must be changed from the default and be at least 32 characters in production")
+		}
+		if c.OIDC.SigningKeyFile == "" {
+			invalid("oidc.signing_key_file is required in production so ID tokens survive restarts")
+		}
+		if c.SAML.CertificateFile == "" || c.SAML.KeyFile == "" {
+			invalid("saml.certificate_file and saml.key_file are required in production so identity providers can trust the service provider")
+		}
+		if c.Email.User == "" || c.Email.Password == "" {
+			invalid("email.user and email.password are required in production")
+		}
+		if c.SMS.Provider == SMSProviderLog {
+			invalid("sms.provider cannot be log in production, as verification codes would be written to the log")
+		}
+		if c.Admin.SeedToken != "" {
+			if c.Admin.Email == defaultAdminEmail {
+				invalid("admin.email must be changed from the default in production")
+			}
+			if c.Admin.Password == defaultAdminPassword || len(c.Admin.Password) < 12 {
+				invalid("admin.password must be changed from the default and be at least 12 characters in production")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validOrigin reports whether origin is "*" or a scheme and host with an optional port and wildcard subdomain
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil
 }
 
-func GetEnv(key, fallback string) string { // GetEnv: function to get environment variable
-	if value, exists := os.LookupEnv(key); exists { // os.LookupEnv: function to get environment variable
-		return value // return value
+// validProviderName reports whether name is safe to use in a URL path segment
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validIssuer accepts HTTPS issuers, and HTTP on the loopback interface for local test identity providers
+func validIssuer(issuer string) bool {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Hostname()
+	return u.Scheme == "https" || (u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1"))
+}
+
+// Warnings lists the insecure defaults still in use, which are only allowed outside of production
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.Auth.JWTSecret == defaultJWTSecret {
+		warnings = append(warnings, "auth.jwt_secret is the insecure default")
+	}
+	if c.OIDC.SigningKeyFile == "" {
+		warnings = append(warnings, "oidc.signing_key_file is not set; ID tokens are signed with a temporary key")
+	}
+	if c.SAML.CertificateFile == "" || c.SAML.KeyFile == "" {
+		warnings = append(warnings, "saml.certificate_file and saml.key_file are not set; the SAML certificate changes on restart")
+	}
+	if c.Auth.CookieMode && !c.CORS.AllowCredentials {
+		warnings = append(warnings, "auth.cookie_mode is enabled without cors.allow_credentials; only same-origin clients can use cookies")
+	}
+	if c.SMS.Provider == SMSProviderLog {
+		warnings = append(warnings, "sms.provider is log; verification codes are logged instead of sent")
+	}
+	if c.Admin.SeedToken != "" && c.Admin.Password == defaultAdminPassword {
+		warnings = append(warnings, "admin.password is the insecure default")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			warnings = append(warnings, "cors.allowed_origins allows any origin")
+		}
+	}
+	return warnings
+}
+
+// normalize tidies values that are compared case-insensitively
+func (c *Config) normalize() {
+	c.Environment = strings.ToLower(strings.TrimSpace(c.Environment))
+	c.Logging.Format = strings.ToLower(c.Logging.Format)
+	c.Tracing.Exporter = strings.ToLower(c.Tracing.Exporter)
+	c.Retention.PurgeMode = strings.ToLower(c.Retention.PurgeMode)
+	c.Auth.CookieSameSite = strings.ToLower(strings.TrimSpace(c.Auth.CookieSameSite))
+	c.SMS.Provider = strings.ToLower(strings.TrimSpace(c.SMS.Provider))
+	c.SMS.DefaultCountryCode = strings.TrimPrefix(strings.TrimSpace(c.SMS.DefaultCountryCode), "+")
+	for i, origin := range c.CORS.AllowedOrigins {
+		c.CORS.AllowedOrigins[i] = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+	}
+
+	// Fill in what the well-known identity providers need
+	for i := range c.Federation.Providers {
+		provider := &c.Federation.Providers[i]
+		provider.Type = strings.ToLower(provider.Type)
+		if provider.Type == "" {
+			provider.Type = ProviderOIDC
+		}
+		if provider.Name == "" {
+			provider.Name = provider.Type
+		}
+		switch provider.Type {
+		case ProviderGoogle:
+			provider.Issuer = "https://accounts.google.com"
+			if provider.DisplayName == "" {
+				provider.DisplayName = "Google"
+			}
+		case ProviderMicrosoft:
+			if provider.Tenant == "" {
+				provider.Tenant = "organizations"
+			}
+			provider.Issuer = "https://login.microsoftonline.com/" + provider.Tenant + "/v2.0"
+			if provider.DisplayName == "" {
+				provider.DisplayName = "Microsoft"
+			}
+		}
+		provider.Issuer = strings.TrimSuffix(provider.Issuer, "/")
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
 	}
-	return fallback // return fallback
 }
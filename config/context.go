@@ -0,0 +1,16 @@
+package config
+
+import "github.com/gofiber/fiber/v2"
+
+// Middleware makes cfg available to handlers through FromContext
+func Middleware(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("config", cfg)
+		return c.Next()
+	}
+}
+
+// FromContext returns the configuration set by Middleware
+func FromContext(c *fiber.Ctx) *Config {
+	return c.Locals("config").(*Config)
+}
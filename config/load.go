@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from, in increasing order of precedence:
+// the defaults, a YAML or TOML file, a .env file, and the process environment.
+//
+// The file is read from path, or from CONFIG_FILE when path is empty; both are optional.
+// A missing .env file is not an error, and it never overrides variables already set.
+func Load(path string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("cannot read .env file: %w", err)
+	}
+
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.normalize()
+
+	// Pick a trace exporter when none was configured
+	if cfg.Tracing.Exporter == "" {
+		switch {
+		case os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "":
+			cfg.Tracing.Exporter = "otlp"
+		case cfg.Tracing.File != "":
+			cfg.Tracing.Exporter = "file"
+		default:
+			cfg.Tracing.Exporter = "console"
+		}
+	}
+	if cfg.OIDC.Issuer == "" {
+		cfg.OIDC.Issuer = cfg.Server.BackendURL
+	}
+	cfg.OIDC.Issuer = strings.TrimSuffix(cfg.OIDC.Issuer, "/")
+	if cfg.Audit.PersonalDataKey == "" {
+		cfg.Audit.PersonalDataKey = cfg.Auth.JWTSecret
+	}
+
+	// Passkeys belong to the frontend unless configured otherwise
+	if frontend, err := url.Parse(cfg.Server.FrontendURL); err == nil {
+		if cfg.WebAuthn.RPID == "" {
+			cfg.WebAuthn.RPID = frontend.Hostname()
+		}
+		if len(cfg.WebAuthn.Origins) == 0 && frontend.Host != "" {
+			cfg.WebAuthn.Origins = []string{frontend.Scheme + "://" + frontend.Host}
+		}
+	}
+
+	if cfg.Tracing.Exporter == "file" && cfg.Tracing.File == "" {
+		cfg.Tracing.File = "traces.json"
+	}
+
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by its extension, over cfg
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file %q, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// findProvider returns the configured provider with the given name, adding one of that type when there is none
+func findProvider(cfg *Config, name string) *IdentityProviderConfig {
+	for i := range cfg.Federation.Providers {
+		if cfg.Federation.Providers[i].Name == name {
+			return &cfg.Federation.Providers[i]
+		}
+	}
+	cfg.Federation.Providers = append(cfg.Federation.Providers, IdentityProviderConfig{Name: name, Type: name})
+	return &cfg.Federation.Providers[len(cfg.Federation.Providers)-1]
+}
+
+// loadEnv overrides cfg with the environment variables that are set
+func loadEnv(cfg *Config) error {
+	var errs []error
+
+	envString := func(target *string, key string) {
+		if value, ok := os.LookupEnv(key); ok {
+			*target = value
+		}
+	}
+	envInt := func(target *int, key string) {
+		if value, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number", key))
+				return
+			}
+			*target = n
+		}
+	}
+	envBool := func(target *bool, key string) {
+		if value, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false", key))
+				return
+			}
+			*target = b
+		}
+	}
+	envList := func(target *[]string, key string) {
+		if value, ok := os.LookupEnv(key); ok {
+			*target = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*target = append(*target, item)
+				}
+			}
+		}
+	}
+	envDuration := func(target *time.Duration, key string) {
+		if value, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration such as 30s", key))
+				return
+			}
+			*target = d
+		}
+	}
+
+	envString(&cfg.Environment, "APP_ENV")
+
+	envString(&cfg.Server.Port, "PORT")
+	envDuration(&cfg.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	envString(&cfg.Server.BackendURL, "BACKEND_URL")
+	envString(&cfg.Server.FrontendURL, "FRONTEND_URL")
+	envList(&cfg.Server.TrustedProxies, "TRUSTED_PROXIES")
+	envString(&cfg.Server.ProxyHeader, "PROXY_HEADER")
+
+	envList(&cfg.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS")
+	envBool(&cfg.CORS.AllowCredentials, "CORS_ALLOW_CREDENTIALS")
+	envInt(&cfg.CORS.MaxAge, "CORS_MAX_AGE")
+
+	envInt(&cfg.Security.HSTSMaxAge, "HSTS_MAX_AGE")
+	envBool(&cfg.Security.HSTSIncludeSubdomains, "HSTS_INCLUDE_SUBDOMAINS")
+	envString(&cfg.Security.ContentSecurityPolicy, "CONTENT_SECURITY_POLICY")
+	envString(&cfg.Security.FrameOptions, "FRAME_OPTIONS")
+	envString(&cfg.Security.ReferrerPolicy, "REFERRER_POLICY")
+
+	envString(&cfg.Mongo.URI, "MONGO_URI")
+
+	envString(&cfg.Auth.JWTSecret, "JWT_SECRET")
+	envBool(&cfg.Auth.CookieMode, "AUTH_COOKIE_MODE")
+	envString(&cfg.Auth.CookieName, "AUTH_COOKIE_NAME")
+	envString(&cfg.Auth.CookieDomain, "AUTH_COOKIE_DOMAIN")
+	envString(&cfg.Auth.CookieSameSite, "AUTH_COOKIE_SAME_SITE")
+	envDuration(&cfg.Auth.ImpersonationTTL, "AUTH_IMPERSONATION_TTL")
+
+	envDuration(&cfg.OAuth.CodeTTL, "OAUTH_CODE_TTL")
+	envDuration(&cfg.OAuth.AccessTokenTTL, "OAUTH_ACCESS_TOKEN_TTL")
+	envDuration(&cfg.OAuth.RefreshTokenTTL, "OAUTH_REFRESH_TOKEN_TTL")
+
+	envString(&cfg.OIDC.Issuer, "OIDC_ISSUER")
+	envString(&cfg.OIDC.SigningKeyFile, "OIDC_SIGNING_KEY_FILE")
+
+	// Google and Microsoft sign-in can be enabled with client credentials alone
+	for _, providerType := range []string{ProviderGoogle, ProviderMicrosoft} {
+		prefix := strings.ToUpper(providerType) + "_"
+		clientID, ok := os.LookupEnv(prefix + "CLIENT_ID")
+		if !ok {
+			continue
+		}
+		provider := findProvider(cfg, providerType)
+		provider.ClientID = clientID
+		envString(&provider.ClientSecret, prefix+"CLIENT_SECRET")
+		if providerType == ProviderMicrosoft {
+			envString(&provider.Tenant, "MICROSOFT_TENANT")
+		}
+	}
+
+	envString(&cfg.SAML.CertificateFile, "SAML_CERTIFICATE_FILE")
+	envString(&cfg.SAML.KeyFile, "SAML_KEY_FILE")
+
+	envBool(&cfg.MagicLink.Enabled, "MAGIC_LINK_ENABLED")
+	envDuration(&cfg.MagicLink.TTL, "MAGIC_LINK_TTL")
+	envBool(&cfg.MagicLink.BindIP, "MAGIC_LINK_BIND_IP")
+	envBool(&cfg.MagicLink.BindDevice, "MAGIC_LINK_BIND_DEVICE")
+
+	envString(&cfg.WebAuthn.RPID, "WEBAUTHN_RP_ID")
+	envString(&cfg.WebAuthn.RPDisplayName, "WEBAUTHN_RP_DISPLAY_NAME")
+	envList(&cfg.WebAuthn.Origins, "WEBAUTHN_ORIGINS")
+
+	envString(&cfg.SMS.Provider, "SMS_PROVIDER")
+	envString(&cfg.SMS.FilePath, "SMS_FILE_PATH")
+	envString(&cfg.SMS.GatewayURL, "SMS_GATEWAY_URL")
+	envString(&cfg.SMS.GatewayToken, "SMS_GATEWAY_TOKEN")
+	envString(&cfg.SMS.Sender, "SMS_SENDER")
+	envString(&cfg.SMS.DefaultCountryCode, "SMS_DEFAULT_COUNTRY_CODE")
+	envDuration(&cfg.SMS.CodeTTL, "SMS_CODE_TTL")
+
+	envString(&cfg.Sessions.GeoIPDatabaseFile, "GEOIP_DATABASE_FILE")
+	envBool(&cfg.Sessions.NewDeviceAlerts, "SESSION_NEW_DEVICE_ALERTS")
+
+	envString(&cfg.Admin.Email, "ADMIN_EMAIL")
+	envString(&cfg.Admin.Password, "ADMIN_PASSWORD")
+	envString(&cfg.Admin.SeedToken, "ADMIN_SEED_TOKEN")
+
+	envString(&cfg.Email.SMTPHost, "SMTP_HOST")
+	envInt(&cfg.Email.SMTPPort, "SMTP_PORT")
+	envString(&cfg.Email.User, "EMAIL_USER")
+	envString(&cfg.Email.Password, "EMAIL_PASS")
+
+	envString(&cfg.Logging.Format, "LOG_FORMAT")
+	envString(&cfg.Logging.Level, "LOG_LEVEL")
+
+	envString(&cfg.Metrics.Token, "METRICS_TOKEN")
+
+	envString(&cfg.Tracing.Exporter, "OTEL_TRACES_EXPORTER")
+	envString(&cfg.Tracing.File, "OTEL_TRACES_FILE")
+
+	envString(&cfg.Audit.FilePath, "AUDIT_FILE_PATH")
+	envString(&cfg.Audit.PersonalDataKey, "AUDIT_PERSONAL_DATA_KEY")
+
+	envInt(&cfg.Retention.UserRetentionDays, "USER_RETENTION_DAYS")
+	envString(&cfg.Retention.PurgeMode, "USER_PURGE_MODE")
+
+	return errors.Join(errs...)
+}
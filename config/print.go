@@ -0,0 +1,52 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with secrets hidden
+func (c Config) Redacted() Config {
+	hide := func(value *string) {
+		if *value != "" {
+			*value = redacted
+		}
+	}
+
+	hide(&c.Auth.JWTSecret)
+	hide(&c.Audit.PersonalDataKey)
+	hide(&c.Admin.Password)
+	hide(&c.Admin.SeedToken)
+	hide(&c.Email.Password)
+	hide(&c.Metrics.Token)
+	hide(&c.SMS.GatewayToken)
+
+	// Copy the providers so the original secrets are left untouched
+	c.Federation.Providers = append([]IdentityProviderConfig(nil), c.Federation.Providers...)
+	for i := range c.Federation.Providers {
+		hide(&c.Federation.Providers[i].ClientSecret)
+	}
+
+	// Keep the database host visible but hide its password
+	if uri, err := url.Parse(c.Mongo.URI); err == nil {
+		c.Mongo.URI = uri.Redacted()
+	} else {
+		hide(&c.Mongo.URI)
+	}
+
+	return c
+}
+
+// Print writes the effective configuration as YAML with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
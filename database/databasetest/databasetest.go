@@ -0,0 +1,33 @@
+// Package databasetest connects tests to a MongoDB server named by TEST_MONGODB_URI.
+package databasetest
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+)
+
+var (
+	connectOnce sync.Once
+	connectErr  error
+)
+
+// Connect connects the database package to the test server, skipping the test when none is configured.
+// The connection is shared by every test in the package.
+func Connect(t testing.TB) {
+	t.Helper()
+
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+	connectOnce.Do(func() {
+		connectErr = database.ConnectMongoDB(config.MongoConfig{URI: uri})
+	})
+	if connectErr != nil {
+		t.Fatal(connectErr)
+	}
+}
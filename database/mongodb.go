@@ -3,25 +3,31 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"myfibergotemplate/config"
+	"myfibergotemplate/metrics"
 	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 var MongoClient *mongo.Client
 
-func ConnectMongoDB() error {
-	log.Println("Attempting to connect to MongoDB...")
-	mongoURI := config.GetEnv("MONGO_URI", "")
+func ConnectMongoDB(cfg config.MongoConfig) error {
+	slog.Info("Attempting to connect to MongoDB")
+	mongoURI := cfg.URI
 	if mongoURI == "" {
-		log.Println("MONGO_URI environment variable is not set.")
-		return fmt.Errorf("MONGO_URI environment variable is not set")
+		slog.Error("MongoDB URI is not configured")
+		return fmt.Errorf("MongoDB URI is not configured")
 	}
 
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	clientOptions := options.Client().
+		ApplyURI(mongoURI).
+		SetMonitor(combineMonitors(otelmongo.NewMonitor(), metrics.CommandMonitor())).
+		SetPoolMonitor(metrics.PoolMonitor())
 	var err error
 
 	for attempt := 1; attempt <= 5; attempt++ {
@@ -30,13 +36,13 @@ func ConnectMongoDB() error {
 		if err == nil {
 			err = MongoClient.Ping(ctx, nil)
 			if err == nil {
-				log.Println("Connected to MongoDB!")
+				slog.Info("Connected to MongoDB")
 				cancel()
 				return nil
 			}
 		}
 
-		log.Printf("Failed to connect to MongoDB: %v, retrying in %d seconds", err, attempt*2)
+		slog.Warn("Failed to connect to MongoDB, retrying", "error", err, "attempt", attempt, "retry_in_seconds", attempt*2)
 		time.Sleep(time.Duration(attempt*2) * time.Second)
 		cancel()
 	}
@@ -44,6 +50,41 @@ func ConnectMongoDB() error {
 	return fmt.Errorf("failed to connect to MongoDB after several attempts: %v", err)
 }
 
+// combineMonitors fans command events out to several monitors, e.g. tracing and metrics
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// DisconnectMongoDB closes the client's connections once in-flight operations finish
+func DisconnectMongoDB(ctx context.Context) error {
+	if MongoClient == nil {
+		return nil
+	}
+	return MongoClient.Disconnect(ctx)
+}
+
 func GetMongoClient() *mongo.Client {
 	return MongoClient
 }
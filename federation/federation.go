@@ -0,0 +1,63 @@
+package federation
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"myfibergotemplate/config"
+)
+
+// Provider is an external OpenID Connect identity provider users can sign in with
+type Provider struct {
+	Name        string
+	DisplayName string
+
+	cfg config.IdentityProviderConfig
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	metadataUntil time.Time
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// Identity is what a provider asserts about the user who signed in
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Attributes    map[string]string // Profile fields the provider asserts, keyed by their user field name
+}
+
+var (
+	providers map[string]*Provider
+	ordered   []*Provider
+
+	// httpClient talks to the identity providers; their endpoints must answer quickly
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Init registers the configured identity providers. Their discovery documents are fetched on first use.
+func Init(cfg config.FederationConfig) {
+	providers = make(map[string]*Provider, len(cfg.Providers))
+	ordered = nil
+	for _, providerConfig := range cfg.Providers {
+		provider := &Provider{Name: providerConfig.Name, DisplayName: providerConfig.DisplayName, cfg: providerConfig}
+		providers[provider.Name] = provider
+		ordered = append(ordered, provider)
+	}
+}
+
+// Providers returns the configured providers in configuration order
+func Providers() []*Provider {
+	return ordered
+}
+
+// Get returns the provider with the given name
+func Get(name string) (*Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
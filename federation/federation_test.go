@@ -0,0 +1,279 @@
+package federation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/federation/federationtest"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testRedirectURI = "https://api.example.com/auth/federated/mock/callback"
+
+// newTestProvider registers the local identity provider idp as the "mock" provider
+func newTestProvider(t *testing.T, idp *federationtest.IdentityProvider) *Provider {
+	t.Helper()
+
+	Init(config.FederationConfig{Providers: []config.IdentityProviderConfig{{
+		Name:         "mock",
+		Type:         config.ProviderOIDC,
+		DisplayName:  "Mock",
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}}})
+	provider, ok := Get("mock")
+	if !ok {
+		t.Fatal("provider not registered")
+	}
+	return provider
+}
+
+// authorize starts a login the way the callback handler expects and follows it to the identity provider,
+// returning the authorization code and state it sends back
+func authorize(t *testing.T, provider *Provider, state, nonce, codeVerifier string) (string, string) {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	authURL, err := provider.AuthCodeURL(context.Background(), testRedirectURI, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization request failed with %s", resp.Status)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	provider := newTestProvider(t, idp)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), testRedirectURI, "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.URL+"/authorize" {
+		t.Errorf("authorization endpoint is %s, want the discovered one", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             idp.ClientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        "the-challenge",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s is %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryAndKeysAreCached(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true}
+	provider := newTestProvider(t, idp)
+
+	for i := 0; i < 2; i++ {
+		code, _ := authorize(t, provider, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := idp.DiscoveryRequests.Load(); n != 1 {
+		t.Errorf("discovery document fetched %d times, want once", n)
+	}
+	if n := idp.KeyRequests.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want once", n)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true}
+	provider := newTestProvider(t, idp)
+
+	code, _ := authorize(t, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if err := idp.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown key so soon after fetching the key set is rejected without hammering the provider
+	code, _ = authorize(t, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce"); err == nil {
+		t.Error("ID token signed with an unknown key was accepted")
+	}
+	if n := idp.KeyRequests.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want once", n)
+	}
+
+	// Later, the key set is fetched again and the new key is trusted
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-2 * keysRefreshWait)
+	provider.mu.Unlock()
+
+	code, _ = authorize(t, provider, "state", "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce"); err != nil {
+		t.Errorf("ID token signed with the rotated key was rejected: %v", err)
+	}
+	if n := idp.KeyRequests.Load(); n != 2 {
+		t.Errorf("key set fetched %d times, want twice", n)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	idp.User = jwt.MapClaims{"sub": "user-1", "email": " Jane.Doe@Example.com", "email_verified": true, "name": "Jane Doe"}
+	provider := newTestProvider(t, idp)
+
+	code, state := authorize(t, provider, "the-state", "the-nonce", "the-verifier")
+	if state != "the-state" {
+		t.Errorf("state is %q, want it returned unchanged", state)
+	}
+
+	identity, err := provider.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Provider: "mock", Subject: "user-1", Email: "jane.doe@example.com", EmailVerified: true, Name: "Jane Doe"}
+	if identity.Provider != want.Provider || identity.Subject != want.Subject || identity.Email != want.Email ||
+		identity.EmailVerified != want.EmailVerified || identity.Name != want.Name {
+		t.Errorf("identity is %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeChecksPKCE(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true}
+	provider := newTestProvider(t, idp)
+
+	code, _ := authorize(t, provider, "state", "nonce", "the-verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "another-verifier", "nonce"); err == nil {
+		t.Error("code redeemed with the wrong verifier")
+	}
+
+	code, _ = authorize(t, provider, "state", "nonce", "the-verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "nonce"); err == nil {
+		t.Error("code redeemed twice")
+	}
+}
+
+func TestExchangeChecksNonce(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true}
+	provider := newTestProvider(t, idp)
+
+	code, _ := authorize(t, provider, "state", "the-nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "another-nonce"); err == nil {
+		t.Error("ID token for another login attempt was accepted")
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"wrong issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://attacker.example" }},
+		{"wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", func(claims jwt.MapClaims) { delete(claims, "exp") }},
+		{"no nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{"no subject", func(claims jwt.MapClaims) { delete(claims, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := federationtest.NewIdentityProvider(t)
+			idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true}
+			idp.ModifyClaims = tt.modify
+			provider := newTestProvider(t, idp)
+
+			code, _ := authorize(t, provider, "state", "nonce", "verifier")
+			if _, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce"); err == nil {
+				t.Error("invalid ID token was accepted")
+			}
+		})
+	}
+}
+
+func TestEmailVerified(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{"verified", jwt.MapClaims{"email_verified": true}, true},
+		{"verified as a string", jwt.MapClaims{"email_verified": "true"}, true},
+		{"unverified", jwt.MapClaims{"email_verified": false}, false},
+		{"unverified as a string", jwt.MapClaims{"email_verified": "false"}, false},
+		{"not stated", jwt.MapClaims{}, false},
+		{"domain verified by a Microsoft tenant", jwt.MapClaims{"xms_edov": true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := federationtest.NewIdentityProvider(t)
+			idp.User = jwt.MapClaims{"sub": "user-1", "email": "jane@example.com"}
+			for name, value := range tt.claims {
+				idp.User[name] = value
+			}
+			provider := newTestProvider(t, idp)
+
+			code, _ := authorize(t, provider, "state", "nonce", "verifier")
+			identity, err := provider.Exchange(context.Background(), testRedirectURI, code, "verifier", "nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.EmailVerified != tt.want {
+				t.Errorf("email verified is %v, want %v", identity.EmailVerified, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnreachableProvider(t *testing.T) {
+	idp := federationtest.NewIdentityProvider(t)
+	provider := newTestProvider(t, idp)
+	idp.Close()
+
+	if _, err := provider.AuthCodeURL(context.Background(), testRedirectURI, "state", "nonce", "challenge"); err == nil {
+		t.Error("login started without the provider's discovery document")
+	}
+}
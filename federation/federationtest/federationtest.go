@@ -0,0 +1,232 @@
+// Package federationtest provides a local OpenID Connect identity provider for tests.
+package federationtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// IdentityProvider is an OpenID Connect provider serving discovery, a key set, an authorization endpoint that
+// signs in User without asking, and a token endpoint that checks the client, redirect URI and PKCE verifier
+type IdentityProvider struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// User is the claims about the person who signs in, e.g. sub, email and email_verified
+	User jwt.MapClaims
+
+	// ModifyClaims, when set, changes the claims of each ID token before it is signed
+	ModifyClaims func(claims jwt.MapClaims)
+
+	DiscoveryRequests atomic.Int32
+	KeyRequests       atomic.Int32
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	grants map[string]grant
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	user          jwt.MapClaims
+}
+
+// NewIdentityProvider starts an identity provider; it is closed when the test ends
+func NewIdentityProvider(t testing.TB) *IdentityProvider {
+	t.Helper()
+
+	idp := &IdentityProvider{
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		grants:       make(map[string]grant),
+	}
+	if err := idp.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// Issuer is the provider's issuer, which is also its base URL
+func (idp *IdentityProvider) Issuer() string {
+	return idp.URL
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID
+func (idp *IdentityProvider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.keyID = randomString()
+	return nil
+}
+
+func (idp *IdentityProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	idp.DiscoveryRequests.Add(1)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 idp.Issuer(),
+		"authorization_endpoint": idp.URL + "/authorize",
+		"token_endpoint":         idp.URL + "/token",
+		"jwks_uri":               idp.URL + "/keys",
+	})
+}
+
+func (idp *IdentityProvider) keys(w http.ResponseWriter, r *http.Request) {
+	idp.KeyRequests.Add(1)
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs User in straight away and sends the browser back with a code
+func (idp *IdentityProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" || query.Get("client_id") != idp.ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	idp.mu.Lock()
+	idp.grants[code] = grant{
+		redirectURI:   redirectURI.String(),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		user:          idp.User,
+	}
+	idp.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems a code once for an ID token
+func (idp *IdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	if r.PostForm.Get("client_id") != idp.ClientID || r.PostForm.Get("client_secret") != idp.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	code := r.PostForm.Get("code")
+	grant, ok := idp.grants[code]
+	delete(idp.grants, code)
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown or used code"})
+		return
+	case r.PostForm.Get("redirect_uri") != grant.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != grant.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss": idp.Issuer(),
+		"aud": idp.ClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	}
+	if grant.nonce != "" {
+		claims["nonce"] = grant.nonce
+	}
+	for name, value := range grant.user {
+		claims[name] = value
+	}
+	if idp.ModifyClaims != nil {
+		idp.ModifyClaims(claims)
+	}
+
+	idToken, err := idp.Sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// Sign signs claims as an ID token with the current key
+func (idp *IdentityProvider) Sign(claims jwt.MapClaims) (string, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.keyID
+	return token.SignedString(idp.key)
+}
+
+// randomString returns a random URL-safe string, e.g. for codes and key IDs
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,75 @@
+// Package geoip looks up the approximate location of IP addresses in an offline MaxMind database.
+package geoip
+
+import (
+	"net"
+	"strings"
+
+	"myfibergotemplate/models"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// The City database, set by Init. Lookups return nothing without one.
+var reader *geoip2.Reader
+
+// Init opens the GeoIP2 or GeoLite2 City database file, if one is configured
+func Init(file string) error {
+	if file == "" {
+		return nil
+	}
+	r, err := geoip2.Open(file)
+	if err != nil {
+		return err
+	}
+	reader = r
+	return nil
+}
+
+// Close releases the database
+func Close() error {
+	if reader == nil {
+		return nil
+	}
+	return reader.Close()
+}
+
+// Lookup returns where an IP address is, or nil when it is unknown, such as for private addresses
+func Lookup(ip string) *models.SessionLocation {
+	addr := net.ParseIP(ip)
+	if reader == nil || addr == nil || addr.IsPrivate() || addr.IsLoopback() {
+		return nil
+	}
+
+	record, err := reader.City(addr)
+	if err != nil || record.Country.IsoCode == "" {
+		return nil
+	}
+
+	location := &models.SessionLocation{
+		City:        record.City.Names["en"],
+		Country:     record.Country.Names["en"],
+		CountryCode: record.Country.IsoCode,
+	}
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+	return location
+}
+
+// Describe writes a location for messages to users, e.g. "Kuala Lumpur, Malaysia"
+func Describe(location *models.SessionLocation) string {
+	if location == nil {
+		return "Unknown location"
+	}
+	var parts []string
+	for _, part := range []string{location.City, location.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return location.CountryCode
+	}
+	return strings.Join(parts, ", ")
+}
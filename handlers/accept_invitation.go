@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AcceptInvitationHandler lets an invited user set their password, which also verifies their email. It accepts
+// invitations from administrators and organizations as well as those of imported users.
+func AcceptInvitationHandler(c *fiber.Ctx) error {
+	type AcceptInvitationRequest struct {
+		Token          string `json:"token" validate:"required"`
+		Password       string `json:"password"`
+		PersonInCharge string `json:"person_in_charge"`
+	}
+
+	var req AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Token == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invitation token is missing"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	invitation, err := services.FindPendingInvitation(ctx, req.Token)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invalid or expired invitation"})
+	}
+	return acceptInvitationWithPassword(ctx, c, invitation, req.Password, req.PersonInCharge)
+}
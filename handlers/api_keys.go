@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxAPIKeys = 20 // Maximum unrevoked API keys per merchant
+
+// CreateAPIKeyHandler issues an API key for the signed-in merchant's backend. The key is returned
+// once and cannot be retrieved again.
+func CreateAPIKeyHandler(c *fiber.Ctx) error {
+	type CreateAPIKeyRequest struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	// Keys act with the merchant's rights, so administrators cannot create them
+	if c.Locals("userRole") != string(models.Merchant) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "API keys are available to merchants only"})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name must be between 1 and 64 characters"})
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{models.APIKeyScopeRead}
+	}
+	for _, scope := range req.Scopes {
+		if scope != models.APIKeyScopeRead && scope != models.APIKeyScopeWrite {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Scopes must be read or write"})
+		}
+	}
+	slices.Sort(req.Scopes)
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Expiry must be in the future"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	active, err := services.CountActiveAPIKeys(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+	if active >= maxAPIKeys {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Too many API keys; revoke one before creating another"})
+	}
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Compact(req.Scopes),
+		ExpiresAt: req.ExpiresAt,
+	}
+	secret, err := services.NewAPIKey(ctx, key)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	event := newUserAuditEvent(c, "user.api_key_created", userID.Hex())
+	event.Metadata = map[string]string{"api_key_id": key.ID.Hex(), "prefix": key.Prefix, "scopes": strings.Join(key.Scopes, " ")}
+	audit.Record(event)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "API key created. Store it now; it will not be shown again.",
+		"key":     secret,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeysHandler returns the signed-in merchant's API keys, without their secrets
+func ListAPIKeysHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	keys, err := services.APIKeysForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve API keys"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"api_keys": keys})
+}
+
+// RevokeAPIKeyHandler revokes one of the signed-in merchant's API keys; requests made with it fail from then on
+func RevokeAPIKeyHandler(c *fiber.Ctx) error {
+	keyID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := services.RevokeAPIKeys(ctx, bson.M{"_id": keyID, "user_id": userID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	if revoked == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+
+	event := newUserAuditEvent(c, "user.api_key_revoked", userID.Hex())
+	event.Metadata = map[string]string{"api_key_id": keyID.Hex()}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "API key revoked successfully"})
+}
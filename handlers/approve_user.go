@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/database"
 	"myfibergotemplate/models"
 
@@ -29,12 +30,12 @@ func ApproveUserHandler(c *fiber.Ctx) error {
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Create a context with a timeout for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	// Find the user by ID
 	var user models.User
-	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
@@ -57,6 +58,11 @@ func ApproveUserHandler(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	// Record which administrator approved the user
+	event := newUserAuditEvent(c, "user.approved", userID)
+	event.Changes = map[string]models.AuditChange{"status": {Before: string(user.Status), After: string(models.Approved)}}
+	audit.Record(event)
+
 	// Return a success message
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User approved successfully"})
 }
@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/tracing"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const maxBulkJobSize = 10000    // Maximum number of users a single bulk job may target
+const bulkProgressInterval = 50 // Number of processed users between progress updates
+
+// bulkHeartbeatInterval is the longest a running job goes without saving its progress, well within
+// services.BulkJobStaleAfter so it isn't taken for an interrupted job
+const bulkHeartbeatInterval = 30 * time.Second
+
+// bulkJobsCtx is cancelled on shutdown so running jobs stop and are marked failed instead of staying running
+var bulkJobsCtx, stopBulkJobs = context.WithCancel(context.Background())
+
+// StopBulkJobs interrupts the bulk jobs that are still running
+func StopBulkJobs() {
+	stopBulkJobs()
+}
+
+// CreateBulkUserJobHandler starts a bulk operation on a list of user IDs or on the users matching a filter
+func CreateBulkUserJobHandler(c *fiber.Ctx) error {
+	type BulkRequest struct {
+		Action  models.BulkAction  `json:"action"`
+		UserIDs []string           `json:"user_ids"`
+		Filter  *models.UserFilter `json:"filter"`
+		Role    models.Role        `json:"role"`
+		DryRun  bool               `json:"dry_run"`
+	}
+
+	var req BulkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	// Validate the requested action and its parameters
+	switch req.Action {
+	case models.BulkApprove, models.BulkSuspend, models.BulkDelete, models.BulkResendVerification:
+	case models.BulkChangeRole:
+		if req.Role != models.Administrator && req.Role != models.Merchant {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A valid role is required for change_role"})
+		}
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported bulk action"})
+	}
+
+	// Exactly one way of selecting users must be provided
+	if (len(req.UserIDs) == 0) == (req.Filter == nil) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Provide either user_ids or filter"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	// Resolve the target users up front so the job knows its total size
+	var targets []primitive.ObjectID
+	if len(req.UserIDs) > 0 {
+		seen := make(map[primitive.ObjectID]bool)
+		for _, id := range req.UserIDs {
+			objID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID", "user_id": id})
+			}
+			if !seen[objID] {
+				seen[objID] = true
+				targets = append(targets, objID)
+			}
+		}
+	} else {
+		query, err := buildUserFilter(ctx, *req.Filter)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve filter"})
+		}
+		opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(maxBulkJobSize + 1)
+		cursor, err := collection.Find(ctx, query, opts)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve filter"})
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID primitive.ObjectID `bson:"_id"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode user data"})
+			}
+			targets = append(targets, doc.ID)
+		}
+		if err := cursor.Err(); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Cursor iteration error"})
+		}
+	}
+
+	if len(targets) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No users matched the request"})
+	}
+	if len(targets) > maxBulkJobSize {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Too many users in a single bulk job", "max": maxBulkJobSize})
+	}
+
+	// Record the job before starting it so its progress can be polled immediately
+	job := models.BulkJob{
+		ID:        primitive.NewObjectID(),
+		Action:    req.Action,
+		Role:      req.Role,
+		Filter:    req.Filter,
+		DryRun:    req.DryRun,
+		Status:    models.BulkJobQueued,
+		Total:     len(targets),
+		Results:   []models.BulkJobItem{},
+		CreatedBy: c.Locals("userID").(string),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if req.Filter == nil {
+		job.UserIDs = targets
+	}
+
+	jobs := database.GetMongoClient().Database("talentdevgo").Collection("bulk_jobs")
+	if _, err := jobs.InsertOne(ctx, job); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create bulk job"})
+	}
+
+	// Record the job itself; each applied change is recorded separately as it runs
+	event := audit.NewEvent(c, "bulk.job_created")
+	event.TargetType = "bulk_job"
+	event.TargetID = job.ID.Hex()
+	event.Metadata = map[string]string{
+		"action":  string(job.Action),
+		"total":   strconv.Itoa(job.Total),
+		"dry_run": strconv.FormatBool(job.DryRun),
+	}
+	audit.Record(event)
+
+	go runBulkJob(config.FromContext(c), job, targets, audit.NewEvent(c, ""))
+
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{
+		"message": "Bulk job created",
+		"job":     job,
+	})
+}
+
+// ListBulkUserJobsHandler lists the most recent bulk jobs without their per-user results
+func ListBulkUserJobsHandler(c *fiber.Ctx) error {
+	jobs := database.GetMongoClient().Database("talentdevgo").Collection("bulk_jobs")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetLimit(int64(c.QueryInt("limit", 50))).
+		SetProjection(bson.M{"results": 0, "user_ids": 0})
+
+	cursor, err := jobs.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve bulk jobs"})
+	}
+	defer cursor.Close(ctx)
+
+	result := []models.BulkJob{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode bulk jobs"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "Bulk jobs retrieved successfully",
+		"jobs":    result,
+	})
+}
+
+// GetBulkUserJobHandler reports the progress and per-user results of a bulk job
+func GetBulkUserJobHandler(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("jobId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
+	}
+
+	jobs := database.GetMongoClient().Database("talentdevgo").Collection("bulk_jobs")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	var job models.BulkJob
+	if err := jobs.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(bson.M{"results": 0})).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Bulk job not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve bulk job"})
+	}
+
+	// Optionally narrow the results down to a single outcome, e.g. ?status=failed
+	filter := bson.M{"job_id": objID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	items := database.GetMongoClient().Database("talentdevgo").Collection("bulk_job_items")
+	cursor, err := items.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "job_id", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve bulk job results"})
+	}
+	job.Results = []models.BulkJobItem{}
+	if err := cursor.All(ctx, &job.Results); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode bulk job results"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":  "Bulk job retrieved successfully",
+		"progress": bulkJobProgress(job),
+		"job":      job,
+	})
+}
+
+// bulkJobProgress returns the percentage of processed users in a job
+func bulkJobProgress(job models.BulkJob) float64 {
+	if job.Total == 0 {
+		return 100
+	}
+	return float64(job.Processed) * 100 / float64(job.Total)
+}
+
+// runBulkJob applies the job's action to every target user and records the outcome of each one.
+// Applied changes are audited using the request details captured in auditBase. Outcomes are saved in
+// batches with the job's progress.
+func runBulkJob(cfg *config.Config, job models.BulkJob, targets []primitive.ObjectID, auditBase models.AuditEvent) {
+	jobs := database.GetMongoClient().Database("talentdevgo").Collection("bulk_jobs")
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// Trace the job as its own root span, since it outlives the request that created it
+	jobCtx, span := tracing.Start(bulkJobsCtx, "bulk.job")
+	span.SetAttributes(attribute.String("bulk.job_id", job.ID.Hex()), attribute.String("bulk.action", string(job.Action)), attribute.Int("bulk.total", job.Total))
+	defer span.End()
+
+	// Outcomes not saved yet
+	pending := []models.BulkJobItem{}
+
+	// A job that stops part way is marked failed so it doesn't stay running forever
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Bulk job stopped unexpectedly", "job_id", job.ID.Hex(), "panic", r)
+			failBulkJob(jobs, &job, pending, "Job stopped unexpectedly")
+		}
+	}()
+
+	job.Status = models.BulkJobRunning
+	saveBulkJobProgress(jobs, &job, nil)
+	savedAt := time.Now()
+
+	for _, objID := range targets {
+		if jobCtx.Err() != nil {
+			failBulkJob(jobs, &job, pending, "Job was interrupted before it finished")
+			return
+		}
+
+		item := processBulkItem(jobCtx, cfg, collection, job, objID)
+		item.ID = primitive.NewObjectID()
+		item.JobID = job.ID
+
+		pending = append(pending, item)
+		if item.Status == models.BulkItemSucceeded {
+			event := auditBase
+			event.Action = "user.bulk_" + string(job.Action)
+			event.TargetType = "user"
+			event.TargetID = objID.Hex()
+			event.Metadata = map[string]string{"job_id": job.ID.Hex()}
+			if job.Action == models.BulkChangeRole {
+				event.Metadata["role"] = string(job.Role)
+			}
+			audit.Record(event)
+		}
+		job.Processed++
+		switch item.Status {
+		case models.BulkItemSucceeded, models.BulkItemWouldSucceed:
+			job.Succeeded++
+		case models.BulkItemSkipped:
+			job.Skipped++
+		default:
+			job.Failed++
+		}
+
+		// Persist progress periodically so large jobs can be monitored, and so they aren't taken for stopped ones
+		if len(pending) == bulkProgressInterval || time.Since(savedAt) >= bulkHeartbeatInterval {
+			saveBulkJobProgress(jobs, &job, pending)
+			pending = pending[:0]
+			savedAt = time.Now()
+		}
+	}
+
+	completedAt := time.Now()
+	job.Status = models.BulkJobCompleted
+	job.CompletedAt = &completedAt
+	saveBulkJobProgress(jobs, &job, pending)
+}
+
+// failBulkJob marks the job failed with the reason it stopped, saving the outcomes not saved yet
+func failBulkJob(jobs *mongo.Collection, job *models.BulkJob, pending []models.BulkJobItem, reason string) {
+	completedAt := time.Now()
+	job.Status = models.BulkJobFailed
+	job.Error = reason
+	job.CompletedAt = &completedAt
+	saveBulkJobProgress(jobs, job, pending)
+}
+
+// saveBulkJobProgress stores the outcomes processed since the last save, then the job's current counters
+func saveBulkJobProgress(jobs *mongo.Collection, job *models.BulkJob, pending []models.BulkJobItem) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if len(pending) > 0 {
+		items := database.GetMongoClient().Database("talentdevgo").Collection("bulk_job_items")
+		documents := make([]interface{}, len(pending))
+		for i, item := range pending {
+			documents[i] = item
+		}
+		if _, err := items.InsertMany(ctx, documents); err != nil {
+			slog.Error("Failed to save bulk job results", "job_id", job.ID.Hex(), "error", err)
+		}
+	}
+
+	job.UpdatedAt = time.Now()
+	update := bson.M{"$set": bson.M{
+		"status":       job.Status,
+		"processed":    job.Processed,
+		"succeeded":    job.Succeeded,
+		"failed":       job.Failed,
+		"skipped":      job.Skipped,
+		"updated_at":   job.UpdatedAt,
+		"completed_at": job.CompletedAt,
+		"error":        job.Error,
+	}}
+	if _, err := jobs.UpdateOne(ctx, bson.M{"_id": job.ID}, update); err != nil {
+		slog.Error("Failed to save bulk job progress", "job_id", job.ID.Hex(), "error", err)
+	}
+}
+
+// processBulkItem applies the job's action to one user, or only checks it in dry-run mode
+func processBulkItem(jobCtx context.Context, cfg *config.Config, collection *mongo.Collection, job models.BulkJob, objID primitive.ObjectID) models.BulkJobItem {
+	item := models.BulkJobItem{UserID: objID}
+
+	ctx, cancel := context.WithTimeout(jobCtx, 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		item.Status = models.BulkItemFailed
+		item.Error = "User not found"
+		return item
+	}
+	item.Email = user.Email
+
+	// Administrators cannot lock themselves out through a bulk job
+	if user.ID.Hex() == job.CreatedBy && (job.Action == models.BulkSuspend || job.Action == models.BulkDelete || job.Action == models.BulkChangeRole) {
+		item.Status = models.BulkItemSkipped
+		item.Error = "Cannot apply this action to your own account"
+		return item
+	}
+
+	// Check the action's preconditions and build the change to apply
+	var update bson.M
+	switch job.Action {
+	case models.BulkApprove:
+		if !user.EmailStatus {
+			item.Status = models.BulkItemFailed
+			item.Error = "Cannot approve user: email not verified"
+			return item
+		}
+		if user.Status == models.Approved {
+			item.Status = models.BulkItemSkipped
+			item.Error = "User already approved"
+			return item
+		}
+		update = bson.M{"$set": bson.M{"status": models.Approved, "updated_at": time.Now()}}
+	case models.BulkSuspend:
+		if user.Status == models.Suspended {
+			item.Status = models.BulkItemSkipped
+			item.Error = "User already suspended"
+			return item
+		}
+		update = bson.M{"$set": bson.M{"status": models.Suspended, "updated_at": time.Now()}}
+	case models.BulkChangeRole:
+		if user.Role == job.Role {
+			item.Status = models.BulkItemSkipped
+			item.Error = "User already has this role"
+			return item
+		}
+		update = bson.M{"$set": bson.M{"role": job.Role, "updated_at": time.Now()}}
+	case models.BulkDelete:
+		shared, err := services.OwnsSharedOrganization(ctx, objID)
+		if err != nil {
+			item.Status = models.BulkItemFailed
+			item.Error = "Failed to check organizations"
+			return item
+		}
+		if shared {
+			item.Status = models.BulkItemFailed
+			item.Error = "Transfer ownership of organizations with other members first"
+			return item
+		}
+	case models.BulkResendVerification:
+		if user.EmailStatus {
+			item.Status = models.BulkItemSkipped
+			item.Error = "Email already verified"
+			return item
+		}
+	}
+
+	if job.DryRun {
+		item.Status = models.BulkItemWouldSucceed
+		return item
+	}
+
+	// Apply the change
+	switch job.Action {
+	case models.BulkDelete:
+		// Deleting through a job ends the user's access just like a single delete
+		deleted, err := services.SoftDeleteUser(ctx, objID, job.CreatedBy)
+		if errors.Is(err, services.ErrOwnsSharedOrganization) {
+			item.Status = models.BulkItemFailed
+			item.Error = "Transfer ownership of organizations with other members first"
+			return item
+		}
+		if err != nil || !deleted {
+			item.Status = models.BulkItemFailed
+			item.Error = "Failed to delete user"
+			return item
+		}
+	case models.BulkResendVerification:
+		verificationToken := utils.GenerateVerificationToken()
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"verification_token": verificationToken, "updated_at": time.Now()}})
+		if err != nil {
+			item.Status = models.BulkItemFailed
+			item.Error = "Failed to update verification token"
+			return item
+		}
+
+		if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+			slog.Error("Failed to load merchant profile", "user_id", objID.Hex(), "error", err)
+		}
+		verificationLink := cfg.Server.BackendURL + "/api/verify?token=" + verificationToken
+		emailBody := buildVerificationEmail(user.MerchantName, verificationLink)
+		if err := libs.SendEmail(ctx, cfg.Email, []string{user.Email}, "Email registration verification - TalentDev ID", emailBody); err != nil {
+			item.Status = models.BulkItemFailed
+			item.Error = "Failed to send verification email"
+			return item
+		}
+	default:
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": objID}, update); err != nil {
+			item.Status = models.BulkItemFailed
+			item.Error = "Failed to update user"
+			return item
+		}
+
+		// Suspended users and users whose role changed must sign in again
+		if job.Action == models.BulkSuspend || job.Action == models.BulkChangeRole {
+			if _, err := services.RevokeSessions(ctx, bson.M{"user_id": objID}); err != nil {
+				item.Status = models.BulkItemFailed
+				item.Error = "Failed to revoke sessions"
+				return item
+			}
+		}
+	}
+
+	item.Status = models.BulkItemSucceeded
+	return item
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/database"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,7 +17,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// DeleteUserHandler deletes a user
+// DeleteUserHandler soft-deletes a user; the account can be restored by an administrator
+// until the retention period ends and the purger removes it permanently
 func DeleteUserHandler(c *fiber.Ctx) error {
 	// Extract the user ID from the URL parameters
 	userID := c.Params("id")
@@ -38,12 +42,12 @@ func DeleteUserHandler(c *fiber.Ctx) error {
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Create a context with a timeout for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	// Find the user before deleting (this step uses the models.User struct)
 	var user models.User
-	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
@@ -51,17 +55,23 @@ func DeleteUserHandler(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find user"})
 	}
 
-	// Delete the user by ID
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID})
+	// Mark the user as deleted and end their access
+	deleted, err := services.SoftDeleteUser(ctx, objID, authUserID)
+	if errors.Is(err, services.ErrOwnsSharedOrganization) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Transfer ownership of organizations with other members before deleting this user"})
+	}
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
 	}
 
 	// Check if a user was deleted
-	if result.DeletedCount == 0 {
+	if !deleted {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	// Record who deleted the user
+	audit.Record(newUserAuditEvent(c, "user.deleted", userID))
+
 	// Return a success message
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User deleted successfully"})
 }
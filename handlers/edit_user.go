@@ -2,18 +2,23 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
 	"myfibergotemplate/database"
 	"myfibergotemplate/libs"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
 	"myfibergotemplate/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // EditUserHandler handles editing user information
@@ -36,13 +41,122 @@ func EditUserHandler(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	update := createUpdateDocument(updateData, c)
-
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": objID}, bson.M{"$set": update})
+
+	var currentUser models.User
+	if err := collection.FindOne(c.UserContext(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&currentUser); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	// Third-party applications cannot change sign-in credentials
+	if _, ok := c.Locals("oauthClientID").(string); ok && (updateData.Password != "" || (updateData.Email != "" && updateData.Email != currentUser.Email)) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Applications cannot change the email or password"})
+	}
+
+	// Nor can administrators impersonating the user, or the user's API keys
+	_, impersonating := c.Locals("impersonatorID").(string)
+	_, apiKey := c.Locals("apiKeyID").(string)
+	if (impersonating || apiKey) && (updateData.Password != "" || (updateData.Email != "" && updateData.Email != currentUser.Email)) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "The email and password can only be changed by the user"})
+	}
+
+	// Store the phone number in E.164 form so it can be verified by SMS
+	if updateData.PhoneNumber != "" {
+		phone, err := utils.NormalizePhoneNumber(updateData.PhoneNumber, config.FromContext(c).SMS.DefaultCountryCode)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid phone number; include the country code, e.g. +60123456789"})
+		}
+		updateData.PhoneNumber = phone
+	}
+
+	// The merchant profile is held by the organization the user owns
+	profile := bson.M{}
+	if updateData.MerchantName != "" {
+		profile["merchant_name"] = updateData.MerchantName
+	}
+	if updateData.Website != "" {
+		profile["website"] = updateData.Website
+	}
+	if updateData.Address != "" {
+		profile["address"] = updateData.Address
+	}
+	var org *models.Organization
+	if len(profile) > 0 {
+		org, err = services.OwnedOrganization(c.UserContext(), objID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "The merchant name, website and address belong to an organization, and this user owns none"})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve organization"})
+		}
+	}
+
+	// Greet the user by the merchant name they keep, or the one they are changing to
+	loadMerchantProfile(c.UserContext(), c, &currentUser)
+	merchantName := currentUser.MerchantName
+	if updateData.MerchantName != "" {
+		merchantName = updateData.MerchantName
+	}
+
+	update := createUpdateDocument(updateData, merchantName, c)
+
+	// A new phone number has to be verified again before it can receive sign-in codes
+	if phone, ok := update["phone_number"]; ok && phone != currentUser.PhoneNumber {
+		update["phone_verified"] = false
+		update["sms_code_required"] = false
+	}
+
+	result, err := collection.UpdateOne(c.UserContext(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}, bson.M{"$set": update})
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user"})
 	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	// A new password signs the user out everywhere else; users changing their own keep the current session
+	var revoked int64
+	if _, ok := update["password"]; ok {
+		filter := bson.M{"user_id": objID}
+		if current, ok := c.Locals("sessionID").(string); ok && authUserID == userID {
+			currentID, _ := primitive.ObjectIDFromHex(current)
+			filter["_id"] = bson.M{"$ne": currentID}
+		}
+		if revoked, err = services.RevokeSessions(c.UserContext(), filter); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Password changed, but failed to sign out other sessions"})
+		}
+	}
+
+	if org != nil {
+		event := newOrganizationAuditEvent(c, "organization.updated", org.ID.Hex())
+		event.Changes = audit.Diff(map[string]interface{}{
+			"merchant_name": org.MerchantName,
+			"website":       org.Website,
+			"address":       org.Address,
+		}, profile)
+		if err := services.UpdateOrganization(c.UserContext(), org.ID, profile); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update organization"})
+		}
+		delete(event.Changes, "updated_at")
+		audit.Record(event)
+	}
+
+	// Record what changed and who changed it
+	before := userProfileData(currentUser)
+	before["password"] = currentUser.Password
+	before["verification_token"] = currentUser.VerificationToken
+	event := newUserAuditEvent(c, "user.updated", userID)
+	event.Changes = audit.Diff(before, update)
+	delete(event.Changes, "updated_at")
+	if revoked > 0 {
+		event.Metadata = map[string]string{"sessions_revoked": strconv.FormatInt(revoked, 10)}
+	}
+	audit.Record(event)
+
+	// Record acceptance of the terms version in effect, unless the user already accepted it
+	if updateData.TermsAndConditions {
+		acceptCurrentTerms(c, currentUser, "profile_update")
+	}
 
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User updated successfully"})
 }
@@ -51,7 +165,8 @@ func isAuthorizedToEdit(role, authUserID, userID string) bool {
 	return role == "administrator" || authUserID == userID
 }
 
-func createUpdateDocument(updateData models.User, c *fiber.Ctx) bson.M {
+// createUpdateDocument returns the changes to the user's account; merchantName greets them in a verification email
+func createUpdateDocument(updateData models.User, merchantName string, c *fiber.Ctx) bson.M {
 	update := bson.M{}
 
 	// Ensure the userEmail is present in the locals before trying to use it
@@ -60,42 +175,33 @@ func createUpdateDocument(updateData models.User, c *fiber.Ctx) bson.M {
 		update["email_status"] = false
 		verificationToken := utils.GenerateVerificationToken()
 		update["verification_token"] = verificationToken
-		sendVerificationEmail(updateData.MerchantName, updateData.Email, verificationToken)
+		sendVerificationEmail(c.UserContext(), config.FromContext(c), merchantName, updateData.Email, verificationToken)
 	}
 
 	// Handle other fields
-	if updateData.MerchantName != "" {
-		update["merchant_name"] = updateData.MerchantName
-	}
 	if updateData.PersonInCharge != "" {
 		update["person_in_charge"] = updateData.PersonInCharge
 	}
 	if updateData.PhoneNumber != "" {
 		update["phone_number"] = updateData.PhoneNumber
 	}
-	if updateData.Website != "" {
-		update["website"] = updateData.Website
-	}
-	if updateData.Address != "" {
-		update["address"] = updateData.Address
-	}
 	if updateData.TermsAndConditions {
 		update["terms_and_conditions"] = updateData.TermsAndConditions
 	}
 	if updateData.Password != "" {
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(updateData.Password), bcrypt.DefaultCost)
-		update["password"] = string(hashedPassword)
+		hashedPassword, _ := utils.HashPassword(c.UserContext(), updateData.Password)
+		update["password"] = hashedPassword
 	}
 
 	update["updated_at"] = time.Now()
 	return update
 }
 
-func sendVerificationEmail(merchantName, email, token string) {
-	verificationLink := "http://localhost:8080/api/verify-email?token=" + token
+func sendVerificationEmail(ctx context.Context, cfg *config.Config, merchantName, email, token string) {
+	verificationLink := cfg.Server.BackendURL + "/api/verify?token=" + token
 	emailBody := `<p>Dear ` + merchantName + `,</p>
 				  <p>You have requested to change your email address. Please verify your new email by clicking the link below:</p>
 				  <p><a href="` + verificationLink + `">Verify Email Address</a></p>
 				  <p>Kind regards,<br>The TalentDev Team</p>`
-	libs.SendEmail([]string{email}, "Email Verification - TalentDev ID", emailBody)
+	libs.QueueEmail(ctx, cfg.Email, []string{email}, "Email Verification - TalentDev ID", emailBody)
 }
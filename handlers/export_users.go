@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// userExportColumns lists the exported fields in order; secrets such as passwords and tokens are never exported
+var userExportColumns = []string{
+	"id", "merchant_name", "email", "email_status", "status", "role", "person_in_charge",
+	"phone_number", "website", "address", "terms_and_conditions", "created_at", "updated_at",
+}
+
+// exportBatchSize is how many users are read before their merchant profiles are looked up and written
+const exportBatchSize = 200
+
+// ExportUsersHandler streams the users matching the list filters as CSV or NDJSON
+func ExportUsersHandler(c *fiber.Ctx) error {
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported format, expected csv or ndjson"})
+	}
+
+	// Apply the same filters as the user list endpoint
+	filter, err := parseUserFilterQuery(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	query, err := buildUserFilter(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resolve filter"})
+	}
+
+	event := audit.NewEvent(c, "users.exported")
+	event.Metadata = map[string]string{"format": format, "query": c.Context().QueryArgs().String()}
+	audit.Record(event)
+
+	filename := "users-" + time.Now().Format("20060102-150405") + "." + format
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	log := logger.FromContext(c)
+	parentCtx := c.UserContext()
+
+	// Stream the documents as they are read so large exports are never held in memory
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+		ctx, cancel := context.WithTimeout(parentCtx, 10*time.Minute)
+		defer cancel()
+
+		cursor, err := collection.Find(ctx, query)
+		if err != nil {
+			log.Error("Failed to export users", "error", err)
+			return
+		}
+		defer cursor.Close(ctx)
+
+		csvWriter := csv.NewWriter(w)
+		if format == "csv" {
+			csvWriter.Write(userExportColumns)
+		}
+
+		// Write the users in batches, adding the merchant profiles their organizations hold
+		writeBatch := func(users []models.User) bool {
+			if err := services.LoadMerchantProfiles(ctx, users); err != nil {
+				log.Error("Failed to load merchant profiles during export", "error", err)
+				return false
+			}
+			for _, user := range users {
+				row := userExportRow(user)
+				if format == "csv" {
+					for i := range row {
+						row[i] = escapeSpreadsheetCell(row[i])
+					}
+					csvWriter.Write(row)
+					csvWriter.Flush()
+				} else {
+					record := make(map[string]interface{}, len(userExportColumns))
+					for i, column := range userExportColumns {
+						record[column] = row[i]
+					}
+					record["email_status"] = user.EmailStatus
+					record["terms_and_conditions"] = user.TermsAndConditions
+					line, _ := json.Marshal(record)
+					w.Write(append(line, '\n'))
+				}
+			}
+			// An error means the client went away; stop reading from the database
+			return w.Flush() == nil
+		}
+
+		batch := make([]models.User, 0, exportBatchSize)
+		for cursor.Next(ctx) {
+			var user models.User
+			if err := cursor.Decode(&user); err != nil {
+				log.Error("Failed to decode user during export", "error", err)
+				return
+			}
+			batch = append(batch, user)
+			if len(batch) == exportBatchSize {
+				if !writeBatch(batch) {
+					return
+				}
+				batch = batch[:0]
+			}
+		}
+		if len(batch) > 0 && !writeBatch(batch) {
+			return
+		}
+
+		if err := cursor.Err(); err != nil {
+			log.Error("Cursor iteration error during export", "error", err)
+		}
+	})
+
+	return nil
+}
+
+// userExportRow returns the exported values of a user in the order of userExportColumns
+func userExportRow(user models.User) []string {
+	return []string{
+		user.ID.Hex(),
+		user.MerchantName,
+		user.Email,
+		strconv.FormatBool(user.EmailStatus),
+		string(user.Status),
+		string(user.Role),
+		user.PersonInCharge,
+		user.PhoneNumber,
+		user.Website,
+		user.Address,
+		strconv.FormatBool(user.TermsAndConditions),
+		user.CreatedAt.UTC().Format(time.RFC3339),
+		user.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// escapeSpreadsheetCell prevents cell values from being interpreted as formulas by spreadsheet applications
+func escapeSpreadsheetCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
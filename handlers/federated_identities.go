@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/federation"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LinkFederatedIdentityHandler starts linking an external provider account to the signed-in user.
+// It returns the provider URL for the frontend to open, as a browser redirect cannot carry the session token.
+func LinkFederatedIdentityHandler(c *fiber.Ctx) error {
+	provider, ok := federation.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	authURL, err := services.StartFederatedLogin(ctx, provider, federatedRedirectURI(c, provider), models.FederatedLoginState{Purpose: models.FederatedLink, UserID: &userID})
+	if err != nil {
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "Identity provider is unavailable"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"authorization_url": authURL})
+}
+
+// ListFederatedIdentitiesHandler lists the provider accounts linked to the signed-in user
+func ListFederatedIdentitiesHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	identities, err := services.FederatedIdentitiesForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve linked accounts"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"identities": identities})
+}
+
+// UnlinkFederatedIdentityHandler removes a linked provider account, unless it is the user's only way to sign in
+func UnlinkFederatedIdentityHandler(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	identities, err := services.FederatedIdentitiesForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve linked accounts"})
+	}
+
+	var identity *models.FederatedIdentity
+	for i := range identities {
+		if identities[i].Provider == provider {
+			identity = &identities[i]
+		}
+	}
+	if identity == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No linked account for this provider"})
+	}
+
+	// Accounts created through a provider have no password until the user sets one
+	var user models.User
+	users := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if err := users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.Password == "" && len(identities) == 1 {
+		credentials, err := services.WebAuthnCredentialsForUser(ctx, userID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve passkeys"})
+		}
+		if len(credentials) == 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Set a password before unlinking your last sign-in method"})
+		}
+	}
+
+	if err := services.UnlinkFederatedIdentities(ctx, bson.M{"_id": identity.ID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlink account"})
+	}
+
+	event := newUserAuditEvent(c, "user.federated_identity_unlinked", userID.Hex())
+	event.Metadata = map[string]string{"provider": identity.Provider, "subject": identity.Subject}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Account unlinked successfully"})
+}
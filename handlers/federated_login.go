@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/federation"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/metrics"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Reasons a federated login is turned away, sent to the frontend as the error parameter
+var (
+	errFederatedEmailMissing  = errors.New("email_required")
+	errFederatedAccountExists = errors.New("account_exists")
+	errFederatedAccountGone   = errors.New("account_deleted")
+)
+
+// federatedLoginErrors are the reasons for turning a login away that the frontend can explain to the user
+var federatedLoginErrors = []error{
+	errFederatedEmailMissing, errFederatedAccountExists, errFederatedAccountGone,
+	errInvitationInvalid, errInvitationAccountExists, errInvitationNotMerchant, errInvitationEmailMismatch,
+}
+
+// ListFederatedProvidersHandler lists the external identity providers users can sign in with
+func ListFederatedProvidersHandler(c *fiber.Ctx) error {
+	providers := []fiber.Map{}
+	for _, provider := range federation.Providers() {
+		providers = append(providers, fiber.Map{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+			"login_url":    config.FromContext(c).Server.BackendURL + "/auth/federated/" + provider.Name + "/start",
+		})
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"providers": providers})
+}
+
+// FederatedStartHandler sends the browser to an external identity provider to sign in
+func FederatedStartHandler(c *fiber.Ctx) error {
+	provider, ok := federation.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	// A login started from an invitation accepts it
+	login := models.FederatedLoginState{Purpose: models.FederatedLogin}
+	if token := c.Query("invitation"); token != "" {
+		invitation, err := services.FindPendingInvitation(ctx, token)
+		if err != nil {
+			return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {errInvitationInvalid.Error()}})
+		}
+		login.Purpose = models.FederatedInvitation
+		login.InvitationID = &invitation.ID
+	}
+
+	authURL, err := services.StartFederatedLogin(ctx, provider, federatedRedirectURI(c, provider), login)
+	if err != nil {
+		logger.FromContext(c).Error("Failed to start federated login", "provider", provider.Name, "error", err)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"provider_unavailable"}})
+	}
+
+	return c.Redirect(authURL, http.StatusFound)
+}
+
+// FederatedCallbackHandler completes a login at an external identity provider. Sign-ins are handed to the
+// frontend as a single-use code; account links go straight back to the account settings page.
+func FederatedCallbackHandler(c *fiber.Ctx) error {
+	provider, ok := federation.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	// The state proves this browser started the login
+	login, err := services.ConsumeFederatedLoginState(ctx, provider.Name, c.Query("state"))
+	if err != nil {
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"invalid_state"}})
+	}
+
+	// The user cancelled or the provider refused
+	if providerError := c.Query("error"); providerError != "" {
+		return federatedRedirect(c, login.Purpose, url.Values{"error": {"access_denied"}, "provider": {provider.Name}})
+	}
+
+	identity, err := provider.Exchange(ctx, federatedRedirectURI(c, provider), c.Query("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		logger.FromContext(c).Warn("Federated login failed", "provider", provider.Name, "error", err)
+		return federatedRedirect(c, login.Purpose, url.Values{"error": {"provider_error"}, "provider": {provider.Name}})
+	}
+
+	if login.Purpose == models.FederatedLink && login.UserID != nil {
+		return completeFederatedLink(ctx, c, *login.UserID, identity)
+	}
+
+	var user *models.User
+	if login.Purpose == models.FederatedInvitation && login.InvitationID != nil {
+		user, err = acceptFederatedInvitation(ctx, c, *login.InvitationID, identity)
+	} else {
+		user, err = resolveFederatedUser(ctx, c, identity)
+	}
+	if err != nil {
+		code := err.Error()
+		if !slices.ContainsFunc(federatedLoginErrors, func(target error) bool { return errors.Is(err, target) }) {
+			logger.FromContext(c).Error("Failed to complete federated login", "provider", provider.Name, "error", err)
+			code = "server_error"
+		}
+		recordSignIn(c, nil, identity.Email, "federated:"+provider.Name, code)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {code}, "provider": {provider.Name}})
+	}
+
+	loginCode, err := services.NewFederatedLoginCode(ctx, user.ID, provider.Name)
+	if err != nil {
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"server_error"}})
+	}
+	return federatedRedirect(c, models.FederatedLogin, url.Values{"code": {loginCode}, "provider": {provider.Name}})
+}
+
+// FederatedExchangeHandler trades the code from a federated login for a session token,
+// applying the same checks as a password sign-in
+func FederatedExchangeHandler(c *fiber.Ctx) error {
+	type ExchangeRequest struct {
+		Code               string `json:"code"`
+		AcceptTermsVersion string `json:"accept_terms_version"`
+	}
+
+	var req ExchangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	loginCode, err := services.FindFederatedLoginCode(ctx, req.Code)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired login code"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": loginCode.UserID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired login code"})
+	}
+
+	// The code stays valid while the user is asked to accept new terms, and is spent only on success
+	method := "federated:" + loginCode.Provider
+	if blocked, err := signInBlocked(ctx, c, user, user.Email, method, req.AcceptTermsVersion); blocked {
+		return err
+	}
+	if used, err := services.UseFederatedLoginCode(ctx, loginCode.ID); err != nil || !used {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired login code"})
+	}
+
+	return signInResponse(c, user, user.Email, method)
+}
+
+// resolveFederatedUser finds the user a provider account belongs to. Unknown accounts are linked to the
+// merchant with the same verified email, or become a new merchant account awaiting approval.
+func resolveFederatedUser(ctx context.Context, c *fiber.Ctx, identity *federation.Identity) (*models.User, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// A returning user
+	linked, err := services.FindFederatedIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err == nil {
+		var user models.User
+		err := collection.FindOne(ctx, bson.M{"_id": linked.UserID}).Decode(&user)
+		switch {
+		case err == mongo.ErrNoDocuments || (err == nil && user.DeletedAt != nil):
+			return nil, errFederatedAccountGone
+		case err != nil:
+			return nil, err
+		}
+		if err := services.TouchFederatedIdentity(ctx, linked.ID, identity.Email); err != nil {
+			return nil, err
+		}
+		if err := syncFederatedProfile(ctx, &user, federatedProfile(c, identity)); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+
+	if identity.Email == "" {
+		return nil, errFederatedEmailMissing
+	}
+
+	// An existing user is only linked when the provider vouches for the email address
+	var user models.User
+	err = collection.FindOne(ctx, bson.M{"email": identity.Email}).Decode(&user)
+	if err == nil {
+		if user.DeletedAt != nil {
+			return nil, errFederatedAccountGone
+		}
+		if !identity.EmailVerified {
+			return nil, errFederatedAccountExists
+		}
+		// Administrators link providers themselves while signed in, so a provider that wrongly
+		// vouches for an address cannot take over their account
+		if user.Role == models.Administrator {
+			return nil, errFederatedAccountExists
+		}
+		// The user may already have linked another account at this provider
+		if err := services.LinkFederatedIdentity(ctx, user.ID, identity); errors.Is(err, services.ErrIdentityLinked) {
+			return nil, errFederatedAccountExists
+		} else if err != nil {
+			return nil, err
+		}
+
+		// The provider has just proven the user owns the address
+		if !user.EmailStatus {
+			update := bson.M{"$set": bson.M{"email_status": true, "updated_at": time.Now()}, "$unset": bson.M{"verification_token": ""}}
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+				return nil, err
+			}
+			user.EmailStatus = true
+		}
+
+		recordFederatedLink(c, user.ID, identity, "email")
+		if err := syncFederatedProfile(ctx, &user, federatedProfile(c, identity)); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	return createFederatedUser(ctx, c, identity)
+}
+
+// acceptFederatedInvitation accepts an invitation with a provider account, which must have a verified
+// email matching the invitation. The invitee's account is created with the provider linked, or the
+// provider is linked to their existing account.
+func acceptFederatedInvitation(ctx context.Context, c *fiber.Ctx, invitationID primitive.ObjectID, identity *federation.Identity) (*models.User, error) {
+	invitation, err := services.FindPendingInvitationByID(ctx, invitationID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if identity.Email == "" {
+		return nil, errFederatedEmailMissing
+	}
+	if !identity.EmailVerified || !strings.EqualFold(identity.Email, invitation.Email) {
+		return nil, errInvitationEmailMismatch
+	}
+
+	existing, err := findInvitedUser(ctx, invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Link the provider to the existing account through the usual sign-in path
+	if existing != nil {
+		user, err := resolveFederatedUser(ctx, c, identity)
+		if err != nil {
+			return nil, err
+		}
+		if user.ID != existing.ID {
+			return nil, errFederatedAccountExists
+		}
+		if err := redeemInvitation(ctx, c, invitation, user, false, "federated:"+identity.Provider); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// The provider account may already belong to somebody else
+	if _, err := services.FindFederatedIdentity(ctx, identity.Provider, identity.Subject); err == nil {
+		return nil, errFederatedAccountExists
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	user := invitedUser(invitation, identity.Name)
+	if err := redeemInvitation(ctx, c, invitation, &user, true, "federated:"+identity.Provider); err != nil {
+		return nil, err
+	}
+	if err := services.LinkFederatedIdentity(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	recordFederatedLink(c, user.ID, identity, "invitation")
+	return &user, nil
+}
+
+// createFederatedUser creates a pending merchant account for a new provider account
+func createFederatedUser(ctx context.Context, c *fiber.Ctx, identity *federation.Identity) (*models.User, error) {
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	user := models.User{
+		ID:             primitive.NewObjectID(),
+		MerchantName:   name,
+		Status:         models.Pending,
+		Email:          identity.Email,
+		EmailStatus:    identity.EmailVerified,
+		Role:           models.Merchant,
+		PersonInCharge: name,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if !identity.EmailVerified {
+		user.VerificationToken = utils.GenerateVerificationToken()
+	}
+	applyFederatedProfile(&user, federatedProfile(c, identity))
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.InsertOne(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := services.LinkFederatedIdentity(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	if err := services.CreateMerchantOrganization(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Record the signup
+	metrics.Signups.Inc()
+	event := newUserAuditEvent(c, "user.signup", user.ID.Hex())
+	event.ActorID = user.ID.Hex()
+	event.Metadata = map[string]string{"provider": identity.Provider}
+	audit.Record(event)
+
+	// Ask the user to verify an address the provider does not vouch for
+	if user.VerificationToken != "" {
+		cfg := config.FromContext(c)
+		verificationLink := cfg.Server.BackendURL + "/api/verify?token=" + user.VerificationToken
+		err := libs.QueueEmail(ctx, cfg.Email, []string{user.Email}, "Email registration verification - TalentDev ID", buildVerificationEmail(user.MerchantName, verificationLink))
+		if err != nil {
+			logger.FromContext(c).Error("Failed to queue verification email", "user_id", user.ID.Hex(), "email", user.Email, "error", err)
+		}
+	}
+
+	return &user, nil
+}
+
+// federatedProfileFields are the user fields an identity provider may fill in
+var federatedProfileFields = []string{"person_in_charge", "merchant_name", "phone_number", "website", "address"}
+
+// federatedProfile returns the profile fields the provider asserts, e.g. as SAML attributes. Phone numbers
+// are stored in E.164 form like those users enter; one that cannot be read is left out.
+func federatedProfile(c *fiber.Ctx, identity *federation.Identity) map[string]string {
+	profile := make(map[string]string)
+	for field, value := range identity.Attributes {
+		if !slices.Contains(federatedProfileFields, field) {
+			continue
+		}
+		if field == "phone_number" && value != "" {
+			phone, err := utils.NormalizePhoneNumber(value, config.FromContext(c).SMS.DefaultCountryCode)
+			if err != nil {
+				continue
+			}
+			value = phone
+		}
+		profile[field] = value
+	}
+	return profile
+}
+
+// syncFederatedProfile updates the user's profile with the fields the provider asserts
+func syncFederatedProfile(ctx context.Context, user *models.User, profile map[string]string) error {
+	if len(profile) == 0 {
+		return nil
+	}
+
+	// The merchant profile is held by the organization the user owns; members of somebody else's keep theirs
+	update := bson.M{"updated_at": time.Now()}
+	merchantProfile := bson.M{}
+	for field, value := range profile {
+		if slices.Contains(services.MerchantProfileFields, field) {
+			merchantProfile[field] = value
+		} else {
+			update[field] = value
+		}
+	}
+	if len(merchantProfile) > 0 {
+		org, err := services.OwnedOrganization(ctx, user.ID)
+		if err == nil {
+			err = services.UpdateOrganization(ctx, org.ID, merchantProfile)
+		}
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+
+	// A new phone number has to be verified again before it can receive sign-in codes
+	phone, ok := profile["phone_number"]
+	phoneChanged := ok && phone != user.PhoneNumber
+	if phoneChanged {
+		update["phone_verified"] = false
+		update["sms_code_required"] = false
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": update}); err != nil {
+		return err
+	}
+	if phoneChanged {
+		user.PhoneVerified = false
+		user.SMSCodeRequired = false
+	}
+	applyFederatedProfile(user, profile)
+	return nil
+}
+
+// applyFederatedProfile copies the asserted profile fields onto user
+func applyFederatedProfile(user *models.User, profile map[string]string) {
+	for field, value := range profile {
+		switch field {
+		case "person_in_charge":
+			user.PersonInCharge = value
+		case "merchant_name":
+			user.MerchantName = value
+		case "phone_number":
+			user.PhoneNumber = value
+		case "website":
+			user.Website = value
+		case "address":
+			user.Address = value
+		}
+	}
+}
+
+// completeFederatedLink links a provider account to the user who started the link
+func completeFederatedLink(ctx context.Context, c *fiber.Ctx, userID primitive.ObjectID, identity *federation.Identity) error {
+	params := url.Values{"provider": {identity.Provider}}
+
+	existing, err := services.FindFederatedIdentity(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil && existing.UserID == userID:
+		params.Set("linked", "true")
+	case err == nil:
+		params.Set("error", "already_linked")
+	case err != mongo.ErrNoDocuments:
+		params.Set("error", "server_error")
+	default:
+		if err := services.LinkFederatedIdentity(ctx, userID, identity); errors.Is(err, services.ErrIdentityLinked) {
+			params.Set("error", "already_linked")
+		} else if err != nil {
+			params.Set("error", "server_error")
+		} else {
+			recordFederatedLink(c, userID, identity, "user")
+			params.Set("linked", "true")
+		}
+	}
+
+	return federatedRedirect(c, models.FederatedLink, params)
+}
+
+// recordFederatedLink audits a provider account being linked to a user
+func recordFederatedLink(c *fiber.Ctx, userID primitive.ObjectID, identity *federation.Identity, linkedBy string) {
+	event := newUserAuditEvent(c, "user.federated_identity_linked", userID.Hex())
+	event.ActorID = userID.Hex()
+	event.Metadata = map[string]string{"provider": identity.Provider, "subject": identity.Subject, "linked_by": linkedBy}
+	audit.Record(event)
+}
+
+// federatedRedirectURI is the callback registered with the identity provider
+func federatedRedirectURI(c *fiber.Ctx, provider *federation.Provider) string {
+	return config.FromContext(c).Server.BackendURL + "/auth/federated/" + provider.Name + "/callback"
+}
+
+// federatedRedirect sends the browser back to the frontend page for the login's purpose
+func federatedRedirect(c *fiber.Ctx, purpose string, params url.Values) error {
+	destination := config.FromContext(c).Server.FrontendURL + "/auth/federated/callback"
+	if purpose == models.FederatedLink {
+		destination = config.FromContext(c).Server.FrontendURL + "/account/linked-accounts"
+	}
+	return c.Redirect(destination+"?"+params.Encode(), http.StatusFound)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/database/databasetest"
+	"myfibergotemplate/federation"
+	"myfibergotemplate/federation/federationtest"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newFederatedTestApp serves the federated login routes with a local identity provider registered as "mock"
+func newFederatedTestApp(t *testing.T) (*fiber.App, *federationtest.IdentityProvider) {
+	t.Helper()
+	databasetest.Connect(t)
+
+	idp := federationtest.NewIdentityProvider(t)
+	federation.Init(config.FederationConfig{Providers: []config.IdentityProviderConfig{{
+		Name:         "mock",
+		Type:         config.ProviderOIDC,
+		DisplayName:  "Mock",
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}}})
+
+	cfg := config.Default()
+	cfg.Server.BackendURL = "https://api.example.com"
+	cfg.Server.FrontendURL = "https://app.example.com"
+
+	app := fiber.New()
+	app.Use(config.Middleware(cfg))
+	app.Get("/auth/federated/:provider/start", FederatedStartHandler)
+	app.Get("/auth/federated/:provider/callback", FederatedCallbackHandler)
+	return app, idp
+}
+
+// redirectLocation makes a request to app and returns where it redirects the browser
+func redirectLocation(t *testing.T, app *fiber.App, target string) *url.URL {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s returned %s, want a redirect", target, resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// startFederatedLogin signs in at the identity provider and returns the callback request it sends the browser back with
+func startFederatedLogin(t *testing.T, app *fiber.App) string {
+	t.Helper()
+
+	authURL := redirectLocation(t, app, "/auth/federated/mock/start")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Path != "/auth/federated/mock/callback" {
+		t.Fatalf("identity provider redirected to %s", callback)
+	}
+	return callback.RequestURI()
+}
+
+// federatedLogin runs a whole login and returns the parameters the frontend receives
+func federatedLogin(t *testing.T, app *fiber.App) url.Values {
+	t.Helper()
+
+	result := redirectLocation(t, app, startFederatedLogin(t, app))
+	if result.Host != "app.example.com" || result.Path != "/auth/federated/callback" {
+		t.Fatalf("login finished at %s, want the frontend callback page", result)
+	}
+	return result.Query()
+}
+
+// federatedTestSubject returns the provider's ID for a new test account, unlinking it when the test ends
+func federatedTestSubject(t *testing.T) string {
+	subject := primitive.NewObjectID().Hex()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		services.UnlinkFederatedIdentities(ctx, bson.M{"provider": "mock", "subject": subject})
+	})
+	return subject
+}
+
+func TestFederatedLoginCreatesAccount(t *testing.T) {
+	app, idp := newFederatedTestApp(t)
+	email := primitive.NewObjectID().Hex() + "@example.com"
+	idp.User = jwt.MapClaims{"sub": federatedTestSubject(t), "email": email, "email_verified": true, "name": "New Merchant"}
+
+	result := federatedLogin(t, app)
+	if result.Get("code") == "" {
+		t.Fatalf("login failed with %q", result.Get("error"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { purgeTestUser(t, user.ID) })
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Role != models.Merchant || user.Status != models.Pending || !user.EmailStatus || user.MerchantName != "New Merchant" {
+		t.Errorf("created %+v, want a pending merchant with a verified email", user)
+	}
+	identity, err := services.FindFederatedIdentity(ctx, "mock", idp.User["sub"].(string))
+	if err != nil || identity.UserID != user.ID {
+		t.Errorf("provider account not linked to the new user: %v", err)
+	}
+}
+
+func TestFederatedLoginLinksVerifiedEmail(t *testing.T) {
+	app, idp := newFederatedTestApp(t)
+	user := newTestUser(t, models.Merchant)
+	idp.User = jwt.MapClaims{"sub": federatedTestSubject(t), "email": user.Email, "email_verified": true}
+
+	result := federatedLogin(t, app)
+	if result.Get("code") == "" {
+		t.Fatalf("login failed with %q", result.Get("error"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	identity, err := services.FindFederatedIdentity(ctx, "mock", idp.User["sub"].(string))
+	if err != nil || identity.UserID != user.ID {
+		t.Errorf("provider account not linked to the existing user: %v", err)
+	}
+}
+
+func TestFederatedLoginDoesNotLink(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          models.Role
+		emailVerified bool
+	}{
+		{"unverified email", models.Merchant, false},
+		{"administrator", models.Administrator, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, idp := newFederatedTestApp(t)
+			user := newTestUser(t, tt.role)
+			idp.User = jwt.MapClaims{"sub": federatedTestSubject(t), "email": user.Email, "email_verified": tt.emailVerified}
+
+			result := federatedLogin(t, app)
+			if result.Get("code") != "" || result.Get("error") != "account_exists" {
+				t.Errorf("login finished with %v, want error account_exists", result)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if _, err := services.FindFederatedIdentity(ctx, "mock", idp.User["sub"].(string)); err != mongo.ErrNoDocuments {
+				t.Errorf("provider account was linked: %v", err)
+			}
+		})
+	}
+}
+
+func TestFederatedLoginChecksState(t *testing.T) {
+	app, idp := newFederatedTestApp(t)
+	user := newTestUser(t, models.Merchant)
+	idp.User = jwt.MapClaims{"sub": federatedTestSubject(t), "email": user.Email, "email_verified": true}
+
+	// A state this server never issued
+	callback, err := url.Parse(startFederatedLogin(t, app))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := callback.Query()
+	query.Set("state", "forged")
+	callback.RawQuery = query.Encode()
+	if result := redirectLocation(t, app, callback.RequestURI()).Query(); result.Get("error") != "invalid_state" {
+		t.Errorf("forged state finished with %v, want error invalid_state", result)
+	}
+
+	// A state that has already been used
+	callbackURI := startFederatedLogin(t, app)
+	if result := redirectLocation(t, app, callbackURI).Query(); result.Get("code") == "" {
+		t.Fatalf("login failed with %q", result.Get("error"))
+	}
+	if result := redirectLocation(t, app, callbackURI).Query(); result.Get("error") != "invalid_state" {
+		t.Errorf("replayed state finished with %v, want error invalid_state", result)
+	}
+}
+
+func TestFederatedLoginChecksNonce(t *testing.T) {
+	app, idp := newFederatedTestApp(t)
+	user := newTestUser(t, models.Merchant)
+	idp.User = jwt.MapClaims{"sub": federatedTestSubject(t), "email": user.Email, "email_verified": true}
+	idp.ModifyClaims = func(claims jwt.MapClaims) { claims["nonce"] = "from-another-login" }
+
+	if result := federatedLogin(t, app); result.Get("error") != "provider_error" {
+		t.Errorf("login finished with %v, want error provider_error", result)
+	}
+}
@@ -5,15 +5,20 @@ import (
 	"crypto/rand"
 	"math/big"
 	"net/http"
+	"strconv"
 	"time"
 
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
 	"myfibergotemplate/database"
 	"myfibergotemplate/libs"
+	"myfibergotemplate/metrics"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var failedAttemptsCache = make(map[string]int)       // Cache to track failed password reset attempts
@@ -39,6 +44,7 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 	// Rate limiting for password reset requests
 	if lockoutTime, exists := lockedAccountsCache[email]; exists {
 		if time.Until(lockoutTime) > 0 {
+			metrics.PasswordResets.WithLabelValues("locked").Inc()
 			remainingTime := time.Until(lockoutTime).Minutes()
 			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
 				"error":       "Too many failed attempts, please try again later",
@@ -53,23 +59,25 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 	// Get a reference to the "users" collection in the MongoDB database
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	var user models.User
 
 	// Find the user by email
-	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := collection.FindOne(ctx, bson.M{"email": email, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
 	if err != nil {
 		// Increment the failed attempts counter
 		failedAttemptsCache[email]++
 		if failedAttemptsCache[email] >= maxFailedAttempts {
 			lockedAccountsCache[email] = time.Now().Add(lockoutDuration)
+			metrics.Lockouts.WithLabelValues("forgot_password").Inc()
 			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
 				"error":       "Too many failed attempts, please try again later",
 				"retry_after": int(lockoutDuration.Minutes()),
 			})
 		}
+		metrics.PasswordResets.WithLabelValues("not_found").Inc()
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
@@ -79,11 +87,13 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 		failedAttemptsCache[email]++
 		if failedAttemptsCache[email] >= maxFailedAttempts {
 			lockedAccountsCache[email] = time.Now().Add(lockoutDuration)
+			metrics.Lockouts.WithLabelValues("forgot_password").Inc()
 			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
 				"error":       "Too many failed attempts, please try again later",
 				"retry_after": int(lockoutDuration.Minutes()),
 			})
 		}
+		metrics.PasswordResets.WithLabelValues("not_eligible").Inc()
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "User is not approved or email is not verified"})
 	}
 
@@ -91,19 +101,26 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 	newPassword := generateSecurePassword(8)
 
 	// Hash the new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(ctx, newPassword)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate password"})
 	}
 
 	// Update the user's password in the database
-	update := bson.M{"$set": bson.M{"password": string(hashedPassword)}}
-	_, err = collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	update := bson.M{"$set": bson.M{"password": hashedPassword}}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
 	}
 
+	// Whoever was signed in with the old password is signed out
+	revoked, err := services.RevokeSessions(ctx, bson.M{"user_id": user.ID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign out existing sessions"})
+	}
+
 	// Compose the email subject and body
+	loadMerchantProfile(ctx, c, &user)
 	emailSubject := "Forgot password - TalentDev ID"
 	emailBody := `<p>Dear ` + user.MerchantName + `,</p>
 				  <p>You requested a new password on TalentDev!</p>
@@ -111,11 +128,18 @@ func ForgotPasswordHandler(c *fiber.Ctx) error {
 				  <p>Kind regards,<br>The TalentDev Team</p>`
 
 	// Send the new password to the user's email
-	err = libs.SendEmail([]string{user.Email}, emailSubject, emailBody)
+	err = libs.SendEmail(ctx, config.FromContext(c).Email, []string{user.Email}, emailSubject, emailBody)
 	if err != nil {
+		metrics.PasswordResets.WithLabelValues("email_failed").Inc()
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send email"})
 	}
 
+	// Record the password reset
+	metrics.PasswordResets.WithLabelValues("success").Inc()
+	event := newUserAuditEvent(c, "auth.password_reset", user.ID.Hex())
+	event.Metadata = map[string]string{"sessions_revoked": strconv.FormatInt(revoked, 10)}
+	audit.Record(event)
+
 	// Return a success message
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "A new password has been sent to your email"})
 }
@@ -7,25 +7,36 @@ import (
 
 	"myfibergotemplate/database"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
-// GetAllUsersHandler retrieves all users from the database
+// GetAllUsersHandler retrieves all users from the database, optionally narrowed by query filters
 func GetAllUsersHandler(c *fiber.Ctx) error {
+	// Parse the optional filters (status, role, email_status, search, created_after, created_before)
+	filter, err := parseUserFilterQuery(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Get a reference to the "users" collection in the MongoDB database
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Create a context with a timeout for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	// Prepare a slice to hold all user records
 	var users []models.User
 
-	// Find all user documents in the collection
-	cursor, err := collection.Find(ctx, bson.M{})
+	query, err := buildUserFilter(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve users"})
+	}
+
+	// Find all user documents matching the filters
+	cursor, err := collection.Find(ctx, query)
 	if err != nil {
 		// If there's an error finding the users, return a 500 Internal Server Error with an error message
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve users"})
@@ -47,6 +58,11 @@ func GetAllUsersHandler(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Cursor iteration error"})
 	}
 
+	// Add the merchant profiles, which the users' organizations hold
+	if err := services.LoadMerchantProfiles(ctx, users); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve merchant profiles"})
+	}
+
 	// Return the list of users in the response
 	return c.Status(http.StatusOK).JSON(fiber.Map{
 		"message": "Users retrieved successfully",
@@ -7,6 +7,7 @@ import (
 
 	"myfibergotemplate/database"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -37,15 +38,23 @@ func GetUserByIDHandler(c *fiber.Ctx) error {
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Create a context with a timeout for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
-	// Find the user by ID
+	// Find the user by ID; only administrators can see soft-deleted users
+	filter := bson.M{"_id": objID}
+	if jwtUserRole != "administrator" {
+		filter["deleted_at"] = bson.M{"$exists": false}
+	}
+
 	var user models.User
-	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = collection.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve merchant profile"})
+	}
 
 	// Return the user data
 	return c.Status(http.StatusOK).JSON(fiber.Map{
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestUser stores a user to sign in as and removes everything about them when the test ends
+func newTestUser(t *testing.T, role models.Role) models.User {
+	t.Helper()
+
+	user := models.User{
+		ID:          primitive.NewObjectID(),
+		Status:      models.Approved,
+		Email:       primitive.NewObjectID().Hex() + "@example.com",
+		EmailStatus: true,
+		Role:        role,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { purgeTestUser(t, user.ID) })
+	return user
+}
+
+func purgeTestUser(t *testing.T, userID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if err := services.PurgeUser(ctx, collection, userID); err != nil {
+		t.Error(err)
+	}
+}
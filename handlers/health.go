@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/libs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// shuttingDown is set once the server starts draining so load balancers stop routing to it
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes the readiness probe fail while in-flight requests drain
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// HealthzHandler reports that the process is alive
+func HealthzHandler(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+// ReadyzHandler reports whether the server can handle traffic by checking its dependencies
+func ReadyzHandler(c *fiber.Ctx) error {
+	if shuttingDown.Load() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "shutting_down"})
+	}
+
+	// Create a context with a timeout so a hung dependency fails the probe instead of blocking it
+	ctx, cancel := context.WithTimeout(c.UserContext(), 3*time.Second)
+	defer cancel()
+
+	checks := fiber.Map{"mongodb": "ok", "mailer": "ok"}
+	ready := true
+
+	// Check the database connection
+	if err := database.GetMongoClient().Ping(ctx, nil); err != nil {
+		checks["mongodb"] = err.Error()
+		ready = false
+	}
+
+	// Check that the mail server accepts connections
+	if err := libs.CheckMailer(ctx, config.FromContext(c).Email); err != nil {
+		checks["mailer"] = err.Error()
+		ready = false
+	}
+
+	if !ready {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "unavailable", "checks": checks})
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok", "checks": checks})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/geoip"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImpersonateUserHandler issues a short-lived token that lets an administrator act as a merchant, so
+// support staff can see what the merchant sees. The token names the administrator as the actor, and
+// every request made with it is audited (Admin only).
+func ImpersonateUserHandler(c *fiber.Ctx) error {
+	type ImpersonateRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	var req ImpersonateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || len(reason) > 500 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A reason of at most 500 characters is required"})
+	}
+
+	userID := c.Params("id")
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	adminID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	// Administrators cannot take on another administrator's rights
+	if user.Role == models.Administrator {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Administrators cannot be impersonated"})
+	}
+
+	cfg := config.FromContext(c)
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	// The session is left out of new-device detection, since the device is the administrator's
+	session := &models.Session{
+		UserID:         user.ID,
+		DeviceName:     utils.DescribeUserAgent(userAgent),
+		UserAgent:      userAgent,
+		IPAddress:      c.IP(),
+		Location:       geoip.Lookup(c.IP()),
+		Method:         "impersonation",
+		ImpersonatorID: &adminID,
+		ExpiresAt:      time.Now().Add(cfg.Auth.ImpersonationTTL),
+	}
+	if _, err := services.StartSession(ctx, session); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start session"})
+	}
+
+	token, err := generateJWTToken(cfg, user, session)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	event := newUserAuditEvent(c, "user.impersonation_started", userID)
+	event.Metadata = map[string]string{"reason": reason, "session_id": session.ID.Hex()}
+	audit.Record(event)
+	loadMerchantProfile(ctx, c, &user)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":    "Impersonation started",
+		"token":      token,
+		"expires_at": session.ExpiresAt,
+		"user": fiber.Map{
+			"id":            user.ID.Hex(),
+			"merchant_name": user.MerchantName,
+			"email":         user.Email,
+			"role":          user.Role,
+		},
+	})
+}
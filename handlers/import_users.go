@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// importRow is a single user record read from an import file
+type importRow struct {
+	MerchantName       string `json:"merchant_name"`
+	Email              string `json:"email"`
+	PersonInCharge     string `json:"person_in_charge"`
+	PhoneNumber        string `json:"phone_number"`
+	Website            string `json:"website"`
+	Address            string `json:"address"`
+	Role               string `json:"role"`
+	Status             string `json:"status"`
+	TermsAndConditions bool   `json:"terms_and_conditions"`
+	Password           string `json:"password"`
+
+	line int    // Line number in the import file
+	err  string // Parse error for this row, if any
+}
+
+// importRowResult reports the outcome of importing a single row
+type importRowResult struct {
+	Row     int    `json:"row"`
+	Email   string `json:"email,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// ImportUsersHandler imports users from a CSV or NDJSON file and invites new users by email
+func ImportUsersHandler(c *fiber.Ctx) error {
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported format, expected csv or ndjson"})
+	}
+	upsert := c.QueryBool("upsert", false)
+
+	// Accept the file either as a multipart upload or as the raw request body
+	data := c.Body()
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot read uploaded file"})
+		}
+		defer file.Close()
+
+		if data, err = io.ReadAll(file); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot read uploaded file"})
+		}
+	}
+
+	var rows []importRow
+	var err error
+	if format == "csv" {
+		rows, err = parseCSVImport(data)
+	} else {
+		rows, err = parseNDJSONImport(data)
+	}
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(rows) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Import file contains no rows"})
+	}
+
+	inviterID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	results := make([]importRowResult, 0, len(rows))
+	counts := map[string]int{"created": 0, "updated": 0, "failed": 0}
+	seenEmails := make(map[string]bool)
+	auditBase := audit.NewEvent(c, "")
+
+	for _, row := range rows {
+		result := importUserRow(c.UserContext(), config.FromContext(c), collection, inviterID, row, upsert, seenEmails, auditBase)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	event := audit.NewEvent(c, "users.imported")
+	event.Metadata = map[string]string{
+		"format":  format,
+		"upsert":  strconv.FormatBool(upsert),
+		"created": strconv.Itoa(counts["created"]),
+		"updated": strconv.Itoa(counts["updated"]),
+		"failed":  strconv.Itoa(counts["failed"]),
+	}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "Import completed",
+		"created": counts["created"],
+		"updated": counts["updated"],
+		"failed":  counts["failed"],
+		"rows":    results,
+	})
+}
+
+// parseCSVImport reads import rows from CSV data with a header line
+func parseCSVImport(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Cannot read CSV header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "password" {
+			return nil, errors.New("Passwords cannot be imported; users are invited by email instead")
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("CSV header must contain an email column")
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row := importRow{line: line}
+		if err != nil {
+			row.err = "Malformed CSV row"
+			rows = append(rows, row)
+			continue
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.MerchantName = get("merchant_name")
+		row.Email = get("email")
+		row.PersonInCharge = get("person_in_charge")
+		row.PhoneNumber = get("phone_number")
+		row.Website = get("website")
+		row.Address = get("address")
+		row.Role = get("role")
+		row.Status = get("status")
+		if value := get("terms_and_conditions"); value != "" {
+			accepted, err := strconv.ParseBool(value)
+			if err != nil {
+				row.err = "Invalid terms_and_conditions value"
+			}
+			row.TermsAndConditions = accepted
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseNDJSONImport reads import rows from newline-delimited JSON data
+func parseNDJSONImport(data []byte) ([]importRow, error) {
+	var rows []importRow
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := importRow{}
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			row = importRow{err: "Malformed JSON row"}
+		}
+		row.line = line
+		row.Email = strings.TrimSpace(row.Email)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Cannot read NDJSON data")
+	}
+
+	return rows, nil
+}
+
+// validateImportRow checks a row's fields and returns the first problem found
+func validateImportRow(row importRow) string {
+	switch {
+	case row.err != "":
+		return row.err
+	case row.Password != "":
+		return "Passwords cannot be imported; users are invited by email instead"
+	case row.Email == "":
+		return "Email is required"
+	case !utils.IsValidEmail(row.Email):
+		return "Invalid email address"
+	case row.Role != "" && row.Role != string(models.Administrator) && row.Role != string(models.Merchant):
+		return "Invalid role"
+	case row.Status != "" && row.Status != string(models.Approved) && row.Status != string(models.Pending) && row.Status != string(models.Suspended):
+		return "Invalid status"
+	}
+	return ""
+}
+
+// importUserRow creates, updates or rejects the user described by a single import row. Changes to existing
+// users are audited using the request details captured in auditBase.
+func importUserRow(parentCtx context.Context, cfg *config.Config, collection *mongo.Collection, inviterID primitive.ObjectID, row importRow, upsert bool, seenEmails map[string]bool, auditBase models.AuditEvent) importRowResult {
+	result := importRowResult{Row: row.line, Email: row.Email}
+
+	if problem := validateImportRow(row); problem != "" {
+		result.Status = "failed"
+		result.Error = problem
+		return result
+	}
+	// Emails are matched as typed, both within the file and against existing users
+	if seenEmails[row.Email] {
+		result.Status = "failed"
+		result.Error = "Duplicate email in import file"
+		return result
+	}
+	seenEmails[row.Email] = true
+	if row.PhoneNumber != "" {
+		phone, err := utils.NormalizePhoneNumber(row.PhoneNumber, cfg.SMS.DefaultCountryCode)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = "Invalid phone number"
+			return result
+		}
+		row.PhoneNumber = phone
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, 10*time.Second)
+	defer cancel()
+
+	var existingUser models.User
+	err := collection.FindOne(ctx, bson.M{"email": row.Email}).Decode(&existingUser)
+	if err == nil {
+		if existingUser.DeletedAt != nil {
+			result.Status = "failed"
+			result.Error = "User with this email is deleted and awaiting purge"
+			return result
+		}
+		if !upsert {
+			result.Status = "failed"
+			result.Error = "User with this email already exists"
+			return result
+		}
+
+		// Update the existing user's profile with the non-empty imported fields
+		update := bson.M{"updated_at": time.Now()}
+		fields := map[string]string{
+			"person_in_charge": row.PersonInCharge,
+			"phone_number":     row.PhoneNumber,
+			"role":             row.Role,
+			"status":           row.Status,
+		}
+		for field, value := range fields {
+			if value != "" {
+				update[field] = value
+			}
+		}
+		if row.TermsAndConditions {
+			update["terms_and_conditions"] = true
+		}
+		if row.PhoneNumber != "" && row.PhoneNumber != existingUser.PhoneNumber {
+			update["phone_verified"] = false
+			update["sms_code_required"] = false
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": existingUser.ID}, bson.M{"$set": update}); err != nil {
+			result.Status = "failed"
+			result.Error = "Failed to update user"
+			return result
+		}
+		if row.TermsAndConditions && !existingUser.TermsAndConditions {
+			recordImportedConsent(ctx, existingUser.ID)
+		}
+
+		// Record what changed, as when the user is edited
+		event := auditBase
+		event.Action = "user.updated"
+		event.TargetType = "user"
+		event.TargetID = existingUser.ID.Hex()
+		event.Changes = audit.Diff(userProfileData(existingUser), update)
+		event.Metadata = map[string]string{"source": "import"}
+		delete(event.Changes, "updated_at")
+		if len(event.Changes) > 0 {
+			audit.Record(event)
+		}
+
+		result.Warning = importMerchantProfile(ctx, existingUser.ID, row, auditBase)
+
+		// A new role or status applies from the user's next sign-in
+		if (row.Role != "" && row.Role != string(existingUser.Role)) || (row.Status != "" && row.Status != string(existingUser.Status)) {
+			if _, err := services.RevokeSessions(ctx, bson.M{"user_id": existingUser.ID}); err != nil {
+				slog.Error("Failed to revoke sessions of imported user", "user_id", existingUser.ID.Hex(), "error", err)
+				result.Warning = "Failed to sign the user out after changing their role or status"
+			}
+		}
+		result.Status = "updated"
+		return result
+	}
+	if err != mongo.ErrNoDocuments {
+		result.Status = "failed"
+		result.Error = "Failed to look up user"
+		return result
+	}
+
+	// New users receive an invitation instead of a password
+	if row.MerchantName == "" || row.PersonInCharge == "" {
+		result.Status = "failed"
+		result.Error = "merchant_name and person_in_charge are required for new users"
+		return result
+	}
+
+	user := models.User{
+		ID:                 primitive.NewObjectID(),
+		MerchantName:       row.MerchantName,
+		Status:             models.Pending,
+		Email:              row.Email,
+		EmailStatus:        false,
+		Role:               models.Merchant,
+		PersonInCharge:     row.PersonInCharge,
+		PhoneNumber:        row.PhoneNumber,
+		Website:            row.Website,
+		Address:            row.Address,
+		TermsAndConditions: row.TermsAndConditions,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+	if row.Role != "" {
+		user.Role = models.Role(row.Role)
+	}
+	if row.Status != "" {
+		user.Status = models.Status(row.Status)
+	}
+
+	if _, err := collection.InsertOne(ctx, user); err != nil {
+		result.Status = "failed"
+		result.Error = "Failed to create user"
+		return result
+	}
+	result.Status = "created"
+
+	// Merchants own the organization holding their profile
+	if user.Role == models.Merchant {
+		if err := services.CreateMerchantOrganization(ctx, user); err != nil {
+			slog.Error("Failed to create organization for imported user", "user_id", user.ID.Hex(), "error", err)
+			result.Warning = "Failed to create the user's organization; merchant_name, website and address were not imported"
+		}
+	}
+
+	if user.TermsAndConditions {
+		recordImportedConsent(ctx, user.ID)
+	}
+
+	// The invitation lets the user choose a password for the account
+	invitation := &models.Invitation{
+		Email:        user.Email,
+		Role:         user.Role,
+		MerchantName: user.MerchantName,
+		PreApproved:  user.Status == models.Approved,
+		UserID:       &user.ID,
+		InvitedBy:    inviterID,
+		ExpiresAt:    time.Now().Add(invitationTTL),
+	}
+	token, err := services.NewInvitation(ctx, invitation)
+	if err != nil {
+		slog.Error("Failed to create invitation for imported user", "user_id", user.ID.Hex(), "error", err)
+		result.Warning = "Failed to create invitation"
+		return result
+	}
+	if err := sendInvitationRecordEmail(ctx, cfg, invitation, token); err != nil {
+		slog.Error("Failed to queue invitation email for imported user", "user_id", user.ID.Hex(), "email", user.Email, "error", err)
+		result.Warning = "Failed to queue invitation email"
+	}
+
+	return result
+}
+
+// importMerchantProfile sets the non-empty imported profile fields on the organization the user owns,
+// which holds the merchant profile, and returns a warning when they cannot be imported. The changes are
+// audited using the request details captured in auditBase.
+func importMerchantProfile(ctx context.Context, userID primitive.ObjectID, row importRow, auditBase models.AuditEvent) string {
+	profile := bson.M{}
+	for field, value := range map[string]string{"merchant_name": row.MerchantName, "website": row.Website, "address": row.Address} {
+		if value != "" {
+			profile[field] = value
+		}
+	}
+	if len(profile) == 0 {
+		return ""
+	}
+
+	org, err := services.OwnedOrganization(ctx, userID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "The user owns no organization, so merchant_name, website and address were not imported"
+	}
+	if err != nil {
+		slog.Error("Failed to import merchant profile", "user_id", userID.Hex(), "error", err)
+		return "Failed to update the user's organization"
+	}
+
+	event := auditBase
+	event.Action = "organization.updated"
+	event.TargetType = "organization"
+	event.TargetID = org.ID.Hex()
+	event.Changes = audit.Diff(map[string]interface{}{
+		"merchant_name": org.MerchantName,
+		"website":       org.Website,
+		"address":       org.Address,
+	}, profile)
+	event.Metadata = map[string]string{"source": "import"}
+	if len(event.Changes) == 0 {
+		return ""
+	}
+
+	if err := services.UpdateOrganization(ctx, org.ID, profile); err != nil {
+		slog.Error("Failed to import merchant profile", "user_id", userID.Hex(), "error", err)
+		return "Failed to update the user's organization"
+	}
+	audit.Record(event)
+	return ""
+}
+
+// recordImportedConsent records terms consent carried over from an imported record
+func recordImportedConsent(ctx context.Context, userID primitive.ObjectID) {
+	record := models.ConsentRecord{
+		UserID:  userID,
+		Type:    models.TermsAndConditionsConsent,
+		Granted: true,
+		Source:  "import",
+	}
+	if err := services.RecordConsent(ctx, record); err != nil {
+		slog.Error("Failed to record imported consent", "user_id", userID.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/metrics"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const invitationTTL = 7 * 24 * time.Hour     // How long an invitation link stays valid by default
+const maxInvitationTTL = 30 * 24 * time.Hour // Latest expiry an inviter can choose
+
+// Reasons an invitation cannot be accepted, sent to the frontend as the error parameter after a federated login
+var (
+	errInvitationInvalid       = errors.New("invalid_invitation")
+	errInvitationAccountExists = errors.New("account_exists")
+	errInvitationNotMerchant   = errors.New("merchant_required")
+	errInvitationEmailMismatch = errors.New("invitation_email_mismatch")
+)
+
+// newInvitationAuditEvent prepares an audit event about an invitation
+func newInvitationAuditEvent(c *fiber.Ctx, action string, invitation *models.Invitation) models.AuditEvent {
+	event := audit.NewEvent(c, action)
+	event.TargetType = "invitation"
+	event.TargetID = invitation.ID.Hex()
+	event.Metadata = map[string]string{"email": invitation.Email}
+	if invitation.OrganizationID != nil {
+		event.Metadata["organization_id"] = invitation.OrganizationID.Hex()
+	}
+	return event
+}
+
+// invitationExpiry returns when a new invitation expires: at expiresAt if given, otherwise after invitationTTL
+func invitationExpiry(expiresAt *time.Time) (time.Time, bool) {
+	if expiresAt == nil {
+		return time.Now().Add(invitationTTL), true
+	}
+	if !expiresAt.After(time.Now()) || expiresAt.After(time.Now().Add(maxInvitationTTL)) {
+		return time.Time{}, false
+	}
+	return *expiresAt, true
+}
+
+// CreateInvitationHandler invites someone by email to create an account with a pre-assigned role, optionally
+// approved in advance (Admin only)
+func CreateInvitationHandler(c *fiber.Ctx) error {
+	type CreateInvitationRequest struct {
+		Email        string      `json:"email"`
+		Role         models.Role `json:"role"`
+		MerchantName string      `json:"merchant_name"`
+		PreApproved  bool        `json:"pre_approved"`
+		ExpiresAt    *time.Time  `json:"expires_at"`
+	}
+
+	var req CreateInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	// Emails are matched as typed, like at sign-in, so an existing account is found
+	email := strings.TrimSpace(req.Email)
+	if !utils.IsValidEmail(email) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A valid email is required"})
+	}
+	if req.Role == "" {
+		req.Role = models.Merchant
+	}
+	if req.Role != models.Merchant && req.Role != models.Administrator {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Role must be merchant or administrator"})
+	}
+	merchantName := strings.TrimSpace(req.MerchantName)
+	if req.Role == models.Merchant && merchantName == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Merchant name is required to invite a merchant"})
+	}
+	expiresAt, ok := invitationExpiry(req.ExpiresAt)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Expiry must be in the future and within 30 days"})
+	}
+
+	inviterID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Invitations create accounts, so the email must not have one yet
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	count, err := collection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+	if count > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A user with this email already exists"})
+	}
+
+	invitation := &models.Invitation{
+		Email:        email,
+		Role:         req.Role,
+		MerchantName: merchantName,
+		PreApproved:  req.PreApproved,
+		InvitedBy:    inviterID,
+		ExpiresAt:    expiresAt,
+	}
+	token, err := services.NewInvitation(ctx, invitation)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+
+	if err := sendInvitationRecordEmail(ctx, config.FromContext(c), invitation, token); err != nil {
+		logger.FromContext(c).Error("Failed to queue invitation email", "invitation_id", invitation.ID.Hex(), "email", email, "error", err)
+	}
+
+	event := newInvitationAuditEvent(c, "invitation.created", invitation)
+	event.Metadata["role"] = string(invitation.Role)
+	if invitation.PreApproved {
+		event.Metadata["pre_approved"] = "true"
+	}
+	audit.Record(event)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Invitation sent", "invitation": invitation})
+}
+
+// ListInvitationsHandler returns the invitations that can still be accepted, filtered by email or
+// organization_id (Admin only)
+func ListInvitationsHandler(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if email := c.Query("email"); email != "" {
+		filter["email"] = strings.TrimSpace(email)
+	}
+	if orgID := c.Query("organization_id"); orgID != "" {
+		id, err := primitive.ObjectIDFromHex(orgID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid organization ID"})
+		}
+		filter["organization_id"] = id
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	invitations, err := services.PendingInvitations(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve invitations"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"invitations": invitations})
+}
+
+// ResendInvitationHandler emails an invitation again with a new link and a fresh expiry (Admin only)
+func ResendInvitationHandler(c *fiber.Ctx) error {
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+	return resendInvitation(c, bson.M{"_id": invitationID})
+}
+
+// RevokeInvitationHandler revokes a pending invitation so its link no longer works (Admin only)
+func RevokeInvitationHandler(c *fiber.Ctx) error {
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := services.RevokeInvitations(ctx, bson.M{"_id": invitationID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke invitation"})
+	}
+	if revoked == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+
+	event := audit.NewEvent(c, "invitation.revoked")
+	event.TargetType = "invitation"
+	event.TargetID = invitationID.Hex()
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Invitation revoked successfully"})
+}
+
+// resendInvitation gives the invitation matching filter a new link and emails it
+func resendInvitation(c *fiber.Ctx, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	invitation, token, err := services.ResendInvitation(ctx, filter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resend invitation"})
+	}
+
+	if err := sendInvitationRecordEmail(ctx, config.FromContext(c), invitation, token); err != nil {
+		logger.FromContext(c).Error("Failed to queue invitation email", "invitation_id", invitation.ID.Hex(), "email", invitation.Email, "error", err)
+	}
+
+	audit.Record(newInvitationAuditEvent(c, "invitation.resent", invitation))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Invitation resent", "invitation": invitation})
+}
+
+// acceptInvitationWithPassword completes an invitation from the accept page. People without an account, and
+// imported users whose account has no password yet, choose a password; existing members of the platform only
+// need the link.
+func acceptInvitationWithPassword(ctx context.Context, c *fiber.Ctx, invitation *models.Invitation, password, personInCharge string) error {
+	user, err := findInvitedUser(ctx, invitation)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	accountCreated := user == nil
+	setPassword := user != nil && user.Password == ""
+	var hashedPassword string
+	if accountCreated || setPassword {
+		if len(password) < 8 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 8 characters long"})
+		}
+		hashedPassword, err = utils.HashPassword(ctx, password)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
+		}
+	}
+	if accountCreated {
+		newUser := invitedUser(invitation, personInCharge)
+		newUser.Password = hashedPassword
+		user = &newUser
+	}
+
+	if err := redeemInvitation(ctx, c, invitation, user, accountCreated, "password"); err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	if setPassword {
+		collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+		update := bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to accept invitation"})
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":         "Invitation accepted, you can now sign in",
+		"account_created": accountCreated,
+		"status":          user.Status,
+	})
+}
+
+// findInvitedUser returns the account with the invited email, or nil when there is none. Invitations to the
+// platform are for new accounts only, except those of imported users, and only merchants can join organizations.
+func findInvitedUser(ctx context.Context, invitation *models.Invitation) (*models.User, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// Imported users' accounts exist before their invitation is accepted
+	filter := bson.M{"email": invitation.Email}
+	if invitation.UserID != nil {
+		filter = bson.M{"_id": *invitation.UserID}
+	}
+
+	var user models.User
+	err := collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if invitation.UserID != nil {
+			return nil, errInvitationInvalid
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case user.DeletedAt != nil:
+		return nil, errFederatedAccountGone
+	case invitation.UserID != nil:
+		return &user, nil
+	case invitation.OrganizationID == nil:
+		return nil, errInvitationAccountExists
+	case user.Role != models.Merchant:
+		return nil, errInvitationNotMerchant
+	}
+	return &user, nil
+}
+
+// invitedUser builds the account an invitation creates. Its email is verified by the invitation itself.
+func invitedUser(invitation *models.Invitation, personInCharge string) models.User {
+	user := models.User{
+		ID:             primitive.NewObjectID(),
+		MerchantName:   invitation.MerchantName,
+		Status:         models.Pending,
+		Email:          invitation.Email,
+		EmailStatus:    true,
+		Role:           invitation.Role,
+		PersonInCharge: strings.TrimSpace(personInCharge),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if invitation.PreApproved {
+		user.Status = models.Approved
+	}
+	if user.Role == "" {
+		user.Role = models.Merchant
+	}
+	if user.PersonInCharge == "" {
+		user.PersonInCharge = invitation.Email
+	}
+	return user
+}
+
+// redeemInvitation claims an invitation for user and applies it: a new account is created, an existing
+// one has its email verified, and the user joins the invitation's organization. The invitation is claimed
+// first so a link cannot be used twice.
+func redeemInvitation(ctx context.Context, c *fiber.Ctx, invitation *models.Invitation, user *models.User, create bool, method string) error {
+	accepted, err := services.AcceptInvitation(ctx, invitation.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		return errInvitationInvalid
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	if create {
+		if _, err := collection.InsertOne(ctx, user); err != nil {
+			return err
+		}
+
+		metrics.Signups.Inc()
+		event := newUserAuditEvent(c, "user.signup", user.ID.Hex())
+		event.ActorID = user.ID.Hex()
+		event.Metadata = map[string]string{"invitation_id": invitation.ID.Hex(), "method": method}
+		audit.Record(event)
+
+		// Invited merchants who don't join an organization get one of their own
+		if user.Role == models.Merchant && invitation.OrganizationID == nil {
+			if err := services.CreateMerchantOrganization(ctx, *user); err != nil {
+				logger.FromContext(c).Error("Failed to create merchant organization", "user_id", user.ID.Hex(), "error", err)
+			}
+		}
+	} else if !user.EmailStatus {
+		// The invitation link reached the user's inbox, which proves they own the address
+		update := bson.M{"$set": bson.M{"email_status": true, "updated_at": time.Now()}, "$unset": bson.M{"verification_token": ""}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+			return err
+		}
+		user.EmailStatus = true
+	}
+
+	if invitation.OrganizationID != nil {
+		err := services.AddOrganizationMember(ctx, *invitation.OrganizationID, user.ID, invitation.OrgRole)
+		if err != nil && !errors.Is(err, services.ErrAlreadyMember) {
+			return err
+		}
+
+		event := newOrganizationAuditEvent(c, "organization.member_joined", invitation.OrganizationID.Hex())
+		event.ActorID = user.ID.Hex()
+		event.ActorRole = string(user.Role)
+		event.Metadata = map[string]string{"invitation_id": invitation.ID.Hex(), "role": string(invitation.OrgRole)}
+		audit.Record(event)
+	}
+
+	event := newInvitationAuditEvent(c, "invitation.accepted", invitation)
+	event.ActorID = user.ID.Hex()
+	event.ActorRole = string(user.Role)
+	event.Metadata["method"] = method
+	audit.Record(event)
+	return nil
+}
+
+// invitationErrorResponse turns a failure to accept an invitation into an error response
+func invitationErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errInvitationInvalid):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invalid or expired invitation"})
+	case errors.Is(err, errInvitationAccountExists):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "An account with this email already exists; sign in instead"})
+	case errors.Is(err, errInvitationNotMerchant):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Only merchant accounts can join organizations"})
+	case errors.Is(err, errFederatedAccountGone):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The account with this email has been deleted"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to accept invitation"})
+}
+
+// sendInvitationRecordEmail emails the link of an invitation, to the organization's accept page for
+// organization invitations and to the account accept page otherwise. Imported users are told their
+// account is waiting for a password.
+func sendInvitationRecordEmail(ctx context.Context, cfg *config.Config, invitation *models.Invitation, token string) error {
+	expires := invitation.ExpiresAt.UTC().Format("2 January 2006 15:04 MST")
+
+	if invitation.UserID != nil {
+		invitationLink := cfg.Server.FrontendURL + "/accept-invitation?token=" + token
+		emailBody := `<p>Dear ` + html.EscapeString(invitation.MerchantName) + `,</p>
+				  <p>An account has been created for you on TalentDev.</p>
+				  <p>To activate it, please choose your password by clicking the link below:</p>
+				  <p><a href="` + invitationLink + `">Accept invitation</a></p>
+				  <p>This link expires on ` + expires + `.</p>
+				  <p>Kind regards,<br>The TalentDev Team</p>`
+		return libs.QueueEmail(ctx, cfg.Email, []string{invitation.Email}, "You're invited - TalentDev ID", emailBody)
+	}
+
+	if invitation.OrganizationID != nil {
+		merchantName := html.EscapeString(invitation.MerchantName)
+		invitationLink := cfg.Server.FrontendURL + "/organizations/accept-invitation?token=" + token
+		emailBody := `<p>Hello,</p>
+				  <p>You have been invited to join ` + merchantName + ` on TalentDev.</p>
+				  <p>To accept, please click the link below:</p>
+				  <p><a href="` + invitationLink + `">Join ` + merchantName + `</a></p>
+				  <p>This link expires on ` + expires + `. If you were not expecting this invitation, you can ignore this email.</p>
+				  <p>Kind regards,<br>The TalentDev Team</p>`
+		return libs.QueueEmail(ctx, cfg.Email, []string{invitation.Email}, "You're invited to "+invitation.MerchantName+" - TalentDev ID", emailBody)
+	}
+
+	invitationLink := cfg.Server.FrontendURL + "/accept-invitation?token=" + token
+	emailBody := `<p>Hello,</p>
+				  <p>You have been invited to create an account on TalentDev.</p>
+				  <p>To accept, click the link below and choose a password or sign in with your work account:</p>
+				  <p><a href="` + invitationLink + `">Accept invitation</a></p>
+				  <p>This link expires on ` + expires + `. If you were not expecting this invitation, you can ignore this email.</p>
+				  <p>Kind regards,<br>The TalentDev Team</p>`
+	return libs.QueueEmail(ctx, cfg.Email, []string{invitation.Email}, "You're invited - TalentDev ID", emailBody)
+}
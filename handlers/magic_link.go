@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const maxMagicLinks = 3                  // Maximum links requested for one email per window
+const maxMagicLinksPerIP = 20            // Maximum links requested from one IP address per window
+const magicLinkWindow = 15 * time.Minute // Window over which requested links are counted
+
+// RequestMagicLinkHandler emails a single-use sign-in link. The response is the same whether or not
+// the email belongs to an account, so it cannot be used to find out who has one.
+func RequestMagicLinkHandler(c *fiber.Ctx) error {
+	type MagicLinkRequest struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	cfg := config.FromContext(c)
+	if !cfg.MagicLink.Enabled {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Magic link sign-in is not enabled"})
+	}
+
+	var req MagicLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	// Match the email as typed, like password sign-in does
+	email := req.Email
+	if !utils.IsValidEmail(email) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A valid email is required"})
+	}
+
+	response := fiber.Map{"message": "If an account exists for this email, a sign-in link has been sent"}
+	if cfg.MagicLink.BindDevice {
+		// Unknown emails get a device token too, so its presence gives nothing away
+		response["device_token"] = utils.GenerateVerificationToken()
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Rate limit by email and IP address before looking the account up, so the limit applies the same
+	// to emails without an account
+	byEmail, byIP, err := services.CountRecentMagicLinkRequests(ctx, email, c.IP(), time.Now().Add(-magicLinkWindow))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create sign-in link"})
+	}
+	if byEmail >= maxMagicLinks || byIP >= maxMagicLinksPerIP {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Too many sign-in links requested, please try again later",
+			"retry_after": int(magicLinkWindow.Minutes()),
+		})
+	}
+	if err := services.RecordMagicLinkRequest(ctx, email, c.IP()); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create sign-in link"})
+	}
+
+	var user models.User
+	err = collection.FindOne(ctx, bson.M{"email": email, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
+	if err != nil {
+		return c.Status(http.StatusOK).JSON(response)
+	}
+
+	token, deviceToken, err := services.NewMagicLink(ctx, cfg.MagicLink, user.ID, c.IP())
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create sign-in link"})
+	}
+	if deviceToken != "" {
+		response["device_token"] = deviceToken
+	}
+
+	// Compose the email subject and body
+	loadMerchantProfile(ctx, c, &user)
+	magicLink := cfg.Server.FrontendURL + "/auth/magic-link?token=" + url.QueryEscape(token)
+	emailSubject := "Your sign-in link - TalentDev ID"
+	emailBody := `<p>Dear ` + user.MerchantName + `,</p>
+				  <p>Click the link below to sign in to TalentDev:</p>
+				  <p><a href="` + magicLink + `">Sign in</a></p>
+				  <p>This link can be used once and expires in ` + minutesText(cfg.MagicLink.TTL) + `. If you did not request it, you can ignore this email.</p>
+				  <p>Kind regards,<br>The TalentDev Team</p>`
+
+	if err := libs.QueueEmail(ctx, cfg.Email, []string{user.Email}, emailSubject, emailBody); err != nil {
+		slog.Error("Failed to queue magic link email", "user_id", user.ID.Hex(), "error", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send email"})
+	}
+
+	audit.Record(newUserAuditEvent(c, "auth.magic_link_sent", user.ID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// VerifyMagicLinkHandler signs a user in with the token from a magic link. It is a POST so that
+// email scanners following the link cannot spend it.
+func VerifyMagicLinkHandler(c *fiber.Ctx) error {
+	type VerifyMagicLinkRequest struct {
+		Token              string `json:"token"`
+		DeviceToken        string `json:"device_token"`
+		AcceptTermsVersion string `json:"accept_terms_version"`
+	}
+
+	if !config.FromContext(c).MagicLink.Enabled {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Magic link sign-in is not enabled"})
+	}
+
+	var req VerifyMagicLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	link, err := services.FindMagicLink(ctx, req.Token)
+	if err != nil {
+		recordSignIn(c, nil, "", "magic_link", "invalid_link")
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired sign-in link"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": link.UserID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		recordSignIn(c, nil, "", "magic_link", "invalid_link")
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired sign-in link"})
+	}
+
+	// A bound link only works where it was requested
+	if !services.MagicLinkBoundTo(link, c.IP(), req.DeviceToken) {
+		recordSignIn(c, &user, user.Email, "magic_link", "binding_mismatch")
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "This sign-in link must be opened on the device and network it was requested from",
+		})
+	}
+
+	// The link stays valid while the user is asked to accept new terms, and is spent only on success
+	if blocked, err := signInBlocked(ctx, c, user, user.Email, "magic_link", req.AcceptTermsVersion); blocked {
+		return err
+	}
+	if used, err := services.UseMagicLink(ctx, link); err != nil || !used {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired sign-in link"})
+	}
+
+	return signInResponse(c, user, user.Email, "magic_link")
+}
+
+// minutesText writes a lifetime in whole minutes for messages to users, e.g. "15 minutes"
+func minutesText(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(minutes) + " minutes"
+}
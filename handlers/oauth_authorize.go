@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authorizationRequest holds the parameters of an OAuth 2.0 authorization request
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type" query:"response_type"`
+	ClientID            string `json:"client_id" query:"client_id"`
+	RedirectURI         string `json:"redirect_uri" query:"redirect_uri"`
+	Scope               string `json:"scope" query:"scope"`
+	State               string `json:"state" query:"state"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method"`
+	Nonce               string `json:"nonce" query:"nonce"`
+	Prompt              string `json:"prompt" query:"prompt"`
+	MaxAge              string `json:"max_age" query:"max_age"`
+	LoginAfter          string `json:"login_after" query:"login_after"` // Added by AuthorizeHandler for prompt=login
+	LoginSignature      string `json:"login_sig" query:"login_sig"`
+}
+
+// authorizationError is an OAuth 2.0 error; it is sent back to the client's redirect URI only once that URI is verified
+type authorizationError struct {
+	Code        string
+	Description string
+	Redirect    bool
+}
+
+// validatedAuthorization is an authorization request that passed validation
+type validatedAuthorization struct {
+	Client      *models.OAuthClient
+	RedirectURI string
+	Scopes      []string
+	Prompts     []string
+	MaxAge      int // -1 when the client set no limit
+}
+
+// AuthorizeHandler is the browser entry point of the authorization code flow.
+// It checks the request and sends the user to the frontend consent screen, which signs them in if needed.
+func AuthorizeHandler(c *fiber.Ctx) error {
+	var req authorizationRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "Malformed authorization request"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	authz, authErr := validateAuthorizationRequest(ctx, req)
+	if authErr != nil {
+		if authErr.Redirect {
+			return c.Redirect(authorizationRedirect(authz.RedirectURI, url.Values{
+				"error":             {authErr.Code},
+				"error_description": {authErr.Description},
+			}, req.State), http.StatusFound)
+		}
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": authErr.Code, "error_description": authErr.Description})
+	}
+
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "Malformed authorization request"})
+	}
+
+	// With prompt=login the user must sign in again after this moment; the signed stamp stops the frontend skipping it
+	query.Del("login_after")
+	query.Del("login_sig")
+	if slices.Contains(authz.Prompts, "login") {
+		loginAfter := strconv.FormatInt(time.Now().Unix(), 10)
+		query.Set("login_after", loginAfter)
+		query.Set("login_sig", loginStampSignature(config.FromContext(c).Auth.JWTSecret, loginAfter))
+	}
+
+	consentURL := config.FromContext(c).Server.FrontendURL + "/oauth/consent?" + query.Encode()
+	return c.Redirect(consentURL, http.StatusFound)
+}
+
+// GetAuthorizationRequestHandler describes an authorization request to the signed-in user for the consent screen
+func GetAuthorizationRequestHandler(c *fiber.Ctx) error {
+	var req authorizationRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "Malformed authorization request"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	authz, authErr := validateAuthorizationRequest(ctx, req)
+	if authErr != nil {
+		return authorizationErrorResponse(c, authz, authErr, req.State)
+	}
+
+	// Signing in is optional here so that prompt=none can fail back to the client instead of showing a login page
+	noPrompt := slices.Contains(authz.Prompts, "none")
+	userIDHex, _ := c.Locals("userID").(string)
+	if userIDHex == "" {
+		if noPrompt {
+			return authorizationErrorResponse(c, authz, &authorizationError{Code: "login_required", Description: "The user is not signed in", Redirect: true}, req.State)
+		}
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Missing Authorization header"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	loginRequired := reauthenticationRequired(c, req, authz)
+	if loginRequired && noPrompt {
+		return authorizationErrorResponse(c, authz, &authorizationError{Code: "login_required", Description: "The user must sign in again", Redirect: true}, req.State)
+	}
+
+	// Skip the consent screen when the user already allowed every requested scope, unless the client asked for it
+	consented, err := services.OAuthConsentCovers(ctx, userID, authz.Client.ClientID, authz.Scopes)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check consent"})
+	}
+	if slices.Contains(authz.Prompts, "consent") {
+		consented = false
+	}
+	if !consented && noPrompt {
+		return authorizationErrorResponse(c, authz, &authorizationError{Code: "consent_required", Description: "The user has not allowed the requested scopes", Redirect: true}, req.State)
+	}
+
+	scopes := make([]fiber.Map, 0, len(authz.Scopes))
+	for _, scope := range authz.Scopes {
+		scopes = append(scopes, fiber.Map{"scope": scope, "description": models.OAuthScopes[scope]})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"client": fiber.Map{
+			"client_id": authz.Client.ClientID,
+			"name":      authz.Client.Name,
+		},
+		"redirect_uri":     authz.RedirectURI,
+		"scopes":           scopes,
+		"consent_required": !consented,
+		"login_required":   loginRequired,
+	})
+}
+
+// DecideAuthorizationHandler records the signed-in user's consent decision and returns where to redirect the browser
+func DecideAuthorizationHandler(c *fiber.Ctx) error {
+	type DecisionRequest struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+
+	var req DecisionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	authz, authErr := validateAuthorizationRequest(ctx, req.authorizationRequest)
+	if authErr != nil {
+		return authorizationErrorResponse(c, authz, authErr, req.State)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	// prompt=login and max_age need a recent sign-in
+	if reauthenticationRequired(c, req.authorizationRequest, authz) {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Please sign in again", "login_required": true})
+	}
+
+	event := newUserAuditEvent(c, "oauth.consent_granted", userID.Hex())
+	event.Metadata = map[string]string{"client_id": authz.Client.ClientID, "scope": strings.Join(authz.Scopes, " ")}
+
+	// The user declined; tell the client without issuing a code
+	if !req.Approve {
+		event.Action = "oauth.consent_denied"
+		event.Outcome = models.AuditFailure
+		audit.Record(event)
+		return c.Status(http.StatusOK).JSON(fiber.Map{
+			"redirect_to": authorizationRedirect(authz.RedirectURI, url.Values{"error": {"access_denied"}}, req.State),
+		})
+	}
+
+	if err := services.GrantOAuthConsent(ctx, userID, authz.Client.ClientID, authz.Scopes); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record consent"})
+	}
+	audit.Record(event)
+
+	// Issue a single-use code bound to the PKCE challenge
+	code := services.NewOAuthSecret(services.OAuthCodePrefix)
+	authorizationCode := models.OAuthAuthorizationCode{
+		ID:                  primitive.NewObjectID(),
+		CodeHash:            services.HashOAuthSecret(code),
+		ClientID:            authz.Client.ClientID,
+		UserID:              userID,
+		RedirectURI:         authz.RedirectURI,
+		Scopes:              authz.Scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		ExpiresAt:           time.Now().Add(config.FromContext(c).OAuth.CodeTTL),
+		CreatedAt:           time.Now(),
+	}
+	if authTime, ok := c.Locals("authTime").(int64); ok {
+		signedInAt := time.Unix(authTime, 0)
+		authorizationCode.AuthTime = &signedInAt
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_codes")
+	if _, err := collection.InsertOne(ctx, authorizationCode); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create authorization code"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"redirect_to": authorizationRedirect(authz.RedirectURI, url.Values{"code": {code}}, req.State),
+	})
+}
+
+// validateAuthorizationRequest checks an authorization request; the redirect URI is verified before any other parameter
+func validateAuthorizationRequest(ctx context.Context, req authorizationRequest) (validatedAuthorization, *authorizationError) {
+	var authz validatedAuthorization
+
+	client, err := services.FindOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidClient) {
+			return authz, &authorizationError{Code: "invalid_request", Description: "Unknown client"}
+		}
+		return authz, &authorizationError{Code: "server_error", Description: "Failed to look up client"}
+	}
+	authz.Client = client
+
+	// The redirect URI must exactly match a registered one; it may be omitted when only one is registered
+	switch {
+	case req.RedirectURI == "" && len(client.RedirectURIs) == 1:
+		authz.RedirectURI = client.RedirectURIs[0]
+	case req.RedirectURI != "" && slices.Contains(client.RedirectURIs, req.RedirectURI):
+		authz.RedirectURI = req.RedirectURI
+	default:
+		return authz, &authorizationError{Code: "invalid_request", Description: "Invalid redirect_uri"}
+	}
+
+	// From here on, errors are reported to the client through the redirect URI
+	if req.ResponseType != "code" {
+		return authz, &authorizationError{Code: "unsupported_response_type", Description: "Only the code response type is supported", Redirect: true}
+	}
+	if !slices.Contains(client.GrantTypes, models.GrantAuthorizationCode) {
+		return authz, &authorizationError{Code: "unauthorized_client", Description: "Client may not use the authorization code grant", Redirect: true}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return authz, &authorizationError{Code: "invalid_request", Description: "PKCE with code_challenge_method S256 is required", Redirect: true}
+	}
+
+	authz.Scopes = services.ParseScopes(req.Scope)
+	if len(authz.Scopes) == 0 {
+		authz.Scopes = []string{models.ScopeProfile}
+	}
+	if !services.ScopesAllowed(authz.Scopes, client.Scopes) {
+		return authz, &authorizationError{Code: "invalid_scope", Description: "Requested scope is not allowed for this client", Redirect: true}
+	}
+
+	// OpenID Connect prompt and max_age parameters
+	authz.Prompts = strings.Fields(req.Prompt)
+	for _, prompt := range authz.Prompts {
+		if prompt != "none" && prompt != "login" && prompt != "consent" {
+			return authz, &authorizationError{Code: "invalid_request", Description: "Unsupported prompt value: " + prompt, Redirect: true}
+		}
+	}
+	if slices.Contains(authz.Prompts, "none") && len(authz.Prompts) > 1 {
+		return authz, &authorizationError{Code: "invalid_request", Description: "prompt=none cannot be combined with other values", Redirect: true}
+	}
+
+	authz.MaxAge = -1
+	if req.MaxAge != "" {
+		maxAge, err := strconv.Atoi(req.MaxAge)
+		if err != nil || maxAge < 0 {
+			return authz, &authorizationError{Code: "invalid_request", Description: "Invalid max_age", Redirect: true}
+		}
+		authz.MaxAge = maxAge
+	}
+
+	return authz, nil
+}
+
+// reauthenticationRequired reports whether the user signed in too long ago for prompt=login or max_age.
+// Sessions that do not record a sign-in time always need a fresh sign-in.
+func reauthenticationRequired(c *fiber.Ctx, req authorizationRequest, authz validatedAuthorization) bool {
+	authTime, known := c.Locals("authTime").(int64)
+
+	if slices.Contains(authz.Prompts, "login") {
+		loginAfter, err := strconv.ParseInt(req.LoginAfter, 10, 64)
+		expected := loginStampSignature(config.FromContext(c).Auth.JWTSecret, req.LoginAfter)
+		if err != nil || !hmac.Equal([]byte(expected), []byte(req.LoginSignature)) || !known || authTime < loginAfter {
+			return true
+		}
+	}
+
+	if authz.MaxAge >= 0 && (!known || time.Now().Unix()-authTime > int64(authz.MaxAge)) {
+		return true
+	}
+	return false
+}
+
+// loginStampSignature signs the time after which a prompt=login request needs the user to have signed in
+func loginStampSignature(secret, loginAfter string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oauth-login-after:" + loginAfter))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authorizationErrorResponse reports an invalid authorization request to the consent screen,
+// including where to send the browser when the error can be returned to the client
+func authorizationErrorResponse(c *fiber.Ctx, authz validatedAuthorization, authErr *authorizationError, state string) error {
+	response := fiber.Map{"error": authErr.Code, "error_description": authErr.Description}
+	if authErr.Redirect {
+		response["redirect_to"] = authorizationRedirect(authz.RedirectURI, url.Values{
+			"error":             {authErr.Code},
+			"error_description": {authErr.Description},
+		}, state)
+	}
+	return c.Status(http.StatusBadRequest).JSON(response)
+}
+
+// authorizationRedirect appends the response parameters and state to the client's redirect URI
+func authorizationRedirect(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateOAuthClientHandler registers a partner application and returns its client secret once
+func CreateOAuthClientHandler(c *fiber.Ctx) error {
+	type CreateClientRequest struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		LogoutURIs   []string `json:"post_logout_redirect_uris"`
+		GrantTypes   []string `json:"grant_types"`
+		Scopes       []string `json:"scopes"`
+		Confidential *bool    `json:"confidential"`
+	}
+
+	var req CreateClientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	// Clients are confidential unless registered as public, e.g. for mobile or single-page apps
+	confidential := req.Confidential == nil || *req.Confidential
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{models.GrantAuthorizationCode, models.GrantRefreshToken}
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{models.ScopeProfile}
+	}
+
+	// Validate the registration
+	if strings.TrimSpace(req.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+	for _, grantType := range req.GrantTypes {
+		if grantType != models.GrantAuthorizationCode && grantType != models.GrantRefreshToken && grantType != models.GrantClientCredentials {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported grant type: " + grantType})
+		}
+	}
+	if slices.Contains(req.GrantTypes, models.GrantClientCredentials) && !confidential {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Public clients cannot use the client_credentials grant"})
+	}
+	if slices.Contains(req.GrantTypes, models.GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "redirect_uris are required for the authorization_code grant"})
+	}
+	for _, redirectURI := range req.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid redirect URI: " + redirectURI})
+		}
+	}
+	for _, logoutURI := range req.LogoutURIs {
+		if !validRedirectURI(logoutURI) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post-logout redirect URI: " + logoutURI})
+		}
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := models.OAuthScopes[scope]; !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown scope: " + scope})
+		}
+	}
+
+	client := models.OAuthClient{
+		ID:           primitive.NewObjectID(),
+		ClientID:     services.OAuthClientIDPrefix + utils.GenerateVerificationToken(),
+		Name:         strings.TrimSpace(req.Name),
+		Confidential: confidential,
+		RedirectURIs: req.RedirectURIs,
+		LogoutURIs:   req.LogoutURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		CreatedBy:    c.Locals("userID").(string),
+		CreatedAt:    time.Now(),
+	}
+
+	// Only a hash of the secret is stored
+	clientSecret := ""
+	if confidential {
+		clientSecret = services.NewOAuthSecret(services.OAuthClientSecretPrefix)
+		client.ClientSecretHash = services.HashOAuthSecret(clientSecret)
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_clients")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if _, err := collection.InsertOne(ctx, client); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create client"})
+	}
+
+	event := audit.NewEvent(c, "oauth.client_created")
+	event.TargetType = "oauth_client"
+	event.TargetID = client.ClientID
+	audit.Record(event)
+
+	response := fiber.Map{
+		"message": "OAuth client created successfully",
+		"client":  client,
+	}
+	if clientSecret != "" {
+		response["client_secret"] = clientSecret
+	}
+	return c.Status(http.StatusCreated).JSON(response)
+}
+
+// ListOAuthClientsHandler lists the registered OAuth clients, newest first
+func ListOAuthClientsHandler(c *fiber.Ctx) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_clients")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve clients"})
+	}
+	defer cursor.Close(ctx)
+
+	clients := []models.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode clients"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"clients": clients})
+}
+
+// RevokeOAuthClientHandler disables a client and revokes every token issued to it
+func RevokeOAuthClientHandler(c *fiber.Ctx) error {
+	clientID := c.Params("clientId")
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_clients")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"client_id": clientID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke client"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Client not found"})
+	}
+
+	if err := services.RevokeOAuthTokens(ctx, bson.M{"client_id": clientID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke client tokens"})
+	}
+
+	event := audit.NewEvent(c, "oauth.client_revoked")
+	event.TargetType = "oauth_client"
+	event.TargetID = clientID
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "OAuth client revoked successfully"})
+}
+
+// validRedirectURI accepts HTTPS URLs, HTTP loopback URLs for local development,
+// and private-use schemes such as com.example.app:/callback for native apps
+func validRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Fragment != "" || u.Scheme == "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListOAuthConsentsHandler lists the applications the signed-in user has allowed to access their account
+func ListOAuthConsentsHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	consents, err := services.OAuthConsentsForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve consents"})
+	}
+
+	// Show the application name next to each consent
+	results := make([]fiber.Map, 0, len(consents))
+	for _, consent := range consents {
+		result := fiber.Map{
+			"client_id":  consent.ClientID,
+			"scopes":     consent.Scopes,
+			"granted_at": consent.GrantedAt,
+		}
+		if client, err := services.FindOAuthClient(ctx, consent.ClientID); err == nil {
+			result["client_name"] = client.Name
+		}
+		results = append(results, result)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"consents": results})
+}
+
+// RevokeOAuthConsentHandler withdraws the signed-in user's consent for an application and revokes its tokens
+func RevokeOAuthConsentHandler(c *fiber.Ctx) error {
+	clientID := c.Params("clientId")
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_consents")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "client_id": clientID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke consent"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Consent not found"})
+	}
+
+	if err := services.RevokeOAuthTokens(ctx, bson.M{"user_id": userID, "client_id": clientID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke application tokens"})
+	}
+
+	event := newUserAuditEvent(c, "oauth.consent_revoked", userID.Hex())
+	event.Metadata = map[string]string{"client_id": clientID}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Consent revoked successfully"})
+}
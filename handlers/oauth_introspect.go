@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IntrospectHandler reports whether a token is active and what it grants (RFC 7662).
+// Only confidential clients, such as resource servers, may introspect tokens.
+func IntrospectHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	client, err := authenticateTokenClient(ctx, c)
+	if err != nil {
+		return oauthClientError(c, err)
+	}
+	if !client.Confidential {
+		return oauthError(c, http.StatusUnauthorized, "invalid_client", "Only confidential clients may introspect tokens")
+	}
+
+	token, err := services.FindActiveOAuthToken(ctx, c.FormValue("token"))
+	if err != nil {
+		// Unknown, expired and revoked tokens are all simply inactive
+		return c.Status(http.StatusOK).JSON(fiber.Map{"active": false})
+	}
+
+	response := fiber.Map{
+		"active":     true,
+		"scope":      strings.Join(token.Scopes, " "),
+		"client_id":  token.ClientID,
+		"token_type": "Bearer",
+		"exp":        token.ExpiresAt.Unix(),
+		"iat":        token.CreatedAt.Unix(),
+	}
+	if token.Type == models.RefreshToken {
+		response["token_type"] = "refresh_token"
+	}
+	if token.UserID != nil {
+		response["sub"] = token.UserID.Hex()
+	}
+	return c.Status(http.StatusOK).JSON(response)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RevokeTokenHandler lets a client revoke one of its tokens (RFC 7009).
+// Revoking a refresh token also revokes the access tokens issued with it.
+func RevokeTokenHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	client, err := authenticateTokenClient(ctx, c)
+	if err != nil {
+		return oauthClientError(c, err)
+	}
+
+	// Unknown tokens and tokens of other clients are ignored, as the specification requires
+	token, err := services.FindOAuthToken(ctx, c.FormValue("token"))
+	if err != nil || token.ClientID != client.ClientID {
+		return c.SendStatus(http.StatusOK)
+	}
+
+	filter := bson.M{"_id": token.ID}
+	if token.Type == models.RefreshToken {
+		filter = bson.M{"family_id": token.FamilyID}
+	}
+	if err := services.RevokeOAuthTokens(ctx, filter); err != nil {
+		return oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "Failed to revoke token")
+	}
+
+	event := audit.NewEvent(c, "oauth.token_revoked")
+	event.TargetType = "oauth_client"
+	event.TargetID = client.ClientID
+	if token.UserID != nil {
+		event.TargetType = "user"
+		event.TargetID = token.UserID.Hex()
+	}
+	event.Metadata = map[string]string{"client_id": client.ClientID, "token_type": string(token.Type)}
+	audit.Record(event)
+
+	return c.SendStatus(http.StatusOK)
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/oidc"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TokenHandler issues tokens for the authorization_code, refresh_token and client_credentials grants
+func TokenHandler(c *fiber.Ctx) error {
+	// Token responses must never be cached
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	client, err := authenticateTokenClient(ctx, c)
+	if err != nil {
+		return oauthClientError(c, err)
+	}
+
+	grantType := c.FormValue("grant_type")
+	if !slices.Contains(client.GrantTypes, grantType) {
+		if grantType != models.GrantAuthorizationCode && grantType != models.GrantRefreshToken && grantType != models.GrantClientCredentials {
+			return oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+		}
+		return oauthError(c, http.StatusBadRequest, "unauthorized_client", "Client may not use this grant type")
+	}
+
+	switch grantType {
+	case models.GrantAuthorizationCode:
+		return exchangeAuthorizationCode(ctx, c, client)
+	case models.GrantRefreshToken:
+		return exchangeRefreshToken(ctx, c, client)
+	default:
+		return issueClientCredentialsToken(ctx, c, client)
+	}
+}
+
+// exchangeAuthorizationCode redeems a single-use authorization code after checking its PKCE verifier
+func exchangeAuthorizationCode(ctx context.Context, c *fiber.Ctx, client *models.OAuthClient) error {
+	codes := database.GetMongoClient().Database("talentdevgo").Collection("oauth_codes")
+	codeHash := services.HashOAuthSecret(c.FormValue("code"))
+
+	// Mark the code as used in the same operation that reads it, so it can only be redeemed once
+	var code models.OAuthAuthorizationCode
+	err := codes.FindOneAndUpdate(ctx,
+		bson.M{"code_hash": codeHash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	).Decode(&code)
+	if err == mongo.ErrNoDocuments {
+		// A replayed code may have been stolen; revoke everything issued from it
+		var used models.OAuthAuthorizationCode
+		if codes.FindOne(ctx, bson.M{"code_hash": codeHash}).Decode(&used) == nil && used.ClientID == client.ClientID {
+			services.RevokeOAuthTokens(ctx, bson.M{"family_id": used.ID})
+		}
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+	}
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to redeem authorization code")
+	}
+
+	switch {
+	case code.ClientID != client.ClientID:
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+	case time.Now().After(code.ExpiresAt):
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Authorization code has expired")
+	case c.FormValue("redirect_uri") != code.RedirectURI:
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+	case !services.VerifyPKCE(c.FormValue("code_verifier"), code.CodeChallenge):
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+	}
+
+	if !services.OAuthUserActive(ctx, code.UserID) {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "User account is not active")
+	}
+
+	// Refresh tokens are only issued when the user allowed offline access
+	withRefresh := slices.Contains(client.GrantTypes, models.GrantRefreshToken) && slices.Contains(code.Scopes, models.ScopeOfflineAccess)
+	grant := models.OAuthToken{FamilyID: code.ID, ClientID: client.ClientID, UserID: &code.UserID, Scopes: code.Scopes, AuthTime: code.AuthTime}
+	issued, err := services.IssueOAuthTokens(ctx, config.FromContext(c).OAuth, grant, withRefresh)
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+	}
+	if issued.IDToken, err = issueIDToken(ctx, c, grant, code.Nonce, issued.AccessToken); err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to issue ID token")
+	}
+
+	recordTokenIssued(c, client, &code.UserID, models.GrantAuthorizationCode, code.Scopes)
+	return tokenResponse(c, issued)
+}
+
+// exchangeRefreshToken rotates a refresh token, optionally narrowing its scopes
+func exchangeRefreshToken(ctx context.Context, c *fiber.Ctx, client *models.OAuthClient) error {
+	refreshToken, err := services.FindOAuthToken(ctx, c.FormValue("refresh_token"))
+	if err != nil || refreshToken.Type != models.RefreshToken || refreshToken.ClientID != client.ClientID {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+	}
+
+	// A rotated refresh token being used again means it leaked; revoke the whole family
+	if refreshToken.RevokedAt != nil {
+		services.RevokeOAuthTokens(ctx, bson.M{"family_id": refreshToken.FamilyID})
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Refresh token has been revoked")
+	}
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Refresh token has expired")
+	}
+
+	scopes := refreshToken.Scopes
+	if requested := services.ParseScopes(c.FormValue("scope")); len(requested) > 0 {
+		if !services.ScopesAllowed(requested, refreshToken.Scopes) {
+			return oauthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the original grant")
+		}
+		scopes = requested
+	}
+
+	if refreshToken.UserID != nil && !services.OAuthUserActive(ctx, *refreshToken.UserID) {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "User account is not active")
+	}
+
+	// Revoke the presented token only if nobody else rotated it first
+	tokens := database.GetMongoClient().Database("talentdevgo").Collection("oauth_tokens")
+	result, err := tokens.UpdateOne(ctx,
+		bson.M{"_id": refreshToken.ID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to rotate refresh token")
+	}
+	if result.ModifiedCount == 0 {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "Refresh token has been revoked")
+	}
+
+	grant := models.OAuthToken{FamilyID: refreshToken.FamilyID, ClientID: client.ClientID, UserID: refreshToken.UserID, Scopes: scopes, AuthTime: refreshToken.AuthTime}
+	issued, err := services.IssueOAuthTokens(ctx, config.FromContext(c).OAuth, grant, true)
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+	}
+	if issued.IDToken, err = issueIDToken(ctx, c, grant, "", issued.AccessToken); err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to issue ID token")
+	}
+
+	recordTokenIssued(c, client, refreshToken.UserID, models.GrantRefreshToken, scopes)
+	return tokenResponse(c, issued)
+}
+
+// issueClientCredentialsToken issues an access token to a confidential client acting on its own behalf
+func issueClientCredentialsToken(ctx context.Context, c *fiber.Ctx, client *models.OAuthClient) error {
+	if !client.Confidential {
+		return oauthError(c, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use the client_credentials grant")
+	}
+
+	// Default to every scope the client is registered for, except offline access and openid which need a user
+	scopes := services.ParseScopes(c.FormValue("scope"))
+	if len(scopes) == 0 {
+		for _, scope := range client.Scopes {
+			if scope != models.ScopeOfflineAccess && scope != models.ScopeOpenID {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if !services.ScopesAllowed(scopes, client.Scopes) || slices.Contains(scopes, models.ScopeOfflineAccess) || slices.Contains(scopes, models.ScopeOpenID) {
+		return oauthError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+	}
+
+	grant := models.OAuthToken{FamilyID: primitive.NewObjectID(), ClientID: client.ClientID, Scopes: scopes}
+	issued, err := services.IssueOAuthTokens(ctx, config.FromContext(c).OAuth, grant, false)
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+	}
+
+	recordTokenIssued(c, client, nil, models.GrantClientCredentials, scopes)
+	return tokenResponse(c, issued)
+}
+
+// authenticateTokenClient authenticates the client with HTTP Basic credentials or client_id and client_secret form fields
+func authenticateTokenClient(ctx context.Context, c *fiber.Ctx) (*models.OAuthClient, error) {
+	clientID, clientSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Basic ") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return nil, services.ErrInvalidClient
+		}
+		id, secret, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, services.ErrInvalidClient
+		}
+
+		// Credentials in the Basic header are form-encoded
+		if clientID, err = url.QueryUnescape(id); err != nil {
+			return nil, services.ErrInvalidClient
+		}
+		if clientSecret, err = url.QueryUnescape(secret); err != nil {
+			return nil, services.ErrInvalidClient
+		}
+	}
+
+	if clientID == "" {
+		return nil, services.ErrInvalidClient
+	}
+	return services.AuthenticateOAuthClient(ctx, clientID, clientSecret)
+}
+
+// issueIDToken signs an OpenID Connect ID token when the grant includes the openid scope
+func issueIDToken(ctx context.Context, c *fiber.Ctx, grant models.OAuthToken, nonce, accessToken string) (string, error) {
+	if grant.UserID == nil || !slices.Contains(grant.Scopes, models.ScopeOpenID) {
+		return "", nil
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": grant.UserID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return "", err
+	}
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims(oidc.UserClaims(user, grant.Scopes))
+	claims["aud"] = grant.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(config.FromContext(c).OAuth.AccessTokenTTL).Unix()
+	claims["at_hash"] = oidc.AccessTokenHash(accessToken)
+	if grant.AuthTime != nil {
+		claims["auth_time"] = grant.AuthTime.Unix()
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return oidc.Sign(claims)
+}
+
+// recordTokenIssued audits the tokens issued to a client
+func recordTokenIssued(c *fiber.Ctx, client *models.OAuthClient, userID *primitive.ObjectID, grantType string, scopes []string) {
+	event := audit.NewEvent(c, "oauth.token_issued")
+	event.TargetType = "oauth_client"
+	event.TargetID = client.ClientID
+	if userID != nil {
+		event.TargetType = "user"
+		event.TargetID = userID.Hex()
+	}
+	event.Metadata = map[string]string{"client_id": client.ClientID, "grant_type": grantType, "scope": strings.Join(scopes, " ")}
+	audit.Record(event)
+}
+
+// tokenResponse writes a successful token response
+func tokenResponse(c *fiber.Ctx, issued services.IssuedOAuthTokens) error {
+	response := fiber.Map{
+		"access_token": issued.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   issued.ExpiresIn,
+		"scope":        strings.Join(issued.Scopes, " "),
+	}
+	if issued.RefreshToken != "" {
+		response["refresh_token"] = issued.RefreshToken
+	}
+	if issued.IDToken != "" {
+		response["id_token"] = issued.IDToken
+	}
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// oauthClientError reports a failed client authentication
+func oauthClientError(c *fiber.Ctx, err error) error {
+	if !errors.Is(err, services.ErrInvalidClient) {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+	}
+	if strings.HasPrefix(c.Get(fiber.HeaderAuthorization), "Basic ") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+	return oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+// oauthError writes an OAuth 2.0 error response
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(fiber.Map{"error": code, "error_description": description})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"myfibergotemplate/models"
+	"myfibergotemplate/oidc"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OpenIDConfigurationHandler publishes the OpenID Connect discovery document
+func OpenIDConfigurationHandler(c *fiber.Ctx) error {
+	issuer := oidc.Issuer()
+
+	scopes := make([]string, 0, len(models.OAuthScopes))
+	for scope := range models.OAuthScopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"end_session_endpoint":                  issuer + "/oauth/logout",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"scopes_supported":                      scopes,
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 []string{models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"prompt_values_supported":               []string{"none", "login", "consent"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"name", "merchant_name", "website", "updated_at",
+			"email", "email_verified", "phone_number", "phone_number_verified", "address",
+		},
+	})
+}
+
+// JWKSHandler publishes the public keys that verify ID tokens
+func JWKSHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.Status(http.StatusOK).JSON(oidc.JWKS())
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/oidc"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EndSessionHandler handles RP-initiated logout. It sends the browser to the frontend, which signs the
+// user out and then returns them to the client's registered post-logout redirect URI, if one was given.
+func EndSessionHandler(c *fiber.Ctx) error {
+	clientID := c.Query("client_id")
+	subject := ""
+
+	// The ID token hint identifies the client and user; expired hints are still accepted
+	if hint := c.Query("id_token_hint"); hint != "" {
+		claims, err := oidc.ParseIDTokenHint(hint)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "Invalid id_token_hint"})
+		}
+		audience, _ := claims["aud"].(string)
+		if clientID != "" && clientID != audience {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "client_id does not match id_token_hint"})
+		}
+		clientID = audience
+		subject, _ = claims["sub"].(string)
+	}
+
+	logoutURL := config.FromContext(c).Server.FrontendURL + "/logout"
+
+	// Only registered post-logout redirect URIs of a known client are honoured
+	if redirectURI := c.Query("post_logout_redirect_uri"); redirectURI != "" {
+		if clientID == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "post_logout_redirect_uri requires id_token_hint or client_id"})
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		client, err := services.FindOAuthClient(ctx, clientID)
+		if err != nil || !slices.Contains(client.LogoutURIs, redirectURI) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "Invalid post_logout_redirect_uri"})
+		}
+
+		logoutURL += "?" + url.Values{"redirect_to": {authorizationRedirect(redirectURI, nil, c.Query("state"))}}.Encode()
+	}
+
+	event := audit.NewEvent(c, "oauth.logout")
+	if subject != "" {
+		event = newUserAuditEvent(c, "oauth.logout", subject)
+	}
+	event.Metadata = map[string]string{"client_id": clientID}
+	audit.Record(event)
+
+	return c.Redirect(logoutURL, http.StatusFound)
+}
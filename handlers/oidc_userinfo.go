@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/oidc"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserInfoHandler returns the claims about the signed-in user that the access token's scopes release
+func UserInfoHandler(c *fiber.Ctx) error {
+	// Only OAuth access tokens carry the scopes that decide which claims to release
+	scopes, ok := c.Locals("oauthScopes").([]string)
+	if !ok {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "UserInfo requires an OAuth access token"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": userID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve user"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusOK).JSON(oidc.UserClaims(user, scopes))
+}
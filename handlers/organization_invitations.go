@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InviteOrganizationMemberHandler emails an invitation to join the organization. Admins may invite staff;
+// only the owner may invite admins. Only platform administrators may approve the invitee's account in advance.
+func InviteOrganizationMemberHandler(c *fiber.Ctx) error {
+	type InviteMemberRequest struct {
+		Email       string         `json:"email"`
+		Role        models.OrgRole `json:"role"`
+		PreApproved bool           `json:"pre_approved"`
+		ExpiresAt   *time.Time     `json:"expires_at"`
+	}
+
+	var req InviteMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	// Emails are matched as typed, like at sign-in, so an existing account is found
+	email := strings.TrimSpace(req.Email)
+	if !utils.IsValidEmail(email) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A valid email is required"})
+	}
+	if req.Role == "" {
+		req.Role = models.OrgStaff
+	}
+	if req.Role != models.OrgAdmin && req.Role != models.OrgStaff {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Role must be admin or staff"})
+	}
+	if req.Role == models.OrgAdmin && actingOrgRole(c) != models.OrgOwner {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only the owner can invite admins"})
+	}
+	if req.PreApproved && c.Locals("userRole") != string(models.Administrator) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only administrators can approve accounts in advance"})
+	}
+	expiresAt, ok := invitationExpiry(req.ExpiresAt)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Expiry must be in the future and within 30 days"})
+	}
+
+	inviterID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	org, err := services.FindOrganization(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+
+	// Don't invite someone who is already a member
+	var existing models.User
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	err = collection.FindOne(ctx, bson.M{"email": email, "deleted_at": bson.M{"$exists": false}}).Decode(&existing)
+	if err == nil {
+		if _, err := services.FindOrganizationMember(ctx, orgID, existing.ID); err == nil {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "This user is already a member of the organization"})
+		}
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+
+	// People who join without an account get a merchant account under the store's name, which
+	// awaits approval like any other unless an administrator approved it in advance
+	invitation := &models.Invitation{
+		Email:          email,
+		Role:           models.Merchant,
+		MerchantName:   org.MerchantName,
+		PreApproved:    req.PreApproved,
+		OrganizationID: &orgID,
+		OrgRole:        req.Role,
+		InvitedBy:      inviterID,
+		ExpiresAt:      expiresAt,
+	}
+	token, err := services.NewInvitation(ctx, invitation)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+
+	if err := sendInvitationRecordEmail(ctx, config.FromContext(c), invitation, token); err != nil {
+		logger.FromContext(c).Error("Failed to queue organization invitation email", "organization_id", orgID.Hex(), "email", email, "error", err)
+	}
+
+	event := newOrganizationAuditEvent(c, "organization.member_invited", orgID.Hex())
+	event.Metadata = map[string]string{"invitation_id": invitation.ID.Hex(), "email": email, "role": string(req.Role)}
+	if invitation.PreApproved {
+		event.Metadata["pre_approved"] = "true"
+	}
+	audit.Record(event)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Invitation sent", "invitation": invitation})
+}
+
+// ListOrganizationInvitationsHandler returns the organization's invitations that can still be accepted
+func ListOrganizationInvitationsHandler(c *fiber.Ctx) error {
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	invitations, err := services.PendingInvitations(ctx, bson.M{"organization_id": orgID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve invitations"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"invitations": invitations})
+}
+
+// ResendOrganizationInvitationHandler emails a pending invitation again with a new link and a fresh expiry
+func ResendOrganizationInvitationHandler(c *fiber.Ctx) error {
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	return resendInvitation(c, bson.M{"_id": invitationID, "organization_id": orgID})
+}
+
+// RevokeOrganizationInvitationHandler revokes a pending invitation so its link no longer works
+func RevokeOrganizationInvitationHandler(c *fiber.Ctx) error {
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := services.RevokeInvitations(ctx, bson.M{"_id": invitationID, "organization_id": orgID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke invitation"})
+	}
+	if revoked == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+
+	event := newOrganizationAuditEvent(c, "organization.invitation_revoked", orgID.Hex())
+	event.Metadata = map[string]string{"invitation_id": invitationID.Hex()}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Invitation revoked successfully"})
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newOrganizationAuditEvent prepares an audit event about an organization
+func newOrganizationAuditEvent(c *fiber.Ctx, action, orgID string) models.AuditEvent {
+	event := audit.NewEvent(c, action)
+	event.TargetType = "organization"
+	event.TargetID = orgID
+	return event
+}
+
+// loadMerchantProfile fills in a user's merchant profile from their organization. A failure is logged
+// rather than failing the request, which can go on without the profile.
+func loadMerchantProfile(ctx context.Context, c *fiber.Ctx, user *models.User) {
+	if err := services.LoadMerchantProfile(ctx, user); err != nil {
+		logger.FromContext(c).Error("Failed to load merchant profile", "user_id", user.ID.Hex(), "error", err)
+	}
+}
+
+// actingOrgRole returns the signed-in user's role in the organization of the request. Administrators act as owners.
+func actingOrgRole(c *fiber.Ctx) models.OrgRole {
+	if c.Locals("userRole") == string(models.Administrator) {
+		return models.OrgOwner
+	}
+	role, _ := c.Locals("orgRole").(string)
+	return models.OrgRole(role)
+}
+
+// ListOrganizationsHandler returns the organizations the signed-in user belongs to, with their role in each
+func ListOrganizationsHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	organizations, err := services.OrganizationsForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve organizations"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"organizations": organizations})
+}
+
+// CreateOrganizationHandler creates another store for the signed-in merchant, who becomes its owner
+func CreateOrganizationHandler(c *fiber.Ctx) error {
+	var org models.Organization
+	if err := c.BodyParser(&org); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if c.Locals("userRole") != string(models.Merchant) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Organizations are available to merchants only"})
+	}
+	org.MerchantName = strings.TrimSpace(org.MerchantName)
+	if org.MerchantName == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Merchant name is required"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if err := services.CreateOrganization(ctx, &org, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create organization"})
+	}
+
+	audit.Record(newOrganizationAuditEvent(c, "organization.created", org.ID.Hex()))
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message":      "Organization created successfully",
+		"organization": services.UserOrganization{Organization: org, Role: models.OrgOwner},
+	})
+}
+
+// GetOrganizationHandler returns an organization the signed-in user belongs to
+func GetOrganizationHandler(c *fiber.Ctx) error {
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	org, err := services.FindOrganization(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"organization": services.UserOrganization{Organization: *org, Role: actingOrgRole(c)}})
+}
+
+// UpdateOrganizationHandler changes an organization's merchant profile
+func UpdateOrganizationHandler(c *fiber.Ctx) error {
+	type UpdateOrganizationRequest struct {
+		MerchantName *string `json:"merchant_name"`
+		Website      *string `json:"website"`
+		Address      *string `json:"address"`
+	}
+
+	var req UpdateOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	update := bson.M{}
+	if req.MerchantName != nil {
+		name := strings.TrimSpace(*req.MerchantName)
+		if name == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Merchant name cannot be empty"})
+		}
+		update["merchant_name"] = name
+	}
+	if req.Website != nil {
+		update["website"] = *req.Website
+	}
+	if req.Address != nil {
+		update["address"] = *req.Address
+	}
+	if len(update) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Nothing to update"})
+	}
+
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	org, err := services.FindOrganization(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+
+	// Record what changed before the update is applied
+	event := newOrganizationAuditEvent(c, "organization.updated", orgID.Hex())
+	event.Changes = audit.Diff(map[string]interface{}{
+		"merchant_name": org.MerchantName,
+		"website":       org.Website,
+		"address":       org.Address,
+	}, update)
+
+	if err := services.UpdateOrganization(ctx, orgID, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update organization"})
+	}
+	delete(event.Changes, "updated_at")
+	audit.Record(event)
+
+	org, err = services.FindOrganization(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve organization"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Organization updated successfully", "organization": org})
+}
+
+// ListOrganizationMembersHandler returns an organization's members with their contact details
+func ListOrganizationMembersHandler(c *fiber.Ctx) error {
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	members, err := services.OrganizationMembers(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve members"})
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	// Look up the members' names and emails in one query
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve members"})
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve members"})
+	}
+	usersByID := make(map[primitive.ObjectID]models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	result := make([]fiber.Map, 0, len(members))
+	for _, member := range members {
+		user := usersByID[member.UserID]
+		result = append(result, fiber.Map{
+			"user_id":          member.UserID.Hex(),
+			"email":            user.Email,
+			"person_in_charge": user.PersonInCharge,
+			"role":             member.Role,
+			"joined_at":        member.JoinedAt,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"members": result})
+}
+
+// UpdateOrganizationMemberHandler changes a member's role between admin and staff
+func UpdateOrganizationMemberHandler(c *fiber.Ctx) error {
+	type UpdateMemberRequest struct {
+		Role models.OrgRole `json:"role"`
+	}
+
+	var req UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Role != models.OrgAdmin && req.Role != models.OrgStaff {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Role must be admin or staff; use the transfer endpoint to change the owner"})
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	member, err := services.FindOrganizationMember(ctx, orgID, memberID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve member"})
+	}
+	if member.Role == models.OrgOwner {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The owner's role cannot be changed; transfer ownership instead"})
+	}
+
+	if _, err := services.SetOrganizationMemberRole(ctx, orgID, memberID, req.Role); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update member"})
+	}
+
+	event := newOrganizationAuditEvent(c, "organization.member_role_changed", orgID.Hex())
+	event.Changes = map[string]models.AuditChange{"role": {Before: string(member.Role), After: string(req.Role)}}
+	event.Metadata = map[string]string{"user_id": memberID.Hex()}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Member updated successfully"})
+}
+
+// RemoveOrganizationMemberHandler removes a member from an organization. Admins may only remove staff.
+func RemoveOrganizationMemberHandler(c *fiber.Ctx) error {
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	if memberID.Hex() == c.Locals("userID") {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Use the leave endpoint to leave an organization"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	member, err := services.FindOrganizationMember(ctx, orgID, memberID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve member"})
+	}
+	if member.Role == models.OrgOwner {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The owner cannot be removed; transfer ownership first"})
+	}
+	if member.Role == models.OrgAdmin && actingOrgRole(c) != models.OrgOwner {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only the owner can remove admins"})
+	}
+
+	if _, err := services.RemoveOrganizationMembers(ctx, bson.M{"organization_id": orgID, "user_id": memberID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+
+	event := newOrganizationAuditEvent(c, "organization.member_removed", orgID.Hex())
+	event.Metadata = map[string]string{"user_id": memberID.Hex(), "role": string(member.Role)}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Member removed successfully"})
+}
+
+// LeaveOrganizationHandler removes the signed-in user from an organization. The owner has to transfer ownership first.
+func LeaveOrganizationHandler(c *fiber.Ctx) error {
+	if actingOrgRole(c) == models.OrgOwner {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The owner cannot leave; transfer ownership first"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	if _, err := services.RemoveOrganizationMembers(ctx, bson.M{"organization_id": orgID, "user_id": userID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to leave organization"})
+	}
+
+	audit.Record(newOrganizationAuditEvent(c, "organization.member_left", orgID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "You have left the organization"})
+}
+
+// TransferOrganizationOwnershipHandler makes another member the owner; the previous owner becomes an admin
+func TransferOrganizationOwnershipHandler(c *fiber.Ctx) error {
+	type TransferOwnershipRequest struct {
+		UserID string `json:"user_id"`
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	newOwnerID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	orgID, _ := primitive.ObjectIDFromHex(c.Locals("orgID").(string))
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	members, err := services.OrganizationMembers(ctx, orgID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve members"})
+	}
+
+	// Find the current owner, and make sure the new one is already a member
+	var owner, newOwner *models.OrganizationMember
+	for i := range members {
+		if members[i].Role == models.OrgOwner {
+			owner = &members[i]
+		}
+		if members[i].UserID == newOwnerID {
+			newOwner = &members[i]
+		}
+	}
+	if newOwner == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "The new owner must be a member of the organization"})
+	}
+	if owner == nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Organization has no owner"})
+	}
+	if owner.UserID == newOwnerID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "This member is already the owner"})
+	}
+
+	// Ownership carries the merchant's rights, so it can only pass to another merchant account
+	var user models.User
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	err = collection.FindOne(ctx, bson.M{"_id": newOwnerID, "role": models.Merchant, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "The new owner must be an active merchant account"})
+	}
+
+	err = services.TransferOrganizationOwnership(ctx, orgID, owner.UserID, newOwnerID)
+	if errors.Is(err, services.ErrOwnershipChanged) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The organization's members changed; try again"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to transfer ownership"})
+	}
+
+	event := newOrganizationAuditEvent(c, "organization.ownership_transferred", orgID.Hex())
+	event.Changes = map[string]models.AuditChange{"owner": {Before: owner.UserID.Hex(), After: newOwnerID.Hex()}}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Ownership transferred successfully"})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SendPhoneVerificationHandler texts a verification code to the signed-in user's phone number
+func SendPhoneVerificationHandler(c *fiber.Ctx) error {
+	if !libs.SMSEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Phone verification is not available"})
+	}
+	cfg := config.FromContext(c)
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	user, err := currentPhoneUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.PhoneNumber == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Add a phone number to your profile first"})
+	}
+
+	// Numbers saved before they were validated are normalized now
+	phone, err := utils.NormalizePhoneNumber(user.PhoneNumber, cfg.SMS.DefaultCountryCode)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Phone number is invalid; update it with its country code, e.g. +60123456789"})
+	}
+	if user.PhoneVerified && phone == user.PhoneNumber {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Phone number is already verified"})
+	}
+	if phone != user.PhoneNumber {
+		collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"phone_number": phone}}); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update phone number"})
+		}
+	}
+
+	code, _, err := services.IssueSMSCode(ctx, cfg.SMS.CodeTTL, models.SMSCode{
+		UserID:      user.ID,
+		Purpose:     models.SMSVerifyPhone,
+		PhoneNumber: phone,
+	})
+	if err != nil {
+		return smsCodeError(c, err)
+	}
+
+	if err := libs.SendSMS(ctx, phone, smsCodeMessage(code, cfg.SMS.CodeTTL)); err != nil {
+		logger.FromContext(c).Error("Failed to send verification code", "user_id", user.ID.Hex(), "error", err)
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "Failed to send text message"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":      "Verification code sent",
+		"phone_number": utils.MaskPhoneNumber(phone),
+		"expires_in":   int(cfg.SMS.CodeTTL.Seconds()),
+	})
+}
+
+// VerifyPhoneHandler marks the signed-in user's phone number as verified when the code they received matches
+func VerifyPhoneHandler(c *fiber.Ctx) error {
+	type VerifyPhoneRequest struct {
+		Code string `json:"code"`
+	}
+
+	var req VerifyPhoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := currentPhoneUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	smsCode, err := services.CheckSMSCode(ctx, bson.M{"user_id": user.ID, "purpose": models.SMSVerifyPhone}, req.Code)
+	if err != nil && !errors.Is(err, services.ErrSMSCodeInvalid) {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check code"})
+	}
+	// The code only proves the number it was sent to
+	if err != nil || smsCode.PhoneNumber != user.PhoneNumber {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"phone_verified": true, "phone_verified_at": now, "updated_at": now}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID, "phone_number": smsCode.PhoneNumber}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify phone number"})
+	}
+
+	audit.Record(newUserAuditEvent(c, "user.phone_verified", user.ID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Phone number successfully verified"})
+}
+
+// SetSMSCodeRequiredHandler turns SMS code confirmation of the signed-in user's sign-ins on or off
+func SetSMSCodeRequiredHandler(c *fiber.Ctx) error {
+	type SMSCodeRequiredRequest struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	var req SMSCodeRequiredRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, err := currentPhoneUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if req.Enabled && (!user.PhoneVerified || !libs.SMSEnabled()) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Verify your phone number before turning on SMS codes"})
+	}
+
+	update := bson.M{"$set": bson.M{"sms_code_required": true, "updated_at": time.Now()}}
+	action := "user.sms_code_required_enabled"
+	if !req.Enabled {
+		update = bson.M{"$unset": bson.M{"sms_code_required": ""}, "$set": bson.M{"updated_at": time.Now()}}
+		action = "user.sms_code_required_disabled"
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update SMS codes"})
+	}
+
+	audit.Record(newUserAuditEvent(c, action, user.ID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "SMS codes updated", "sms_code_required": req.Enabled})
+}
+
+// VerifySMSSignInHandler completes a sign-in that asked for an SMS code, returning the same response as SignInHandler
+func VerifySMSSignInHandler(c *fiber.Ctx) error {
+	type VerifySMSSignInRequest struct {
+		Session string `json:"session"`
+		Code    string `json:"code"`
+
+		// AcceptTermsVersion accepts the current terms version when sign-in requires it
+		AcceptTermsVersion string `json:"accept_terms_version"`
+	}
+
+	var req VerifySMSSignInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	smsCode, err := services.CheckSMSCode(ctx, bson.M{"token_hash": services.HashOAuthSecret(req.Session), "purpose": models.SMSSignIn}, req.Code)
+	if err != nil && !errors.Is(err, services.ErrSMSCodeInvalid) {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check code"})
+	}
+	if err != nil {
+		recordSignIn(c, nil, "", "sms", "bad_sms_code")
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": smsCode.UserID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	method := smsCode.FirstMethod + "+sms"
+	if blocked, err := signInBlocked(ctx, c, user, user.Email, method, req.AcceptTermsVersion); blocked {
+		return err
+	}
+
+	return signInResponse(c, user, user.Email, method)
+}
+
+// smsVerificationResponse texts a code to a user who turned on SMS codes, to confirm a sign-in
+func smsVerificationResponse(c *fiber.Ctx, user models.User, email, method string) error {
+	cfg := config.FromContext(c)
+	if !libs.SMSEnabled() {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Text messages cannot be sent right now"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	code, session, err := services.IssueSMSCode(ctx, cfg.SMS.CodeTTL, models.SMSCode{
+		UserID:      user.ID,
+		Purpose:     models.SMSSignIn,
+		PhoneNumber: user.PhoneNumber,
+		FirstMethod: method,
+	})
+	if err != nil {
+		return smsCodeError(c, err)
+	}
+
+	if err := libs.SendSMS(ctx, user.PhoneNumber, smsCodeMessage(code, cfg.SMS.CodeTTL)); err != nil {
+		logger.FromContext(c).Error("Failed to send sign-in code", "user_id", user.ID.Hex(), "error", err)
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "Failed to send text message"})
+	}
+
+	recordSignIn(c, &user, email, method, "sms_code_required")
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":           "SMS code required",
+		"sms_code_required": true,
+		"session":           session,
+		"phone_number":      utils.MaskPhoneNumber(user.PhoneNumber),
+		"expires_in":        int(cfg.SMS.CodeTTL.Seconds()),
+	})
+}
+
+// smsCodeError responds to a code that could not be issued
+func smsCodeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSMSCodeCooldown):
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "A code was sent moments ago, please wait before requesting another",
+			"retry_after": int(services.SMSCodeCooldown.Seconds()),
+		})
+	case errors.Is(err, services.ErrSMSCodeLimit):
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many codes requested, please try again later"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create code"})
+}
+
+// smsCodeMessage is the text message that carries a code
+func smsCodeMessage(code string, ttl time.Duration) string {
+	return "Your TalentDev ID code is " + code + ". It expires in " + minutesText(ttl) + ". Never share it with anyone."
+}
+
+// currentPhoneUser loads the signed-in user
+func currentPhoneUser(ctx context.Context, c *fiber.Ctx) (*models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": userID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/database/databasetest"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testPhoneNumber = "+60123456789"
+
+// newPhoneTestApp serves the phone verification routes signed in as a new user with an unverified phone number.
+// Text messages are appended to the returned file.
+func newPhoneTestApp(t *testing.T) (*fiber.App, models.User, string) {
+	t.Helper()
+	databasetest.Connect(t)
+
+	user := newTestUser(t, models.Merchant)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"phone_number": testPhoneNumber}}); err != nil {
+		t.Fatal(err)
+	}
+	user.PhoneNumber = testPhoneNumber
+
+	smsFile := filepath.Join(t.TempDir(), "sms.ndjson")
+	if err := libs.StartSMS(config.SMSConfig{Provider: config.SMSProviderLog, FilePath: smsFile}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { libs.CloseSMS() })
+
+	signedIn := func(c *fiber.Ctx) error {
+		c.Locals("userID", user.ID.Hex())
+		return c.Next()
+	}
+
+	app := fiber.New()
+	app.Use(config.Middleware(config.Default()))
+	app.Post("/phone/verification", signedIn, SendPhoneVerificationHandler)
+	app.Post("/phone/verify", signedIn, VerifyPhoneHandler)
+	return app, user, smsFile
+}
+
+var smsCodePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// sentSMSCodes reads the codes texted to the test phone number from the log sender's file, oldest first
+func sentSMSCodes(t *testing.T, smsFile string) []string {
+	t.Helper()
+
+	file, err := os.Open(smsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var codes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message struct {
+			To      string `json:"to"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.To == testPhoneNumber {
+			codes = append(codes, smsCodePattern.FindString(message.Message))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+// sendPhoneCode asks for a code, returning the status code and the code texted, if any
+func sendPhoneCode(t *testing.T, app *fiber.App, smsFile string) (int, string) {
+	t.Helper()
+
+	before := len(sentSMSCodes(t, smsFile))
+	status := postJSON(t, app, "/phone/verification", nil, nil)
+	codes := sentSMSCodes(t, smsFile)
+	if len(codes) == before {
+		return status, ""
+	}
+	return status, codes[len(codes)-1]
+}
+
+func verifyPhone(t *testing.T, app *fiber.App, code string) int {
+	t.Helper()
+	return postJSON(t, app, "/phone/verify", fiber.Map{"code": code}, nil)
+}
+
+// backdateSMSCodes makes the user's codes look as if they were sent age ago
+func backdateSMSCodes(t *testing.T, userID primitive.ObjectID, age time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sms_codes")
+	if _, err := collection.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{"created_at": time.Now().Add(-age)}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wrongSMSCode returns a well-formed code other than code
+func wrongSMSCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestPhoneVerification(t *testing.T) {
+	app, user, smsFile := newPhoneTestApp(t)
+
+	status, code := sendPhoneCode(t, app, smsFile)
+	if status != http.StatusOK || code == "" {
+		t.Fatalf("sending a code returned %d and texted %q", status, code)
+	}
+	if status := verifyPhone(t, app, wrongSMSCode(code)); status != http.StatusBadRequest {
+		t.Errorf("wrong code returned %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := verifyPhone(t, app, code); status != http.StatusOK {
+		t.Fatalf("right code returned %d", status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var verified models.User
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if err := collection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if !verified.PhoneVerified {
+		t.Error("phone number not marked verified")
+	}
+
+	// A code works once
+	if status := verifyPhone(t, app, code); status != http.StatusBadRequest {
+		t.Errorf("spent code returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPhoneVerificationCooldown(t *testing.T) {
+	app, user, smsFile := newPhoneTestApp(t)
+
+	if status, _ := sendPhoneCode(t, app, smsFile); status != http.StatusOK {
+		t.Fatalf("sending a code returned %d", status)
+	}
+	if status, code := sendPhoneCode(t, app, smsFile); status != http.StatusTooManyRequests || code != "" {
+		t.Errorf("second code within the cooldown returned %d and texted %q, want %d and no message", status, code, http.StatusTooManyRequests)
+	}
+
+	backdateSMSCodes(t, user.ID, services.SMSCodeCooldown)
+	if status, _ := sendPhoneCode(t, app, smsFile); status != http.StatusOK {
+		t.Errorf("code after the cooldown returned %d", status)
+	}
+}
+
+func TestPhoneVerificationHourlyLimit(t *testing.T) {
+	app, user, smsFile := newPhoneTestApp(t)
+
+	for i := 0; i < 5; i++ {
+		if status, _ := sendPhoneCode(t, app, smsFile); status != http.StatusOK {
+			t.Fatalf("code %d returned %d", i+1, status)
+		}
+		backdateSMSCodes(t, user.ID, 2*services.SMSCodeCooldown)
+	}
+	if status, code := sendPhoneCode(t, app, smsFile); status != http.StatusTooManyRequests || code != "" {
+		t.Errorf("sixth code in an hour returned %d and texted %q, want %d and no message", status, code, http.StatusTooManyRequests)
+	}
+	if n := len(sentSMSCodes(t, smsFile)); n != 5 {
+		t.Errorf("%d messages sent, want 5", n)
+	}
+
+	backdateSMSCodes(t, user.ID, time.Hour+time.Minute)
+	if status, _ := sendPhoneCode(t, app, smsFile); status != http.StatusOK {
+		t.Errorf("code an hour later returned %d", status)
+	}
+}
+
+func TestPhoneVerificationAttemptLimit(t *testing.T) {
+	app, _, smsFile := newPhoneTestApp(t)
+
+	status, code := sendPhoneCode(t, app, smsFile)
+	if status != http.StatusOK || code == "" {
+		t.Fatalf("sending a code returned %d and texted %q", status, code)
+	}
+	for i := 0; i < 5; i++ {
+		if status := verifyPhone(t, app, wrongSMSCode(code)); status != http.StatusBadRequest {
+			t.Fatalf("wrong code returned %d", status)
+		}
+	}
+	if status := verifyPhone(t, app, code); status != http.StatusBadRequest {
+		t.Errorf("right code after five wrong guesses returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPhoneVerificationNewCodeReplacesOld(t *testing.T) {
+	app, user, smsFile := newPhoneTestApp(t)
+
+	_, first := sendPhoneCode(t, app, smsFile)
+	backdateSMSCodes(t, user.ID, services.SMSCodeCooldown)
+	_, second := sendPhoneCode(t, app, smsFile)
+	if first == "" || second == "" {
+		t.Fatalf("codes texted were %q and %q", first, second)
+	}
+	if first == second {
+		t.Skip("the same code was drawn twice")
+	}
+
+	if status := verifyPhone(t, app, first); status != http.StatusBadRequest {
+		t.Errorf("replaced code returned %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := verifyPhone(t, app, second); status != http.StatusOK {
+		t.Errorf("new code returned %d", status)
+	}
+}
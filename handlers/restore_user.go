@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RestoreUserHandler restores a soft-deleted user while the retention period has not ended
+func RestoreUserHandler(c *fiber.Ctx) error {
+	// Extract the user ID from the request URL parameters
+	userID := c.Params("id")
+
+	// Convert the userID string to a MongoDB ObjectID
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Get a reference to the "users" collection in the MongoDB database
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// Create a context with a timeout for the database operation
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Find the deleted user by ID
+	var user models.User
+	err = collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": true}}).Decode(&user)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Deleted user not found"})
+	}
+
+	// Anonymized users or users past their retention period can no longer be restored
+	if user.AnonymizedAt != nil || time.Since(*user.DeletedAt) > config.FromContext(c).Retention.UserRetentionPeriod() {
+		return c.Status(http.StatusGone).JSON(fiber.Map{"error": "Retention period has ended, user cannot be restored"})
+	}
+
+	// Clear the deletion markers and give back the user's organization memberships
+	memberships, err := services.RestoreUser(ctx, user)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore user"})
+	}
+
+	// Record who restored the user
+	event := newUserAuditEvent(c, "user.restored", userID)
+	event.Metadata = map[string]string{"memberships_restored": strconv.Itoa(memberships)}
+	audit.Record(event)
+
+	// Return a success message
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User restored successfully"})
+}
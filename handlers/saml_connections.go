@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/samlsso"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateSAMLConnectionHandler registers an organization's SAML identity provider from its metadata XML or metadata URL
+func CreateSAMLConnectionHandler(c *fiber.Ctx) error {
+	type CreateConnectionRequest struct {
+		Slug             string                       `json:"slug"`
+		Organization     string                       `json:"organization"`
+		Domains          []string                     `json:"domains"`
+		AttributeMapping *models.SAMLAttributeMapping `json:"attribute_mapping"`
+		IdPMetadata      string                       `json:"idp_metadata"`
+		IdPMetadataURL   string                       `json:"idp_metadata_url"`
+	}
+
+	var req CreateConnectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	// Validate the connection
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !validSlug(req.Slug) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "slug must use lowercase letters, digits and dashes"})
+	}
+	if strings.TrimSpace(req.Organization) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "organization is required"})
+	}
+	domains, errMessage := normalizeSAMLDomains(ctx, req.Domains, "")
+	if errMessage != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": errMessage})
+	}
+
+	// Download the metadata when only its URL was given
+	metadata := []byte(req.IdPMetadata)
+	if req.IdPMetadata == "" && req.IdPMetadataURL != "" {
+		fetched, err := samlsso.FetchIdPMetadata(ctx, req.IdPMetadataURL)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to download metadata: " + err.Error()})
+		}
+		metadata = fetched
+	}
+	idpMetadata, err := samlsso.ParseIdPMetadata(metadata)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid identity provider metadata: " + err.Error()})
+	}
+
+	mapping := samlsso.DefaultAttributeMapping()
+	if req.AttributeMapping != nil {
+		mapping = *req.AttributeMapping
+	}
+
+	connection := models.SAMLConnection{
+		ID:               primitive.NewObjectID(),
+		Slug:             req.Slug,
+		Organization:     strings.TrimSpace(req.Organization),
+		Domains:          domains,
+		IdPEntityID:      idpMetadata.EntityID,
+		IdPMetadata:      string(metadata),
+		AttributeMapping: mapping,
+		CreatedBy:        c.Locals("userID").(string),
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+	if _, err := collection.InsertOne(ctx, connection); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A connection with this slug already exists"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create connection"})
+	}
+
+	recordSAMLConnectionEvent(c, "saml.connection_created", connection.Slug)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message":    "SAML connection created successfully",
+		"connection": connection,
+		"sp": fiber.Map{
+			"metadata_url": samlServiceProviderURL(c, connection.Slug) + "/metadata",
+			"acs_url":      samlServiceProviderURL(c, connection.Slug) + "/acs",
+		},
+	})
+}
+
+// ListSAMLConnectionsHandler lists the SAML connections by organization
+func ListSAMLConnectionsHandler(c *fiber.Ctx) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"organization": 1}))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve connections"})
+	}
+	defer cursor.Close(ctx)
+
+	connections := []models.SAMLConnection{}
+	if err := cursor.All(ctx, &connections); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode connections"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"connections": connections})
+}
+
+// UpdateSAMLConnectionHandler changes a connection's organization name, domains or attribute mapping
+func UpdateSAMLConnectionHandler(c *fiber.Ctx) error {
+	type UpdateConnectionRequest struct {
+		Organization     *string                      `json:"organization"`
+		Domains          []string                     `json:"domains"`
+		AttributeMapping *models.SAMLAttributeMapping `json:"attribute_mapping"`
+	}
+
+	var req UpdateConnectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"updated_at": time.Now()}
+	if req.Organization != nil {
+		if strings.TrimSpace(*req.Organization) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "organization cannot be empty"})
+		}
+		update["organization"] = strings.TrimSpace(*req.Organization)
+	}
+	if req.Domains != nil {
+		domains, errMessage := normalizeSAMLDomains(ctx, req.Domains, c.Params("slug"))
+		if errMessage != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": errMessage})
+		}
+		update["domains"] = domains
+	}
+	if req.AttributeMapping != nil {
+		update["attribute_mapping"] = *req.AttributeMapping
+	}
+
+	return updateSAMLConnection(ctx, c, update, "saml.connection_updated")
+}
+
+// UploadSAMLMetadataHandler replaces a connection's identity provider metadata, e.g. after a certificate rollover.
+// The metadata XML is sent as the request body or as a "metadata" file upload.
+func UploadSAMLMetadataHandler(c *fiber.Ctx) error {
+	metadata := c.Body()
+	if file, err := c.FormFile("metadata"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot read uploaded file"})
+		}
+		defer opened.Close()
+
+		if metadata, err = io.ReadAll(opened); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot read uploaded file"})
+		}
+	}
+
+	idpMetadata, err := samlsso.ParseIdPMetadata(metadata)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid identity provider metadata: " + err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"idp_entity_id": idpMetadata.EntityID,
+		"idp_metadata":  string(metadata),
+		"updated_at":    time.Now(),
+	}
+	return updateSAMLConnection(ctx, c, update, "saml.metadata_updated")
+}
+
+// DeleteSAMLConnectionHandler removes a connection; its users keep their accounts but can no longer sign in through it
+func DeleteSAMLConnectionHandler(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"slug": slug})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete connection"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+
+	recordSAMLConnectionEvent(c, "saml.connection_deleted", slug)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "SAML connection deleted successfully"})
+}
+
+// updateSAMLConnection applies an update to the connection named in the URL and returns the result
+func updateSAMLConnection(ctx context.Context, c *fiber.Ctx, update bson.M, action string) error {
+	slug := c.Params("slug")
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+
+	var connection models.SAMLConnection
+	err := collection.FindOneAndUpdate(ctx, bson.M{"slug": slug}, bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&connection)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update connection"})
+	}
+
+	recordSAMLConnectionEvent(c, action, slug)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "SAML connection updated successfully", "connection": connection})
+}
+
+// normalizeSAMLDomains lowercases the domains and checks that no other connection claims them
+func normalizeSAMLDomains(ctx context.Context, domains []string, slug string) ([]string, string) {
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "@/ ") || !strings.Contains(domain, ".") {
+			return nil, "Invalid domain: " + domain
+		}
+
+		existing, err := services.FindSAMLConnectionByDomain(ctx, domain)
+		if err == nil && existing.Slug != slug {
+			return nil, "Domain " + domain + " is already used by the " + existing.Organization + " connection"
+		}
+		normalized = append(normalized, domain)
+	}
+	return normalized, ""
+}
+
+// validSlug reports whether slug is safe to use in a URL path segment
+func validSlug(slug string) bool {
+	if slug == "" {
+		return false
+	}
+	for _, r := range slug {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// recordSAMLConnectionEvent audits a change to a SAML connection
+func recordSAMLConnectionEvent(c *fiber.Ctx, action, slug string) {
+	event := audit.NewEvent(c, action)
+	event.TargetType = "saml_connection"
+	event.TargetID = slug
+	audit.Record(event)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/samlsso"
+	"myfibergotemplate/services"
+
+	"github.com/crewjam/saml"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SAMLMetadataHandler serves the service provider metadata an organization uploads to its identity provider
+func SAMLMetadataHandler(c *fiber.Ctx) error {
+	sp, _, err := samlServiceProvider(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build metadata"})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Status(http.StatusOK).Send(metadata)
+}
+
+// SAMLLoginHandler sends the browser to the organization's identity provider with a signed authentication request
+func SAMLLoginHandler(c *fiber.Ctx) error {
+	sp, connection, err := samlServiceProvider(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	redirectURL, err := services.StartSAMLLogin(ctx, sp, connection.Slug)
+	if err != nil {
+		logger.FromContext(c).Error("Failed to start SAML login", "connection", connection.Slug, "error", err)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"provider_unavailable"}})
+	}
+
+	return c.Redirect(redirectURL, http.StatusFound)
+}
+
+// SAMLACSHandler is the assertion consumer service. It checks the response's signature, audience, recipient,
+// validity window and that it answers a request we sent, then signs the user in like a federated login.
+func SAMLACSHandler(c *fiber.Ctx) error {
+	sp, connection, err := samlServiceProvider(c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Connection not found"})
+	}
+	provider := "saml:" + connection.Slug
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 15*time.Second)
+	defer cancel()
+
+	// Only responses to our own requests are accepted; identity provider initiated logins are not supported
+	request, err := services.ConsumeSAMLRequest(ctx, connection.Slug, c.FormValue("RelayState"))
+	if err != nil {
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"invalid_state"}})
+	}
+
+	rawResponse, err := base64.StdEncoding.DecodeString(c.FormValue("SAMLResponse"))
+	if err != nil {
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"provider_error"}, "provider": {provider}})
+	}
+
+	assertion, err := sp.ParseXMLResponse(rawResponse, []string{request.RequestID})
+	if err != nil {
+		// The library hides the reason from Error(); log it for whoever sets up the connection
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		logger.FromContext(c).Warn("Rejected SAML response", "connection", connection.Slug, "error", err)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"provider_error"}, "provider": {provider}})
+	}
+
+	identity, err := samlsso.Identity(*connection, assertion)
+	if err != nil {
+		logger.FromContext(c).Warn("Rejected SAML assertion", "connection", connection.Slug, "error", err)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"provider_error"}, "provider": {provider}})
+	}
+
+	user, err := resolveFederatedUser(ctx, c, identity)
+	if err != nil {
+		code := err.Error()
+		if !errors.Is(err, errFederatedEmailMissing) && !errors.Is(err, errFederatedAccountExists) && !errors.Is(err, errFederatedAccountGone) {
+			logger.FromContext(c).Error("Failed to complete SAML login", "connection", connection.Slug, "error", err)
+			code = "server_error"
+		}
+		recordSignIn(c, nil, identity.Email, provider, code)
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {code}, "provider": {provider}})
+	}
+
+	loginCode, err := services.NewFederatedLoginCode(ctx, user.ID, provider)
+	if err != nil {
+		return federatedRedirect(c, models.FederatedLogin, url.Values{"error": {"server_error"}})
+	}
+	return federatedRedirect(c, models.FederatedLogin, url.Values{"code": {loginCode}, "provider": {provider}})
+}
+
+// SAMLDiscoverHandler finds the single sign-on connection for an email address, so the sign-in page can offer it
+func SAMLDiscoverHandler(c *fiber.Ctx) error {
+	_, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(c.Query("email"))), "@")
+	if !ok || domain == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A valid email is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	connection, err := services.FindSAMLConnectionByDomain(ctx, domain)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No single sign-on connection for this domain"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"organization": connection.Organization,
+		"login_url":    samlServiceProviderURL(c, connection.Slug) + "/login",
+	})
+}
+
+// samlServiceProvider loads the connection named in the URL and its service provider
+func samlServiceProvider(c *fiber.Ctx) (*saml.ServiceProvider, *models.SAMLConnection, error) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	connection, err := services.FindSAMLConnection(ctx, c.Params("slug"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sp, err := samlsso.ServiceProvider(*connection, config.FromContext(c).Server.BackendURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, connection, nil
+}
+
+// samlServiceProviderURL is the base URL of a connection's service provider endpoints
+func samlServiceProviderURL(c *fiber.Ctx, slug string) string {
+	return config.FromContext(c).Server.BackendURL + "/saml/" + slug
+}
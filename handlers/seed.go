@@ -2,24 +2,27 @@ package handlers
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/config"
 	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
 	"myfibergotemplate/models"
+	"myfibergotemplate/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // SeedAdminHandler seeds an admin user into the database
 func SeedAdminHandler(c *fiber.Ctx) error {
-	// Retrieve the expected seed token from the environment variables
-	expectedToken := config.GetEnv("ADMIN_SEED_TOKEN", "")
+	cfg := config.FromContext(c)
+
+	// Retrieve the expected seed token from the configuration
+	expectedToken := cfg.Admin.SeedToken
 	if expectedToken == "" {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Admin seed token not configured"})
 	}
@@ -27,12 +30,16 @@ func SeedAdminHandler(c *fiber.Ctx) error {
 	// Extract the token from the request header
 	providedToken := c.Get("X-Admin-Seed-Token")
 	if providedToken != expectedToken {
+		event := audit.NewEvent(c, "admin.seeded")
+		event.Outcome = models.AuditFailure
+		event.Metadata = map[string]string{"reason": "invalid_seed_token"}
+		audit.Record(event)
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized access"})
 	}
 
-	// Retrieve admin email and password from the environment variables
-	adminEmail := config.GetEnv("ADMIN_EMAIL", "admin@example.com")
-	adminPassword := config.GetEnv("ADMIN_PASSWORD", "securepassword")
+	// Retrieve admin email and password from the configuration
+	adminEmail := cfg.Admin.Email
+	adminPassword := cfg.Admin.Password
 	adminName := "Admin User"
 	adminRole := models.Administrator
 	adminStatus := models.Approved
@@ -40,18 +47,22 @@ func SeedAdminHandler(c *fiber.Ctx) error {
 	// Check if the admin user already exists
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	var existingUser models.User
 	err := collection.FindOne(ctx, bson.M{"email": adminEmail}).Decode(&existingUser)
 	if err == nil {
 		// If the admin user already exists, return a message
+		event := newUserAuditEvent(c, "admin.seeded", existingUser.ID.Hex())
+		event.Outcome = models.AuditFailure
+		event.Metadata = map[string]string{"reason": "already_exists"}
+		audit.Record(event)
 		return c.Status(http.StatusConflict).JSON(fiber.Map{"message": "Admin user already exists"})
 	}
 
 	// Hash the admin's password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(ctx, adminPassword)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
 	}
@@ -59,17 +70,14 @@ func SeedAdminHandler(c *fiber.Ctx) error {
 	// Create the admin user object
 	adminUser := models.User{
 		ID:                 primitive.NewObjectID(),
-		MerchantName:       adminName,
 		Email:              adminEmail,
-		Password:           string(hashedPassword),
+		Password:           hashedPassword,
 		Role:               adminRole,
 		Status:             adminStatus,
 		EmailStatus:        true, // Email is verified
 		PersonInCharge:     adminName,
-		PhoneNumber:        "123456789",                 // Example phone number
-		Website:            "https://admin.example.com", // Example website
-		Address:            "123 Admin Street",          // Example address
-		TermsAndConditions: true,                        // Assume admin accepted terms
+		PhoneNumber:        "123456789", // Example phone number
+		TermsAndConditions: true,        // Assume admin accepted terms
 		CreatedAt:          time.Now(),
 		UpdatedAt:          time.Now(),
 	}
@@ -77,10 +85,13 @@ func SeedAdminHandler(c *fiber.Ctx) error {
 	// Insert the admin user into the database
 	_, err = collection.InsertOne(ctx, adminUser)
 	if err != nil {
-		log.Println("Failed to insert admin user:", err)
+		logger.FromContext(c).Error("Failed to insert admin user", "error", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to seed admin user"})
 	}
 
+	// Record the seeding of the admin user
+	audit.Record(newUserAuditEvent(c, "admin.seeded", adminUser.ID.Hex()))
+
 	// Return a success message
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Admin user seeded successfully"})
 }
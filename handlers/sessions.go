@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"html"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/geoip"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxUserAgentLength = 512 // Longer user agents are cut when stored on a session
+
+// ListSessionsHandler returns the signed-in user's active sessions, marking the one making the request
+func ListSessionsHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := services.SessionsForUser(ctx, userID, false)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve sessions"})
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == c.Locals("sessionID")
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"sessions": sessions})
+}
+
+// RevokeSessionHandler signs one of the signed-in user's devices out, which may be the current one
+func RevokeSessionHandler(c *fiber.Ctx) error {
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := services.RevokeSessions(ctx, bson.M{"_id": sessionID, "user_id": userID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	if revoked == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	event := newUserAuditEvent(c, "user.session_revoked", userID.Hex())
+	event.Metadata = map[string]string{"session_id": sessionID.Hex()}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessionsHandler signs the signed-in user out everywhere except the device making the request
+func RevokeOtherSessionsHandler(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID}
+	if current, ok := c.Locals("sessionID").(string); ok {
+		currentID, _ := primitive.ObjectIDFromHex(current)
+		filter["_id"] = bson.M{"$ne": currentID}
+	}
+
+	revoked, err := services.RevokeSessions(ctx, filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+
+	audit.Record(newUserAuditEvent(c, "user.sessions_revoked", userID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Other sessions revoked successfully", "revoked": revoked})
+}
+
+// RevokeUserSessionsHandler signs a user out on every device (Admin only)
+func RevokeUserSessionsHandler(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Err(); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	revoked, err := services.RevokeSessions(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+
+	audit.Record(newUserAuditEvent(c, "user.sessions_revoked", userID))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Sessions revoked successfully", "revoked": revoked})
+}
+
+// SignOutHandler ends the session making the request and clears the session cookie
+func SignOutHandler(c *fiber.Ctx) error {
+	cfg := config.FromContext(c)
+
+	if current, ok := c.Locals("sessionID").(string); ok {
+		sessionID, err := primitive.ObjectIDFromHex(current)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		if _, err := services.RevokeSessions(ctx, bson.M{"_id": sessionID}); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to sign out"})
+		}
+	}
+
+	if cfg.Auth.CookieMode {
+		setSessionCookie(c, cfg, "", time.Unix(0, 0))
+	}
+
+	audit.Record(audit.NewEvent(c, "auth.signout"))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Signed out successfully"})
+}
+
+// CSRFTokenHandler returns the CSRF token of the session in the cookie, for pages loaded after sign-in
+func CSRFTokenHandler(c *fiber.Ctx) error {
+	current, ok := c.Locals("sessionID").(string)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "This session does not use CSRF tokens"})
+	}
+	sessionID, err := primitive.ObjectIDFromHex(current)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	csrfToken := services.SessionCSRFToken(config.FromContext(c).Auth.JWTSecret, sessionID)
+	return c.Status(http.StatusOK).JSON(fiber.Map{"csrf_token": csrfToken})
+}
+
+// setSessionCookie stores the session token in an HttpOnly cookie; an expiry in the past removes it
+func setSessionCookie(c *fiber.Ctx, cfg *config.Config, token string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     cfg.Auth.CookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   cfg.Auth.CookieDomain,
+		Expires:  expires,
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: cfg.Auth.CookieSameSite,
+	})
+}
+
+// startSession records the session of a user who signed in, and alerts them by email when it is on a new device
+func startSession(ctx context.Context, c *fiber.Ctx, user models.User, method string) (*models.Session, error) {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	// Devices are told apart by browser and operating system, so browser updates don't look like a new device
+	device := utils.DescribeUserAgent(userAgent)
+	session := &models.Session{
+		UserID:     user.ID,
+		DeviceHash: utils.HashVerificationToken(device),
+		DeviceName: device,
+		UserAgent:  userAgent,
+		IPAddress:  c.IP(),
+		Location:   geoip.Lookup(c.IP()),
+		Method:     method,
+	}
+
+	newDevice, err := services.StartSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.FromContext(c)
+	if newDevice && cfg.Sessions.NewDeviceAlerts {
+		// The sign-in goes ahead even if the alert cannot be sent
+		if err := sendNewDeviceAlert(ctx, cfg, user, session); err != nil {
+			slog.Error("Failed to queue new device alert", "user_id", user.ID.Hex(), "error", err)
+		}
+	}
+	return session, nil
+}
+
+// sendNewDeviceAlert emails a user about a sign-in from a device they have not used before
+func sendNewDeviceAlert(ctx context.Context, cfg *config.Config, user models.User, session *models.Session) error {
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		return err
+	}
+
+	// Compose the email subject and body
+	emailSubject := "New sign-in to your account - TalentDev ID"
+	emailBody := `<p>Dear ` + user.MerchantName + `,</p>
+				  <p>Your TalentDev account was just signed in to from a new device:</p>
+				  <p>Device: ` + html.EscapeString(session.DeviceName) + `<br>
+				  Location: ` + html.EscapeString(geoip.Describe(session.Location)) + ` (` + session.IPAddress + `)<br>
+				  Time: ` + session.CreatedAt.UTC().Format("2 January 2006, 15:04 MST") + `</p>
+				  <p>If this was you, there is nothing to do. If not, sign this device out from the sessions page of your account
+				  at <a href="` + cfg.Server.FrontendURL + `">TalentDev</a> and change your password.</p>
+				  <p>Kind regards,<br>The TalentDev Team</p>`
+
+	return libs.QueueEmail(ctx, cfg.Email, []string{user.Email}, emailSubject, emailBody)
+}
@@ -3,16 +3,20 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/config"
 	"myfibergotemplate/database"
+	"myfibergotemplate/metrics"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+	"myfibergotemplate/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // SignInHandler handles user sign-in and checks their status
@@ -20,6 +24,9 @@ func SignInHandler(c *fiber.Ctx) error {
 	type SignInRequest struct {
 		Email    string `json:"email" validate:"required,email"`
 		Password string `json:"password" validate:"required"`
+
+		// AcceptTermsVersion accepts the current terms version when sign-in requires it
+		AcceptTermsVersion string `json:"accept_terms_version"`
 	}
 
 	var signInReq SignInRequest
@@ -30,25 +37,47 @@ func SignInHandler(c *fiber.Ctx) error {
 
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel()
 
 	var user models.User
 
 	err := collection.FindOne(ctx, bson.M{"email": signInReq.Email}).Decode(&user)
 	if err != nil {
+		recordSignIn(c, nil, signInReq.Email, "password", "not_found")
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	// Deleted accounts cannot sign in, even during the retention period
+	if user.DeletedAt != nil {
+		recordSignIn(c, &user, signInReq.Email, "password", "deleted")
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"message":         "Account has been deleted",
+			"account_deleted": true,
+		})
+	}
+
 	// Compare the provided password with the stored hashed password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(signInReq.Password))
+	err = utils.CheckPassword(ctx, user.Password, signInReq.Password)
 	if err != nil {
+		recordSignIn(c, &user, signInReq.Email, "password", "bad_password")
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Incorrect password"})
 	}
 
+	if blocked, err := signInBlocked(ctx, c, user, signInReq.Email, "password", signInReq.AcceptTermsVersion); blocked {
+		return err
+	}
+
+	return signInResponse(c, user, signInReq.Email, "password")
+}
+
+// signInBlocked checks whether an authenticated user may sign in, accepting the current terms
+// when acceptTermsVersion names them. When sign-in is blocked it writes the response and returns true.
+func signInBlocked(ctx context.Context, c *fiber.Ctx, user models.User, email, method, acceptTermsVersion string) (bool, error) {
 	// Check if the user's email is verified
 	if !user.EmailStatus {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+		recordSignIn(c, &user, email, method, "unverified")
+		return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
 			"message":        "Email not verified",
 			"email_verified": false,
 		})
@@ -56,24 +85,75 @@ func SignInHandler(c *fiber.Ctx) error {
 
 	// Check if the user's account is approved
 	if user.Status != models.Approved {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+		recordSignIn(c, &user, email, method, "unapproved")
+		return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
 			"message":          "Account not approved",
 			"account_approved": false,
 			"email_verified":   true,
 		})
 	}
 
+	// Check if the user has to accept a new version of the terms and conditions
+	currentTerms, err := services.CurrentTermsVersion(ctx)
+	if err != nil {
+		return true, c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms version"})
+	}
+	if services.TermsAcceptanceRequired(user, currentTerms) {
+		if acceptTermsVersion != currentTerms.Version {
+			recordSignIn(c, &user, email, method, "terms_acceptance_required")
+			return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error":   "terms_acceptance_required",
+				"message": "The terms and conditions have changed and must be accepted",
+				"terms":   currentTerms,
+			})
+		}
+		if err := services.AcceptTerms(ctx, newTermsAcceptance(c, user.ID, currentTerms.Version, "signin")); err != nil {
+			return true, c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record terms acceptance"})
+		}
+	}
+
+	return false, nil
+}
+
+// signInResponse issues a session token to a user who passed every sign-in check
+func signInResponse(c *fiber.Ctx, user models.User, email, method string) error {
+	// Browser clients can ask for the session in a cookie rather than in the response body
+	cfg := config.FromContext(c)
+	cookieMode := c.Get("X-Auth-Mode") == "cookie"
+	if cookieMode && !cfg.Auth.CookieMode {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cookie mode is not enabled"})
+	}
+
+	// Users who turned on a second factor confirm the sign-in with it. A passkey also satisfies SMS codes.
+	switch {
+	case user.PasskeyRequired && !strings.HasSuffix(method, "passkey"):
+		return passkeyVerificationResponse(c, user, email, method)
+	case user.SMSCodeRequired && !strings.HasSuffix(method, "passkey") && !strings.HasSuffix(method, "+sms"):
+		return smsVerificationResponse(c, user, email, method)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Record the session, so the user can see where they are signed in and sign the device out
+	session, err := startSession(ctx, c, user, method)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start session"})
+	}
+
 	// Generate JWT token on successful login
-	token, err := generateJWTToken(user)
+	token, err := generateJWTToken(cfg, user, session)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
 
-	return c.Status(http.StatusOK).JSON(fiber.Map{
+	recordSignIn(c, &user, email, method, "success")
+	loadMerchantProfile(ctx, c, &user)
+
+	response := fiber.Map{
 		"message":          "Sign-in successful",
 		"email_verified":   true,
 		"account_approved": true,
-		"token":            token,
 		"user": fiber.Map{
 			"merchant_name":    user.MerchantName,
 			"email":            user.Email,
@@ -83,19 +163,61 @@ func SignInHandler(c *fiber.Ctx) error {
 			"website":          user.Website,
 			"address":          user.Address,
 		},
-	})
+	}
+
+	// In cookie mode the token never reaches the page; the page gets the CSRF token it must send instead
+	if cookieMode {
+		setSessionCookie(c, cfg, token, session.ExpiresAt)
+		response["csrf_token"] = services.SessionCSRFToken(cfg.Auth.JWTSecret, session.ID)
+	} else {
+		response["token"] = token
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// recordSignIn audits a sign-in attempt, how the user authenticated and the outcome
+func recordSignIn(c *fiber.Ctx, user *models.User, email, method, outcome string) {
+	metrics.SignIns.WithLabelValues(outcome).Inc()
+
+	action := "auth.signin"
+	if outcome != "success" {
+		action = "auth.signin_failed"
+	}
+
+	event := audit.NewEvent(c, action)
+	event.Metadata = map[string]string{"outcome": outcome, "method": method}
+	if user != nil {
+		event.ActorID = user.ID.Hex()
+		event.ActorRole = string(user.Role)
+		event.TargetType = "user"
+		event.TargetID = user.ID.Hex()
+	} else {
+		event.Metadata["email"] = email
+	}
+	if outcome != "success" {
+		event.Outcome = models.AuditFailure
+	}
+	audit.Record(event)
 }
 
-// generateJWTToken creates a JWT token for the authenticated user
-func generateJWTToken(user models.User) (string, error) {
-	secretKey := config.GetEnv("JWT_SECRET", "your_jwt_secret_key")
+// generateJWTToken creates a JWT token for the authenticated user's session
+func generateJWTToken(cfg *config.Config, user models.User, session *models.Session) (string, error) {
+	secretKey := cfg.Auth.JWTSecret
 
 	// Define the JWT claims
 	claims := jwt.MapClaims{
 		"id":    user.ID.Hex(),
 		"email": user.Email,
 		"role":  user.Role,
-		"exp":   time.Now().Add(time.Hour * 72).Unix(), // Token expiration time
+		"sid":   session.ID.Hex(),         // Session ID, checked on every request so the session can be revoked
+		"iat":   session.CreatedAt.Unix(), // Sign-in time, reported to OpenID Connect clients as auth_time
+		"exp":   session.ExpiresAt.Unix(), // Token expiration time
+	}
+
+	// Sessions started by an administrator impersonating the user name them as the actor
+	if session.ImpersonatorID != nil {
+		claims["act"] = map[string]string{"sub": session.ImpersonatorID.Hex()}
 	}
 
 	// Create the JWT token
@@ -1,21 +1,23 @@
 package handlers
 
 import (
-	"context"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/config"
 	"myfibergotemplate/database"
 	"myfibergotemplate/libs"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/metrics"
 	"myfibergotemplate/models"
+	"myfibergotemplate/services"
 	"myfibergotemplate/utils" // Import the utils package
 
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // SignupHandler handles the user signup process
@@ -33,16 +35,34 @@ func SignupHandler(c *fiber.Ctx) error {
 	user.Status = models.Pending      // Set the default status to "pending"
 	user.Role = models.Merchant       // Set the default role to "merchant"
 	user.EmailStatus = false          // Set the default email verification status to "false"
+	user.PhoneVerified = false        // Phone numbers are verified by SMS after signup
+	user.PhoneVerifiedAt = nil        // Clear any verification time sent by the client
+	user.PasskeyRequired = false      // Second factors are turned on once the user has one
+	user.SMSCodeRequired = false      // Likewise for SMS codes
+	user.TermsVersion = ""            // The accepted terms version is recorded below, not taken from the client
+	user.TermsAcceptedAt = nil        // Likewise for the acceptance time
+	user.DeletedAt = nil              // A new account is never deleted
+	user.DeletedBy = ""               // Nor deleted by anyone
+	user.AnonymizedAt = nil           // Nor anonymized
 	user.CreatedAt = time.Now()       // Set the current time as the creation time
 	user.UpdatedAt = time.Now()       // Set the current time as the last updated time
 
+	// Store the phone number in E.164 form so it can be verified by SMS
+	if user.PhoneNumber != "" {
+		phone, err := utils.NormalizePhoneNumber(user.PhoneNumber, config.FromContext(c).SMS.DefaultCountryCode)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid phone number; include the country code, e.g. +60123456789"})
+		}
+		user.PhoneNumber = phone
+	}
+
 	// Hash the user's password using bcrypt for secure storage
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(c.UserContext(), user.Password)
 	if err != nil {
 		// If there's an error hashing the password, return a 500 Internal Server Error
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
 	}
-	user.Password = string(hashedPassword) // Store the hashed password in the user object
+	user.Password = hashedPassword // Store the hashed password in the user object
 
 	// Generate a random token for email verification
 	verificationToken := utils.GenerateVerificationToken() // Use the utility function
@@ -52,24 +72,43 @@ func SignupHandler(c *fiber.Ctx) error {
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Insert the new user into the "users" collection
-	_, err = collection.InsertOne(context.Background(), user)
+	_, err = collection.InsertOne(c.UserContext(), user)
 	if err != nil {
 		// If there's an error inserting the user, return a 500 Internal Server Error
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
 	}
 
+	// Create the organization that holds the merchant's profile, with the new user as its owner.
+	// Without it the profile would be lost, so the signup is undone.
+	if err := services.CreateMerchantOrganization(c.UserContext(), *user); err != nil {
+		logger.FromContext(c).Error("Failed to create merchant organization", "user_id", user.ID.Hex(), "error", err)
+		collection.DeleteOne(c.UserContext(), bson.M{"_id": user.ID})
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
+	}
+
+	// Record the signup
+	metrics.Signups.Inc()
+	event := newUserAuditEvent(c, "user.signup", user.ID.Hex())
+	event.ActorID = user.ID.Hex()
+	audit.Record(event)
+
+	// Record which version of the terms and conditions the user accepted
+	if user.TermsAndConditions {
+		acceptCurrentTerms(c, *user, "signup")
+	}
+
 	// Prepare the email content for verification
-	backendURL := config.GetEnv("BACKEND_URL", "http://localhost:8080")       // Get the backend URL from the environment variables
-	verificationLink := backendURL + "/api/verify?token=" + verificationToken // Create the verification link with the token
+	cfg := config.FromContext(c)
+	verificationLink := cfg.Server.BackendURL + "/api/verify?token=" + verificationToken // Create the verification link with the token
 
 	emailSubject := "Email registration verification - TalentDev ID"
 	emailBody := buildVerificationEmail(user.MerchantName, verificationLink)
 
-	// Send email to the user for email verification
-	err = libs.SendEmail([]string{user.Email}, emailSubject, emailBody)
+	// Queue the verification email so the response doesn't wait for the mail server
+	err = libs.QueueEmail(c.UserContext(), cfg.Email, []string{user.Email}, emailSubject, emailBody)
 	if err != nil {
-		// If there's an error sending the email, log the error (but don't return it to the user)
-		log.Println("Failed to send verification email to user:", err)
+		// If the email cannot be queued, log the error (but don't return it to the user)
+		logger.FromContext(c).Error("Failed to queue verification email", "user_id", user.ID.Hex(), "email", user.Email, "error", err)
 	}
 
 	// Return a 201 Created status with a success message and the user's data
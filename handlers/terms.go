@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateTermsVersionHandler registers a new version of the terms and conditions
+func CreateTermsVersionHandler(c *fiber.Ctx) error {
+	var version models.TermsVersion
+	if err := c.BodyParser(&version); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if version.Version == "" || version.URL == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "version and url are required"})
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("terms_versions")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	version.ID = primitive.NewObjectID()
+	version.CreatedBy = c.Locals("userID").(string)
+	version.CreatedAt = time.Now()
+	if version.PublishedAt.IsZero() {
+		version.PublishedAt = version.CreatedAt
+	}
+
+	// Versions are immutable once registered; the unique index turns away a version registered twice
+	if _, err := collection.InsertOne(ctx, version); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Terms version already exists"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create terms version"})
+	}
+
+	event := audit.NewEvent(c, "terms.version_created")
+	event.TargetType = "terms_version"
+	event.TargetID = version.Version
+	audit.Record(event)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Terms version created successfully",
+		"terms":   version,
+	})
+}
+
+// ListTermsVersionsHandler lists all registered terms versions, newest first
+func ListTermsVersionsHandler(c *fiber.Ctx) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("terms_versions")
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"published_at": -1}))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms versions"})
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.TermsVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode terms versions"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "Terms versions retrieved successfully",
+		"terms":   versions,
+	})
+}
+
+// GetCurrentTermsHandler returns the terms version currently in effect
+func GetCurrentTermsHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	current, err := services.CurrentTermsVersion(ctx)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms version"})
+	}
+	if current == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No terms version published"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"terms": current})
+}
+
+// AcceptTermsHandler records the authenticated user accepting the current terms version
+func AcceptTermsHandler(c *fiber.Ctx) error {
+	type AcceptTermsRequest struct {
+		Version string `json:"version" validate:"required"`
+	}
+
+	var req AcceptTermsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Only the version currently in effect can be accepted
+	current, err := services.CurrentTermsVersion(ctx)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms version"})
+	}
+	if current == nil || current.Version != req.Version {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Only the current terms version can be accepted"})
+	}
+
+	if err := services.AcceptTerms(ctx, newTermsAcceptance(c, objID, current.Version, "accept_endpoint")); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record terms acceptance"})
+	}
+
+	event := newUserAuditEvent(c, "terms.accepted", objID.Hex())
+	event.Metadata = map[string]string{"version": current.Version}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Terms accepted successfully", "version": current.Version})
+}
+
+// TermsAcceptanceReportHandler lists the active users who have not accepted a terms version yet
+func TermsAcceptanceReportHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	// Default to the version currently in effect
+	version := c.Query("version")
+	if version == "" {
+		current, err := services.CurrentTermsVersion(ctx)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms version"})
+		}
+		if current == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No terms version published"})
+		}
+		version = current.Version
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	filter := bson.M{
+		"terms_version": bson.M{"$ne": version},
+		"deleted_at":    bson.M{"$exists": false},
+	}
+	opts := options.Find().SetProjection(bson.M{
+		"email": 1, "status": 1, "role": 1, "terms_version": 1, "terms_accepted_at": 1,
+	})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve users"})
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode user data"})
+		}
+		users = append(users, user)
+	}
+	if err := cursor.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Cursor iteration error"})
+	}
+
+	// The merchant names are held by the users' organizations
+	if err := services.LoadMerchantProfiles(ctx, users); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve merchant profiles"})
+	}
+
+	pending := []fiber.Map{}
+	for _, user := range users {
+		pending = append(pending, fiber.Map{
+			"id":                user.ID.Hex(),
+			"merchant_name":     user.MerchantName,
+			"email":             user.Email,
+			"status":            user.Status,
+			"role":              user.Role,
+			"terms_version":     user.TermsVersion,
+			"terms_accepted_at": user.TermsAcceptedAt,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "Terms acceptance report generated successfully",
+		"version": version,
+		"pending": len(pending),
+		"users":   pending,
+	})
+}
+
+// newTermsAcceptance builds an acceptance record for the given request
+func newTermsAcceptance(c *fiber.Ctx, userID primitive.ObjectID, version, source string) models.TermsAcceptance {
+	return models.TermsAcceptance{
+		UserID:    userID,
+		Version:   version,
+		Source:    source,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+}
+
+// acceptCurrentTerms records that a user accepted whichever terms version is currently in effect,
+// unless they have already accepted that version
+func acceptCurrentTerms(c *fiber.Ctx, user models.User, source string) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	log := logger.FromContext(c)
+
+	version := ""
+	current, err := services.CurrentTermsVersion(ctx)
+	if err != nil {
+		log.Error("Failed to retrieve current terms version", "error", err)
+	} else if current != nil {
+		version = current.Version
+	}
+	if user.TermsAcceptedAt != nil && user.TermsVersion == version {
+		return
+	}
+
+	if err := services.AcceptTerms(ctx, newTermsAcceptance(c, user.ID, version, source)); err != nil {
+		log.Error("Failed to record terms acceptance", "user_id", user.ID.Hex(), "error", err)
+	}
+}
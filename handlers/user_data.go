@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExportUserDataHandler returns a downloadable JSON archive of all personal data held about a user
+func ExportUserDataHandler(c *fiber.Ctx) error {
+	// Extract the user ID from the request URL parameters
+	userID := c.Params("id")
+
+	// Convert the userID string to a MongoDB ObjectID
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Get a reference to the "users" collection in the MongoDB database
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// Create a context with a timeout for the database operations
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+
+	// Find the user by ID
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := services.LoadMerchantProfile(ctx, &user); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve merchant profile"})
+	}
+
+	// Collect the related records
+	consents, err := services.ConsentHistory(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve consent history"})
+	}
+
+	termsAcceptances, err := services.TermsAcceptanceHistory(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve terms acceptances"})
+	}
+
+	oauthConsents, err := services.OAuthConsentsForUser(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve application consents"})
+	}
+
+	federatedIdentities, err := services.FederatedIdentitiesForUser(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve linked accounts"})
+	}
+
+	passkeys, err := services.WebAuthnCredentialsForUser(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve passkeys"})
+	}
+
+	sessions, err := services.SessionsForUser(ctx, objID, true)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve sessions"})
+	}
+
+	apiKeys, err := services.APIKeysForUser(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve API keys"})
+	}
+
+	organizations, err := services.OrganizationsForUser(ctx, objID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve organizations"})
+	}
+
+	auditEvents, err := audit.EventsForUser(ctx, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve audit entries"})
+	}
+
+	archive := fiber.Map{
+		"exported_at":          time.Now().UTC(),
+		"profile":              userProfileData(user),
+		"consents":             consents,
+		"terms_acceptances":    termsAcceptances,
+		"oauth_consents":       oauthConsents,
+		"federated_identities": federatedIdentities,
+		"passkeys":             passkeys,
+		"sessions":             sessions,
+		"api_keys":             apiKeys,
+		"organizations":        organizations,
+		"audit_events":         auditEvents,
+	}
+
+	audit.Record(newUserAuditEvent(c, "user.data_exported", userID))
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="user-data-`+userID+`.json"`)
+	return c.Status(http.StatusOK).JSON(archive)
+}
+
+// AnonymizeUserHandler irreversibly scrubs a user's personal data while keeping their related records
+func AnonymizeUserHandler(c *fiber.Ctx) error {
+	// Extract the user ID from the request URL parameters
+	userID := c.Params("id")
+
+	// Convert the userID string to a MongoDB ObjectID
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Administrators cannot anonymize their own account
+	if c.Locals("userID").(string) == userID {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Cannot anonymize your own account"})
+	}
+
+	// Get a reference to the "users" collection in the MongoDB database
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	// Create a context with a timeout for the database operations
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	// Find the user by ID
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.AnonymizedAt != nil {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "User is already anonymized"})
+	}
+
+	err = services.AnonymizeUser(ctx, collection, objID)
+	if errors.Is(err, services.ErrOwnsSharedOrganization) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Transfer ownership of organizations with other members before anonymizing this user"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to anonymize user"})
+	}
+
+	// Record who anonymized the user
+	audit.Record(newUserAuditEvent(c, "user.anonymized", userID))
+
+	// Return a success message
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User anonymized successfully"})
+}
+
+// userProfileData returns the personal data stored on a user, without secrets
+func userProfileData(user models.User) fiber.Map {
+	return fiber.Map{
+		"id":                   user.ID.Hex(),
+		"merchant_name":        user.MerchantName,
+		"email":                user.Email,
+		"email_status":         user.EmailStatus,
+		"status":               user.Status,
+		"role":                 user.Role,
+		"person_in_charge":     user.PersonInCharge,
+		"phone_number":         user.PhoneNumber,
+		"phone_verified":       user.PhoneVerified,
+		"website":              user.Website,
+		"address":              user.Address,
+		"terms_and_conditions": user.TermsAndConditions,
+		"terms_version":        user.TermsVersion,
+		"terms_accepted_at":    user.TermsAcceptedAt,
+		"created_at":           user.CreatedAt,
+		"updated_at":           user.UpdatedAt,
+		"deleted_at":           user.DeletedAt,
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// buildUserFilter converts a UserFilter into a MongoDB query on the users collection
+func buildUserFilter(ctx context.Context, filter models.UserFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+	if filter.EmailStatus != nil {
+		query["email_status"] = *filter.EmailStatus
+	}
+
+	// Soft-deleted users are hidden unless explicitly requested
+	switch filter.Deleted {
+	case "include":
+	case "only":
+		query["deleted_at"] = bson.M{"$exists": true}
+	default:
+		query["deleted_at"] = bson.M{"$exists": false}
+	}
+
+	// Match the search term against the main identifying fields, case-insensitively.
+	// Merchant names are held by organizations, so those match the organizations' members.
+	if filter.Search != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(filter.Search), "$options": "i"}
+		memberIDs, err := services.OrganizationMemberIDs(ctx, bson.M{"merchant_name": pattern})
+		if err != nil {
+			return nil, err
+		}
+		query["$or"] = bson.A{
+			bson.M{"email": pattern},
+			bson.M{"_id": bson.M{"$in": memberIDs}},
+			bson.M{"person_in_charge": pattern},
+		}
+	}
+
+	// Restrict the creation time range if requested
+	createdAt := bson.M{}
+	if filter.CreatedAfter != nil {
+		createdAt["$gte"] = *filter.CreatedAfter
+	}
+	if filter.CreatedBefore != nil {
+		createdAt["$lt"] = *filter.CreatedBefore
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	return query, nil
+}
+
+// parseUserFilterQuery reads the user list filters from the query string
+func parseUserFilterQuery(c *fiber.Ctx) (models.UserFilter, error) {
+	filter := models.UserFilter{
+		Status:  models.Status(c.Query("status")),
+		Role:    models.Role(c.Query("role")),
+		Search:  c.Query("search"),
+		Deleted: c.Query("deleted"),
+	}
+
+	if filter.Deleted != "" && filter.Deleted != "include" && filter.Deleted != "only" {
+		return filter, fmt.Errorf("invalid deleted, expected include or only")
+	}
+
+	if value := c.Query("email_status"); value != "" {
+		emailStatus, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid email_status")
+		}
+		filter.EmailStatus = &emailStatus
+	}
+
+	if value := c.Query("created_after"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid created_after, expected RFC 3339")
+		}
+		filter.CreatedAfter = &createdAfter
+	}
+
+	if value := c.Query("created_before"); value != "" {
+		createdBefore, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid created_before, expected RFC 3339")
+		}
+		filter.CreatedBefore = &createdBefore
+	}
+
+	return filter, nil
+}
@@ -5,7 +5,9 @@ import (
 	"net/http" // Importing http for HTTP status codes
 	"time"     // Importing time for setting timeouts
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/database" // Importing the custom database package for MongoDB connection
+	"myfibergotemplate/metrics"  // Importing the custom metrics package for Prometheus counters
 	"myfibergotemplate/models"   // Importing the custom models package for defining the User model
 
 	"github.com/gofiber/fiber/v2"      // Importing Fiber for building the HTTP server
@@ -25,16 +27,17 @@ func VerifyEmailHandler(c *fiber.Ctx) error {
 	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
 
 	// Create a context with a timeout for the database operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
 	defer cancel() // Ensure the context is cancelled after the operation to prevent resource leaks
 
 	// Define a variable to hold the user information
 	var user models.User
 
 	// Search the database for a user with the provided verification token
-	err := collection.FindOne(ctx, bson.M{"verification_token": token}).Decode(&user)
+	err := collection.FindOne(ctx, bson.M{"verification_token": token, "deleted_at": bson.M{"$exists": false}}).Decode(&user)
 	if err != nil {
 		// If the token is invalid or not found, return a 404 Not Found with an error message
+		metrics.Verifications.WithLabelValues("invalid_token").Inc()
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Invalid verification token"})
 	}
 
@@ -51,6 +54,12 @@ func VerifyEmailHandler(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify email"})
 	}
 
+	// Record the verification
+	metrics.Verifications.WithLabelValues("success").Inc()
+	event := newUserAuditEvent(c, "user.email_verified", user.ID.Hex())
+	event.ActorID = user.ID.Hex()
+	audit.Record(event)
+
 	// If everything is successful, return a 200 OK status with a success message
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Email successfully verified"})
 }
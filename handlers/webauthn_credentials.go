@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"myfibergotemplate/audit"
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/passkey"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BeginPasskeyRegistrationHandler returns the options the browser needs to create a passkey for the signed-in user
+func BeginPasskeyRegistrationHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, credentials, err := currentPasskeyUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	creation, data, err := passkey.BeginRegistration(passkey.NewUser(*user, credentials))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey registration"})
+	}
+
+	session, err := services.StartWebAuthnSession(ctx, models.WebAuthnSession{
+		Purpose: models.WebAuthnRegistration,
+		UserID:  &user.ID,
+		Data:    data,
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey registration"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"session": session, "options": creation})
+}
+
+// FinishPasskeyRegistrationHandler verifies the new passkey created by the browser and stores it
+func FinishPasskeyRegistrationHandler(c *fiber.Ctx) error {
+	type FinishRegistrationRequest struct {
+		Session    string          `json:"session"`
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential"`
+	}
+
+	var req FinishRegistrationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if len(name) > 64 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name must be at most 64 characters"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, credentials, err := currentPasskeyUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	session, err := services.ConsumeWebAuthnSession(ctx, req.Session, models.WebAuthnRegistration)
+	if err != nil || session.UserID == nil || *session.UserID != user.ID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired registration session"})
+	}
+
+	credential, err := passkey.FinishRegistration(passkey.NewUser(*user, credentials), session.Data, req.Credential)
+	if err != nil {
+		logger.FromContext(c).Warn("Rejected passkey registration", "user_id", user.ID.Hex(), "error", err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Passkey could not be verified"})
+	}
+	credential.Name = name
+	if credential.Name == "" {
+		credential.Name = "Passkey " + credential.CreatedAt.Format("2006-01-02")
+	}
+
+	if err := services.AddWebAuthnCredential(ctx, credential); err != nil {
+		if errors.Is(err, services.ErrCredentialRegistered) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "This passkey is already registered"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save passkey"})
+	}
+
+	event := newUserAuditEvent(c, "user.passkey_registered", user.ID.Hex())
+	event.Metadata = map[string]string{"credential_id": credential.ID.Hex(), "name": credential.Name}
+	audit.Record(event)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Passkey registered successfully", "credential": credential})
+}
+
+// ListPasskeysHandler lists the signed-in user's passkeys
+func ListPasskeysHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, credentials, err := currentPasskeyUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"credentials":      credentials,
+		"passkey_required": user.PasskeyRequired,
+	})
+}
+
+// RenamePasskeyHandler renames one of the signed-in user's passkeys
+func RenamePasskeyHandler(c *fiber.Ctx) error {
+	type RenamePasskeyRequest struct {
+		Name string `json:"name"`
+	}
+
+	var req RenamePasskeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name must be between 1 and 64 characters"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid passkey ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	found, err := services.RenameWebAuthnCredential(ctx, userID, id, name)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rename passkey"})
+	}
+	if !found {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Passkey not found"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Passkey renamed successfully"})
+}
+
+// DeletePasskeyHandler removes one of the signed-in user's passkeys, unless the user would be left unable to sign in
+func DeletePasskeyHandler(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid passkey ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, credentials, err := currentPasskeyUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	var credential *models.WebAuthnCredential
+	for i := range credentials {
+		if credentials[i].ID == id {
+			credential = &credentials[i]
+		}
+	}
+	if credential == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Passkey not found"})
+	}
+
+	if len(credentials) == 1 {
+		if user.PasskeyRequired {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Turn off passkey verification before removing your last passkey"})
+		}
+		identities, err := services.FederatedIdentitiesForUser(ctx, user.ID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve linked accounts"})
+		}
+		if user.Password == "" && len(identities) == 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Set a password before removing your last sign-in method"})
+		}
+	}
+
+	if _, err := services.DeleteWebAuthnCredentials(ctx, bson.M{"_id": credential.ID}); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove passkey"})
+	}
+
+	event := newUserAuditEvent(c, "user.passkey_removed", user.ID.Hex())
+	event.Metadata = map[string]string{"credential_id": credential.ID.Hex(), "name": credential.Name}
+	audit.Record(event)
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Passkey removed successfully"})
+}
+
+// SetPasskeyRequiredHandler turns passkey verification of the signed-in user's sign-ins on or off
+func SetPasskeyRequiredHandler(c *fiber.Ctx) error {
+	type PasskeyRequiredRequest struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	var req PasskeyRequiredRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	user, credentials, err := currentPasskeyUser(ctx, c)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if req.Enabled && len(credentials) == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Register a passkey before turning on passkey verification"})
+	}
+
+	update := bson.M{"$set": bson.M{"passkey_required": true, "updated_at": time.Now()}}
+	action := "user.passkey_required_enabled"
+	if !req.Enabled {
+		update = bson.M{"$unset": bson.M{"passkey_required": ""}, "$set": bson.M{"updated_at": time.Now()}}
+		action = "user.passkey_required_disabled"
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update passkey verification"})
+	}
+
+	audit.Record(newUserAuditEvent(c, action, user.ID.Hex()))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Passkey verification updated", "passkey_required": req.Enabled})
+}
+
+// ResetUserPasskeysHandler removes all of a user's passkeys and turns off passkey verification,
+// for users who lost their authenticators (Admin only)
+func ResetUserPasskeysHandler(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$unset": bson.M{"passkey_required": ""}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset passkeys"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	removed, err := services.DeleteWebAuthnCredentials(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset passkeys"})
+	}
+
+	audit.Record(newUserAuditEvent(c, "user.passkeys_reset", userID))
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Passkeys reset successfully", "removed": removed})
+}
+
+// currentPasskeyUser loads the signed-in user and their passkeys
+func currentPasskeyUser(ctx context.Context, c *fiber.Ctx) (*models.User, []models.WebAuthnCredential, error) {
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		return nil, nil, err
+	}
+	return passkeyUser(ctx, userID)
+}
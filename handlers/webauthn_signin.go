@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/models"
+	"myfibergotemplate/passkey"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BeginPasskeySignInHandler returns the options for signing in with any passkey registered for this site
+func BeginPasskeySignInHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	assertion, data, err := passkey.BeginLogin(nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey sign-in"})
+	}
+
+	session, err := services.StartWebAuthnSession(ctx, models.WebAuthnSession{Purpose: models.WebAuthnSignIn, Data: data})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey sign-in"})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"session": session, "options": assertion})
+}
+
+// FinishPasskeySignInHandler verifies a passkey assertion, either signing the user in with the passkey alone
+// or confirming a sign-in that asked for passkey verification, and returns the same response as SignInHandler
+func FinishPasskeySignInHandler(c *fiber.Ctx) error {
+	type FinishSignInRequest struct {
+		Session    string          `json:"session"`
+		Credential json.RawMessage `json:"credential"`
+
+		// AcceptTermsVersion accepts the current terms version when sign-in requires it
+		AcceptTermsVersion string `json:"accept_terms_version"`
+	}
+
+	var req FinishSignInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	session, err := services.ConsumeWebAuthnSession(ctx, req.Session, models.WebAuthnSignIn, models.WebAuthnSecondFactor)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired passkey session"})
+	}
+
+	var user *models.User
+	loadUser := func(userID primitive.ObjectID) (*passkey.User, error) {
+		var credentials []models.WebAuthnCredential
+		user, credentials, err = passkeyUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return passkey.NewUser(*user, credentials), nil
+	}
+
+	// A second factor is answered by the user who signed in; a passkey sign-in names its user
+	method := "passkey"
+	var credential *models.WebAuthnCredential
+	if session.UserID != nil {
+		method = session.FirstMethod + "+passkey"
+		var expected *passkey.User
+		if expected, err = loadUser(*session.UserID); err == nil {
+			credential, err = passkey.FinishLogin(expected, nil, session.Data, req.Credential)
+		}
+	} else {
+		credential, err = passkey.FinishLogin(nil, loadUser, session.Data, req.Credential)
+	}
+	if err != nil {
+		logger.FromContext(c).Warn("Rejected passkey assertion", "error", err)
+		recordSignIn(c, user, "", method, "bad_passkey")
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Passkey could not be verified"})
+	}
+
+	if err := services.RecordWebAuthnCredentialUse(ctx, credential); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record passkey use"})
+	}
+
+	if blocked, err := signInBlocked(ctx, c, *user, user.Email, method, req.AcceptTermsVersion); blocked {
+		return err
+	}
+
+	return signInResponse(c, *user, user.Email, method)
+}
+
+// passkeyVerificationResponse asks a user who turned on passkey verification to confirm a sign-in with a passkey
+func passkeyVerificationResponse(c *fiber.Ctx, user models.User, email, method string) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	credentials, err := services.WebAuthnCredentialsForUser(ctx, user.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve passkeys"})
+	}
+	if len(credentials) == 0 {
+		recordSignIn(c, &user, email, method, "no_passkey")
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "No passkey is registered; ask an administrator to reset passkey verification"})
+	}
+
+	assertion, data, err := passkey.BeginLogin(passkey.NewUser(user, credentials))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey verification"})
+	}
+
+	session, err := services.StartWebAuthnSession(ctx, models.WebAuthnSession{
+		Purpose:     models.WebAuthnSecondFactor,
+		UserID:      &user.ID,
+		FirstMethod: method,
+		Data:        data,
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start passkey verification"})
+	}
+
+	recordSignIn(c, &user, email, method, "passkey_required")
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message":          "Passkey verification required",
+		"passkey_required": true,
+		"session":          session,
+		"options":          assertion,
+	})
+}
+
+// passkeyUser loads a user who has not been deleted, and their passkeys
+func passkeyUser(ctx context.Context, userID primitive.ObjectID) (*models.User, []models.WebAuthnCredential, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": userID, "deleted_at": bson.M{"$exists": false}}).Decode(&user); err != nil {
+		return nil, nil, err
+	}
+
+	credentials, err := services.WebAuthnCredentialsForUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, credentials, nil
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database/databasetest"
+	"myfibergotemplate/models"
+	"myfibergotemplate/passkey"
+	"myfibergotemplate/passkey/passkeytest"
+	"myfibergotemplate/services"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newPasskeyTestApp serves the passkey routes, with the registration routes signed in as user
+func newPasskeyTestApp(t *testing.T, user models.User) *fiber.App {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.WebAuthn.RPID = "id.example.com"
+	cfg.WebAuthn.Origins = []string{"https://id.example.com"}
+	if err := passkey.Init(cfg.WebAuthn); err != nil {
+		t.Fatal(err)
+	}
+
+	signedIn := func(c *fiber.Ctx) error {
+		c.Locals("userID", user.ID.Hex())
+		return c.Next()
+	}
+
+	app := fiber.New()
+	app.Use(config.Middleware(cfg))
+	app.Post("/signin/passkey/begin", BeginPasskeySignInHandler)
+	app.Post("/signin/passkey/finish", FinishPasskeySignInHandler)
+	app.Post("/webauthn/register/begin", signedIn, BeginPasskeyRegistrationHandler)
+	app.Post("/webauthn/register/finish", signedIn, FinishPasskeyRegistrationHandler)
+	return app
+}
+
+// postJSON posts body to app and decodes the response into out, returning the status code
+func postJSON(t *testing.T, app *fiber.App, target string, body, out any) int {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// registerPasskey registers authenticator for the signed-in user through the registration routes
+func registerPasskey(t *testing.T, app *fiber.App, authenticator *passkeytest.Authenticator) {
+	t.Helper()
+
+	var begin struct {
+		Session string                      `json:"session"`
+		Options protocol.CredentialCreation `json:"options"`
+	}
+	if status := postJSON(t, app, "/webauthn/register/begin", nil, &begin); status != http.StatusOK {
+		t.Fatalf("starting registration returned %d", status)
+	}
+	credential, err := authenticator.Register(&begin.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finish := fiber.Map{"session": begin.Session, "name": "Laptop", "credential": json.RawMessage(credential)}
+	if status := postJSON(t, app, "/webauthn/register/finish", finish, nil); status != http.StatusCreated {
+		t.Fatalf("finishing registration returned %d", status)
+	}
+
+	// The registration challenge is answered once
+	if status := postJSON(t, app, "/webauthn/register/finish", finish, nil); status != http.StatusBadRequest {
+		t.Errorf("replayed registration returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+// beginPasskeySignIn starts a passkey sign-in and returns its session and the options for the authenticator
+func beginPasskeySignIn(t *testing.T, app *fiber.App) (string, *protocol.CredentialAssertion) {
+	t.Helper()
+
+	var begin struct {
+		Session string                       `json:"session"`
+		Options protocol.CredentialAssertion `json:"options"`
+	}
+	if status := postJSON(t, app, "/signin/passkey/begin", nil, &begin); status != http.StatusOK {
+		t.Fatalf("starting sign-in returned %d", status)
+	}
+	return begin.Session, &begin.Options
+}
+
+// finishPasskeySignIn answers a sign-in with authenticator and returns the status code
+func finishPasskeySignIn(t *testing.T, app *fiber.App, session string, options *protocol.CredentialAssertion, authenticator *passkeytest.Authenticator) int {
+	t.Helper()
+
+	credential, err := authenticator.Assert(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	terms, err := services.CurrentTermsVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finish := fiber.Map{"session": session, "credential": json.RawMessage(credential)}
+	if terms != nil {
+		finish["accept_terms_version"] = terms.Version
+	}
+	return postJSON(t, app, "/signin/passkey/finish", finish, nil)
+}
+
+func TestPasskeySignIn(t *testing.T) {
+	databasetest.Connect(t)
+	user := newTestUser(t, models.Merchant)
+	app := newPasskeyTestApp(t, user)
+	authenticator := passkeytest.NewAuthenticator("id.example.com", "https://id.example.com")
+	registerPasskey(t, app, authenticator)
+
+	session, options := beginPasskeySignIn(t, app)
+	if status := finishPasskeySignIn(t, app, session, options, authenticator); status != http.StatusOK {
+		t.Fatalf("sign-in returned %d", status)
+	}
+
+	// The sign-in challenge is answered once, even with a fresh signature
+	if status := finishPasskeySignIn(t, app, session, options, authenticator); status != http.StatusUnauthorized {
+		t.Errorf("reused challenge returned %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// The signature count is stored, so a copy of the key that has signed less often is turned away
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	credentials, err := services.WebAuthnCredentialsForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 1 || credentials[0].SignCount != 1 {
+		t.Fatalf("stored credentials are %+v, want one with count 1", credentials)
+	}
+	authenticator.SignCount = 0
+	session, options = beginPasskeySignIn(t, app)
+	if status := finishPasskeySignIn(t, app, session, options, authenticator); status != http.StatusUnauthorized {
+		t.Errorf("cloned authenticator returned %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,115 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"myfibergotemplate/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outboxSize     = 1024 // Maximum number of emails waiting to be sent
+	outboxAttempts = 3    // Delivery attempts before an email is dropped
+)
+
+// ErrOutboxUnavailable is returned when an email cannot be queued
+var ErrOutboxUnavailable = errors.New("email outbox is full or closed")
+
+// outboxEmail is an email waiting to be sent by the outbox worker
+type outboxEmail struct {
+	ctx     context.Context
+	cfg     config.EmailConfig
+	to      []string
+	subject string
+	body    string
+}
+
+var (
+	outboxMu   sync.Mutex
+	outbox     chan outboxEmail
+	outboxDone chan struct{}
+)
+
+// StartOutbox starts the background worker that delivers queued emails
+func StartOutbox() {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	if outbox != nil {
+		return
+	}
+	outbox = make(chan outboxEmail, outboxSize)
+	outboxDone = make(chan struct{})
+	go runOutbox(outbox, outboxDone)
+}
+
+// QueueEmail queues an email for delivery without waiting for the SMTP server
+func QueueEmail(ctx context.Context, cfg config.EmailConfig, to []string, subject, body string) error {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	if outbox == nil {
+		return ErrOutboxUnavailable
+	}
+
+	// Keep the trace but not the request's cancellation, which ends with the response
+	email := outboxEmail{
+		ctx:     trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx)),
+		cfg:     cfg,
+		to:      to,
+		subject: subject,
+		body:    body,
+	}
+	select {
+	case outbox <- email:
+		return nil
+	default:
+		return ErrOutboxUnavailable
+	}
+}
+
+// FlushOutbox sends the queued emails and stops the background worker
+func FlushOutbox(ctx context.Context) error {
+	outboxMu.Lock()
+	if outbox == nil {
+		outboxMu.Unlock()
+		return nil
+	}
+	close(outbox)
+	outbox = nil
+	done := outboxDone
+	outboxMu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runOutbox delivers queued emails, retrying briefly on failure
+func runOutbox(queue <-chan outboxEmail, done chan<- struct{}) {
+	defer close(done)
+
+	for email := range queue {
+		var err error
+		for attempt := 1; attempt <= outboxAttempts; attempt++ {
+			if err = SendEmail(email.ctx, email.cfg, email.to, email.subject, email.body); err == nil {
+				break
+			}
+			if attempt < outboxAttempts {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+		if err != nil {
+			slog.Error("Failed to send queued email", "to", strings.Join(email.to, ", "), "subject", email.subject, "error", err)
+		}
+	}
+}
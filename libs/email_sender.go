@@ -1,29 +1,56 @@
 package libs
 
 import (
-	"os"
+	"context"
+	"net"
+	"strconv"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/metrics"
+	"myfibergotemplate/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 
 	"gopkg.in/mail.v2"
 )
 
-// SendEmail sends an email with the given recipients, subject, and body
-func SendEmail(to []string, subject, body string) error {
+// SendEmail sends an email with the given recipients, subject, and body through the configured SMTP server
+func SendEmail(ctx context.Context, cfg config.EmailConfig, to []string, subject, body string) error {
+	_, span := tracing.Start(ctx, "email.send")
+	defer span.End()
+	span.SetAttributes(attribute.Int("email.recipients", len(to)), attribute.String("email.subject", subject))
+
 	m := mail.NewMessage()
 
 	// Set the sender and recipient.
-	m.SetHeader("From", os.Getenv("EMAIL_USER"))
+	m.SetHeader("From", cfg.User)
 	m.SetHeader("To", to...)
 	m.SetHeader("Subject", subject)
 
 	// Set the body of the email to HTML
 	m.SetBody("text/html", body)
 
-	// Setup the mail server configuration. I'm using Office 365 SMTP server here.
-	d := mail.NewDialer("smtp.office365.com", 587, os.Getenv("EMAIL_USER"), os.Getenv("EMAIL_PASS"))
+	// Setup the mail server configuration
+	d := mail.NewDialer(cfg.SMTPHost, cfg.SMTPPort, cfg.User, cfg.Password)
 
 	// Send the email.
 	if err := d.DialAndSend(m); err != nil {
+		metrics.Emails.WithLabelValues("failed").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to send email")
 		return err
 	}
+	metrics.Emails.WithLabelValues("sent").Inc()
 	return nil
 }
+
+// CheckMailer verifies that the SMTP server accepts connections
+func CheckMailer(ctx context.Context, cfg config.EmailConfig) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
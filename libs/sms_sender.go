@@ -0,0 +1,189 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/metrics"
+	"myfibergotemplate/tracing"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ErrSMSUnavailable is returned when no SMS provider is configured
+var ErrSMSUnavailable = errors.New("no SMS provider is configured")
+
+// SMSSender delivers a text message to a phone number in E.164 form
+type SMSSender interface {
+	Send(ctx context.Context, to, message string) error
+	Close() error
+}
+
+// The sender set by StartSMS; nil when no provider is configured
+var (
+	smsMu     sync.Mutex
+	smsSender SMSSender
+)
+
+// StartSMS creates the sender for the configured provider
+func StartSMS(cfg config.SMSConfig) error {
+	var (
+		sender SMSSender
+		err    error
+	)
+	switch cfg.Provider {
+	case config.SMSProviderLog:
+		sender, err = NewLogSMSSender(cfg.FilePath)
+	case config.SMSProviderHTTP:
+		sender = NewHTTPSMSSender(cfg.GatewayURL, cfg.GatewayToken, cfg.Sender)
+	}
+	if err != nil {
+		return err
+	}
+
+	smsMu.Lock()
+	defer smsMu.Unlock()
+	smsSender = sender
+	return nil
+}
+
+// SMSEnabled reports whether text messages can be sent
+func SMSEnabled() bool {
+	smsMu.Lock()
+	defer smsMu.Unlock()
+	return smsSender != nil
+}
+
+// SendSMS sends a text message through the configured provider
+func SendSMS(ctx context.Context, to, message string) error {
+	smsMu.Lock()
+	sender := smsSender
+	smsMu.Unlock()
+	if sender == nil {
+		return ErrSMSUnavailable
+	}
+
+	ctx, span := tracing.Start(ctx, "sms.send")
+	defer span.End()
+
+	if err := sender.Send(ctx, to, message); err != nil {
+		metrics.SMS.WithLabelValues("failed").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to send text message")
+		return err
+	}
+	metrics.SMS.WithLabelValues("sent").Inc()
+	return nil
+}
+
+// CloseSMS releases the sender's resources
+func CloseSMS() error {
+	smsMu.Lock()
+	defer smsMu.Unlock()
+	if smsSender == nil {
+		return nil
+	}
+	err := smsSender.Close()
+	smsSender = nil
+	return err
+}
+
+// LogSMSSender writes text messages to the application log and, when a file is given, appends them to it
+// as newline-delimited JSON, so development setups and tests can read the codes that were "sent"
+type LogSMSSender struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewLogSMSSender creates a sender that logs messages, also appending them to the file at path unless it is empty
+func NewLogSMSSender(path string) (*LogSMSSender, error) {
+	if path == "" {
+		return &LogSMSSender{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &LogSMSSender{file: file}, nil
+}
+
+func (s *LogSMSSender) Send(ctx context.Context, to, message string) error {
+	slog.InfoContext(ctx, "Text message", "to", to, "message", message)
+	if s.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(map[string]interface{}{"to": to, "message": message, "sent_at": time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *LogSMSSender) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// HTTPSMSSender posts text messages as JSON to an SMS gateway, authenticating with a bearer token
+type HTTPSMSSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+// NewHTTPSMSSender creates a sender for the gateway at url
+func NewHTTPSMSSender(url, token, from string) *HTTPSMSSender {
+	return &HTTPSMSSender{url: url, token: token, from: from, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSMSSender) Send(ctx context.Context, to, message string) error {
+	body, err := json.Marshal(map[string]string{"from": s.from, "to": to, "message": message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS gateway returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+func (s *HTTPSMSSender) Close() error {
+	return nil
+}
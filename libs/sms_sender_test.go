@@ -0,0 +1,61 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"myfibergotemplate/config"
+)
+
+func TestLogSMSSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms.ndjson")
+	if err := StartSMS(config.SMSConfig{Provider: config.SMSProviderLog, FilePath: path}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CloseSMS() })
+
+	if !SMSEnabled() {
+		t.Fatal("text messages not enabled")
+	}
+	for _, message := range []string{"first", "second"} {
+		if err := SendSMS(context.Background(), "+60123456789", message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file has %d lines, want 2", len(lines))
+	}
+	var sent struct {
+		To      string `json:"to"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.To != "+60123456789" || sent.Message != "second" {
+		t.Errorf("last message is %+v", sent)
+	}
+}
+
+func TestSendSMSWithoutProvider(t *testing.T) {
+	if err := StartSMS(config.SMSConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if SMSEnabled() {
+		t.Error("text messages enabled without a provider")
+	}
+	if err := SendSMS(context.Background(), "+60123456789", "hello"); !errors.Is(err, ErrSMSUnavailable) {
+		t.Errorf("SendSMS returned %v, want ErrSMSUnavailable", err)
+	}
+}
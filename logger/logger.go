@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"myfibergotemplate/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// New creates a logger that writes to w in the configured format (json or text) and level.
+// Sensitive values are redacted before they are written.
+func New(w io.Writer, cfg config.LoggingConfig) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+
+	if strings.EqualFold(cfg.Format, "text") {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+// FromContext returns the request-scoped logger set by the request ID middleware,
+// or the default logger outside of a request
+func FromContext(c *fiber.Ctx) *slog.Logger {
+	if c != nil {
+		if l, ok := c.Locals("logger").(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
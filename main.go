@@ -1,47 +1,259 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"myfibergotemplate/audit"
 	"myfibergotemplate/config"
 	"myfibergotemplate/database"
+	"myfibergotemplate/federation"
+	"myfibergotemplate/geoip"
+	"myfibergotemplate/handlers"
+	"myfibergotemplate/libs"
+	"myfibergotemplate/logger"
+	"myfibergotemplate/metrics"
+	"myfibergotemplate/middleware"
+	"myfibergotemplate/oidc"
+	"myfibergotemplate/passkey"
 	"myfibergotemplate/routes"
+	"myfibergotemplate/samlsso"
+	"myfibergotemplate/services"
+	"myfibergotemplate/tracing"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
 func main() {
-	config.LoadEnv()
+	configPath := flag.String("config", "", "path to a YAML or TOML config file (defaults to $CONFIG_FILE)")
+	flag.Parse()
 
-	err := database.ConnectMongoDB()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(1)
 	}
 
+	// "config print" shows the effective settings with secrets redacted
+	if args := flag.Args(); len(args) == 2 && args[0] == "config" && args[1] == "print" {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Use the structured, redacting logger for the whole application
+	slog.SetDefault(logger.New(os.Stdout, cfg.Logging))
+
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	for _, warning := range cfg.Warnings() {
+		slog.Warn("Insecure configuration", "setting", warning, "environment", cfg.Environment)
+	}
+
+	// Set up tracing before anything that creates spans
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+
+	// Stop background work and start draining on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = database.ConnectMongoDB(cfg.Mongo)
+	if err != nil {
+		fatal("Failed to connect to MongoDB", err)
+	}
+
+	// Create the lookup and expiry indexes of the sign-in and authorization flows
+	indexCtx, cancelIndexes := context.WithTimeout(context.Background(), 30*time.Second)
+	err = services.EnsureOAuthIndexes(indexCtx)
+	if err == nil {
+		err = services.EnsureFederationIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureSAMLIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureMagicLinkIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureWebAuthnIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureSMSCodeIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureSessionIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureAPIKeyIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureOrganizationIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureTermsIndexes(indexCtx)
+	}
+	if err == nil {
+		err = services.EnsureBulkJobIndexes(indexCtx)
+	}
+	cancelIndexes()
+	if err != nil {
+		fatal("Failed to create indexes", err)
+	}
+
+	// Give merchants who signed up before organizations existed an organization of their own
+	backfillCtx, cancelBackfill := context.WithTimeout(context.Background(), 2*time.Minute)
+	created, err := services.BackfillMerchantOrganizations(backfillCtx)
+	cancelBackfill()
+	if err != nil {
+		fatal("Failed to create merchant organizations", err)
+	}
+	if created > 0 {
+		slog.Info("Created merchant organizations", "count", created)
+	}
+
+	// Load the key that signs OpenID Connect ID tokens
+	if err := oidc.Init(cfg.OIDC); err != nil {
+		fatal("Failed to initialize OpenID Connect", err)
+	}
+
+	// Register the external identity providers users can sign in with
+	federation.Init(cfg.Federation)
+
+	// Load the certificate that signs SAML requests and service provider metadata
+	if err := samlsso.Init(cfg.SAML); err != nil {
+		fatal("Failed to initialize SAML", err)
+	}
+
+	// Configure the relying party passkeys are registered with
+	if err := passkey.Init(cfg.WebAuthn); err != nil {
+		fatal("Failed to initialize WebAuthn", err)
+	}
+
+	// Open the GeoIP database that sessions are located with
+	if err := geoip.Init(cfg.Sessions.GeoIPDatabaseFile); err != nil {
+		fatal("Failed to open GeoIP database", err)
+	}
+
+	// Start the audit log writer
+	if err := audit.Start(cfg.Audit); err != nil {
+		fatal("Failed to start audit log", err)
+	}
+
+	// Send emails in the background so requests don't wait for the mail server
+	libs.StartOutbox()
+
+	// Connect the SMS provider that sends phone verification codes
+	if err := libs.StartSMS(cfg.SMS); err != nil {
+		fatal("Failed to start SMS provider", err)
+	}
+
+	// Permanently remove soft-deleted users once their retention period ends
+	services.StartUserPurger(ctx, time.Hour, cfg.Retention)
+
+	// Mark bulk jobs failed whose instance stopped while running them, starting with those from before a restart
+	services.StartBulkJobSweeper(ctx, services.BulkJobStaleAfter)
+
 	app := fiber.New(fiber.Config{
 		BodyLimit: 5 * 1024 * 1024, // 5 MB
+
+		// Only read the client IP from the proxy header when the request comes from a trusted proxy
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		EnableIPValidation:      true,
 	})
 
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:3000",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, HEAD, PUT, DELETE, PATCH",
-	}))
+	// Make the configuration available to handlers
+	app.Use(config.Middleware(cfg))
+
+	// Assign a request ID and log every request
+	app.Use(middleware.RequestIDMiddleware)
+	app.Use(tracing.Middleware)
+	app.Use(middleware.AccessLogMiddleware)
+	app.Use(metrics.Middleware)
+
+	app.Use(middleware.SecurityHeadersMiddleware(cfg.Security))
+	app.Use(middleware.CORSMiddleware(cfg.CORS))
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Hello, Fiber!")
 	})
 
+	// Prometheus metrics endpoint
+	app.Get("/metrics", metrics.Handler(cfg.Metrics.Token))
+
 	routes.SetupRoutes(app)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "port", cfg.Server.Port, "environment", cfg.Environment)
+		serverErr <- app.Listen(":" + cfg.Server.Port)
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("Error starting server", err)
+	case <-ctx.Done():
+		stop()
+	}
+
+	shutdown(app, cfg.Server.ShutdownTimeout, shutdownTracing)
+}
+
+// shutdown drains in-flight requests, then flushes buffered work and closes connections
+func shutdown(app *fiber.App, timeout time.Duration, shutdownTracing func(context.Context) error) {
+	slog.Info("Shutting down", "timeout", timeout.String())
+
+	// Fail readiness so no new traffic is routed here, then let in-flight requests finish
+	handlers.MarkShuttingDown()
+	handlers.StopBulkJobs()
+	if err := app.ShutdownWithTimeout(timeout); err != nil {
+		slog.Error("Failed to drain HTTP server", "error", err)
 	}
 
-	log.Printf("Listening on port %s", port)
-	if err := app.Listen(":" + port); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Deliver queued emails and write buffered audit events before the database goes away
+	if err := libs.FlushOutbox(ctx); err != nil {
+		slog.Error("Failed to flush email outbox", "error", err)
 	}
+	if err := audit.Close(ctx); err != nil {
+		slog.Error("Failed to flush audit log", "error", err)
+	}
+	if err := libs.CloseSMS(); err != nil {
+		slog.Error("Failed to close SMS provider", "error", err)
+	}
+	if err := geoip.Close(); err != nil {
+		slog.Error("Failed to close GeoIP database", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	if err := database.DisconnectMongoDB(ctx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
+	}
+
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs an unrecoverable startup error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Middleware records the latency of every request, labelled by its route pattern
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	// Use the route pattern rather than the raw path to keep label cardinality bounded
+	route := c.Route().Path
+	if route == "" || (route == "/" && c.Path() != "/") {
+		route = "unmatched"
+	}
+
+	HTTPRequestDuration.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Handler serves the metrics in the Prometheus text format.
+// When token is set, scrapers must send it as a bearer token.
+func Handler(token string) fiber.Handler {
+	metricsHandler := adaptor.HTTPHandler(promhttp.Handler())
+
+	return func(c *fiber.Ctx) error {
+		if token != "" && c.Get(fiber.HeaderAuthorization) != "Bearer "+token {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized access"})
+		}
+		return metricsHandler(c)
+	}
+}
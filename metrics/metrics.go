@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTPRequestDuration observes request latency per route registered in SetupRoutes
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// SignIns counts sign-in attempts by outcome (not_found, bad_password, unverified, unapproved, success, ...)
+	SignIns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_signins_total",
+		Help: "Sign-in attempts by outcome.",
+	}, []string{"outcome"})
+
+	// Signups counts created accounts
+	Signups = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_signups_total",
+		Help: "Accounts created through signup.",
+	})
+
+	// Verifications counts email verification attempts by outcome
+	Verifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_email_verifications_total",
+		Help: "Email verification attempts by outcome.",
+	}, []string{"outcome"})
+
+	// PasswordResets counts password reset requests by outcome
+	PasswordResets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_password_resets_total",
+		Help: "Password reset requests by outcome.",
+	}, []string{"outcome"})
+
+	// Lockouts counts accounts locked after too many failed attempts
+	Lockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_lockouts_total",
+		Help: "Lockouts after too many failed attempts, by flow.",
+	}, []string{"flow"})
+
+	// Emails counts outgoing emails by result (sent or failed)
+	Emails = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "emails_total",
+		Help: "Outgoing emails by result.",
+	}, []string{"result"})
+
+	// SMS counts outgoing text messages by result (sent or failed)
+	SMS = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_total",
+		Help: "Outgoing text messages by result.",
+	}, []string{"result"})
+)
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	mongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "MongoDB command latency by command and outcome.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "outcome"})
+
+	mongoPoolOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongodb_pool_open_connections",
+		Help: "Connections currently open in the MongoDB pool.",
+	})
+
+	mongoPoolInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongodb_pool_in_use_connections",
+		Help: "Connections currently checked out of the MongoDB pool.",
+	})
+
+	mongoPoolCheckoutFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mongodb_pool_checkout_failures_total",
+		Help: "Failed attempts to check a connection out of the MongoDB pool.",
+	})
+)
+
+// CommandMonitor observes the latency of every MongoDB command
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoCommandDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoCommandDuration.WithLabelValues(e.CommandName, "failure").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// PoolMonitor tracks the size and usage of the MongoDB connection pool
+func PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoPoolOpen.Inc()
+			case event.ConnectionClosed:
+				mongoPoolOpen.Dec()
+			case event.GetSucceeded:
+				mongoPoolInUse.Inc()
+			case event.ConnectionReturned:
+				mongoPoolInUse.Dec()
+			case event.GetFailed:
+				mongoPoolCheckoutFailures.Inc()
+			}
+		},
+	}
+}
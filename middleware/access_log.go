@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"myfibergotemplate/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AccessLogMiddleware logs every request with its status and latency
+func AccessLogMiddleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	// Let the error handler decide the status of failed requests
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.String("route", c.Route().Path),
+		slog.Int("status", status),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.String("ip", c.IP()),
+		slog.Int("bytes", len(c.Response().Body())),
+	}
+	if userID, ok := c.Locals("userID").(string); ok {
+		attrs = append(attrs, slog.String("user_id", userID))
+	}
+
+	logger.FromContext(c).LogAttrs(c.Context(), level, "request completed", attrs...)
+	return err
+}
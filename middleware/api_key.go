@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyAuth authenticates a request made with a merchant's API key, acting as the merchant.
+// Read-only requests need the read scope and all others the write scope.
+func apiKeyAuth(c *fiber.Ctx, rawKey string) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+	defer cancel()
+
+	key, user, err := services.AuthenticateAPIKey(ctx, rawKey, c.IP())
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check API key"})
+	}
+
+	scope := models.APIKeyScopeWrite
+	if csrfSafeMethod(c.Method()) {
+		scope = models.APIKeyScopeRead
+	}
+	if !slices.Contains(key.Scopes, scope) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "API key lacks the " + scope + " scope"})
+	}
+
+	// Store the key's user and role in the context, as for a signed-in user
+	c.Locals("userID", user.ID.Hex())
+	c.Locals("userRole", string(user.Role))
+	c.Locals("apiKeyID", key.ID.Hex())
+
+	return c.Next()
+}
@@ -1,31 +1,50 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"myfibergotemplate/audit"
 	"myfibergotemplate/config"
+	"myfibergotemplate/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// AuthMiddleware verifies the JWT token and checks user permissions
+// AuthMiddleware verifies the JWT token and checks user permissions. Browser clients in cookie mode
+// send the token in the session cookie instead of the Authorization header, and merchants' backends
+// may send an API key instead of a token.
 func AuthMiddleware(c *fiber.Ctx) error {
-	// Get the JWT from the Authorization header
+	// Get the JWT from the Authorization header, or else from the session cookie
 	authHeader := c.Get("Authorization")
-	if authHeader == "" {
+	cookieToken := sessionCookie(c)
+	if authHeader == "" && cookieToken == "" {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Missing Authorization header"})
 	}
 
-	// Check if the token starts with "Bearer "
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Malformed Authorization header"})
+	// Authenticate API keys separately, since they are not JWTs
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return apiKeyAuth(c, strings.TrimPrefix(authHeader, "ApiKey "))
 	}
 
-	// Extract the token from the header
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	tokenString := cookieToken
+	if authHeader != "" {
+		// Check if the token starts with "Bearer "
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Malformed Authorization header"})
+		}
+
+		// Extract the token from the header
+		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+	}
 
 	// Parse the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -34,7 +53,7 @@ func AuthMiddleware(c *fiber.Ctx) error {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		// Return the secret key for validation
-		secretKey := config.GetEnv("JWT_SECRET", "your_jwt_secret_key")
+		secretKey := config.FromContext(c).Auth.JWTSecret
 		return []byte(secretKey), nil
 	})
 
@@ -52,10 +71,105 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid JWT claims"})
 	}
 
+	// Reject tokens whose session was revoked. Tokens issued before sessions were recorded carry no session ID,
+	// but cookies and impersonation tokens always do.
+	sid, ok := claims["sid"].(string)
+	if !ok && (authHeader == "" || claims["act"] != nil) {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid JWT claims"})
+	}
+	if ok {
+		sessionID, err := primitive.ObjectIDFromHex(sid)
+		if err != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid JWT claims"})
+		}
+
+		// The cookie is sent by the browser on its own, so requests that change state must also prove they
+		// come from the frontend by echoing the session's CSRF token
+		if authHeader == "" && !csrfSafeMethod(c.Method()) {
+			expected := services.SessionCSRFToken(config.FromContext(c).Auth.JWTSecret, sessionID)
+			if subtle.ConstantTimeCompare([]byte(c.Get("X-CSRF-Token")), []byte(expected)) != 1 {
+				return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Missing or invalid CSRF token"})
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		err = services.CheckSession(ctx, sessionID)
+		if errors.Is(err, services.ErrSessionEnded) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked or has expired"})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check session"})
+		}
+		c.Locals("sessionID", sid)
+	}
+
 	// Store user ID and role in the context
 	c.Locals("userID", claims["id"])
 	c.Locals("userRole", claims["role"])
 
+	// Store when the user signed in, if the token records it
+	if issuedAt, ok := claims["iat"].(float64); ok {
+		c.Locals("authTime", int64(issuedAt))
+	}
+
+	// An impersonation token names the administrator using it; everything they do with it is audited
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		impersonatorID, _ := act["sub"].(string)
+		if impersonatorID == "" {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid JWT claims"})
+		}
+		c.Locals("impersonatorID", impersonatorID)
+
+		err := c.Next()
+
+		event := audit.NewEvent(c, "impersonation.request")
+		event.TargetType = "user"
+		event.TargetID, _ = claims["id"].(string)
+		event.Metadata = map[string]string{
+			"method": c.Method(),
+			"path":   c.Path(),
+			"status": strconv.Itoa(c.Response().StatusCode()),
+		}
+		audit.Record(event)
+		return err
+	}
+
+	return c.Next()
+}
+
+// OptionalAuthMiddleware verifies the JWT token when one is sent and otherwise continues without a user
+func OptionalAuthMiddleware(c *fiber.Ctx) error {
+	if c.Get("Authorization") == "" && sessionCookie(c) == "" {
+		return c.Next()
+	}
+	return AuthMiddleware(c)
+}
+
+// sessionCookie returns the token in the session cookie, when cookie mode is enabled
+func sessionCookie(c *fiber.Ctx) string {
+	cfg := config.FromContext(c)
+	if !cfg.Auth.CookieMode {
+		return ""
+	}
+	return c.Cookies(cfg.Auth.CookieName)
+}
+
+// csrfSafeMethod reports whether a request method only reads, so it needs no CSRF token
+func csrfSafeMethod(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
+// InteractiveOnlyMiddleware blocks actions only the user may take themselves, such as changing how they
+// sign in or deleting their account. Administrators impersonating the user and API keys are refused.
+func InteractiveOnlyMiddleware(c *fiber.Ctx) error {
+	if _, ok := c.Locals("impersonatorID").(string); ok {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "This action is not allowed while impersonating a user"})
+	}
+	if _, ok := c.Locals("apiKeyID").(string); ok {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "This action is not allowed with an API key"})
+	}
 	return c.Next()
 }
 
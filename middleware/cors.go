@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"strings"
+
+	"myfibergotemplate/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORSMiddleware allows cross-origin requests from the configured origins, including wildcard subdomains
+func CORSMiddleware(cfg config.CORSConfig) fiber.Handler {
+	return cors.New(cors.Config{
+		AllowOriginsFunc: originMatcher(cfg.AllowedOrigins),
+		AllowCredentials: cfg.AllowCredentials,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Request-ID, X-Auth-Mode, X-CSRF-Token",
+		AllowMethods:     "GET, POST, HEAD, PUT, DELETE, PATCH",
+		ExposeHeaders:    "X-Request-ID",
+		MaxAge:           cfg.MaxAge,
+	})
+}
+
+// originMatcher returns a function reporting whether an origin is allowed.
+// An allowed origin such as https://*.example.com matches any subdomain of example.com but not example.com itself.
+func originMatcher(allowed []string) func(origin string) bool {
+	exact := make(map[string]bool)
+	var wildcards [][2]string // Prefix and suffix around the wildcard
+	for _, origin := range allowed {
+		if origin == "*" {
+			return func(string) bool { return true }
+		}
+		if scheme, host, ok := strings.Cut(origin, "://*."); ok {
+			wildcards = append(wildcards, [2]string{scheme + "://", "." + host})
+			continue
+		}
+		exact[origin] = true
+	}
+
+	return func(origin string) bool {
+		origin = strings.ToLower(origin)
+		if exact[origin] {
+			return true
+		}
+		for _, wildcard := range wildcards {
+			if !strings.HasPrefix(origin, wildcard[0]) || !strings.HasSuffix(origin, wildcard[1]) {
+				continue
+			}
+			subdomain := strings.TrimSuffix(strings.TrimPrefix(origin, wildcard[0]), wildcard[1])
+			if subdomain != "" && !strings.ContainsAny(subdomain, ":/@") {
+				return true
+			}
+		}
+		return false
+	}
+}
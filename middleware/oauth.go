@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ScopedAuthMiddleware accepts either a first-party JWT or an OAuth access token granting scope.
+// OAuth tokens act on behalf of their user without administrator rights.
+func ScopedAuthMiddleware(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if !services.IsOAuthAccessToken(tokenString) {
+			return AuthMiddleware(c)
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		token, err := services.FindActiveOAuthToken(ctx, tokenString)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid access token"})
+		}
+		if token.UserID == nil || !slices.Contains(token.Scopes, scope) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access token lacks the " + scope + " scope"})
+		}
+
+		// Tokens stop working once their user is suspended or deleted
+		if !services.OAuthUserActive(ctx, *token.UserID) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid access token"})
+		}
+
+		// Store the token's user and client in the context
+		c.Locals("userID", token.UserID.Hex())
+		c.Locals("userRole", "")
+		c.Locals("oauthClientID", token.ClientID)
+		c.Locals("oauthScopes", token.Scopes)
+
+		return c.Next()
+	}
+}
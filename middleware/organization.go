@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"myfibergotemplate/models"
+	"myfibergotemplate/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OrganizationMiddleware lets members of the organization named by the orgId parameter through when they
+// hold one of roles, or any role when none are given. Administrators may act on every organization.
+// The organization ID and the member's role are stored in the context.
+func OrganizationMiddleware(roles ...models.OrgRole) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		orgID, err := primitive.ObjectIDFromHex(c.Params("orgId"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid organization ID"})
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), 10*time.Second)
+		defer cancel()
+
+		if c.Locals("userRole") == string(models.Administrator) {
+			if _, err := services.FindOrganization(ctx, orgID); err != nil {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+			}
+			c.Locals("orgID", orgID.Hex())
+			return c.Next()
+		}
+
+		userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+		if err != nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied."})
+		}
+
+		// Organizations the user does not belong to are reported as missing
+		member, err := services.FindOrganizationMember(ctx, orgID, userID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check organization membership"})
+		}
+		if len(roles) > 0 && !slices.Contains(roles, member.Role) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Your organization role cannot do this."})
+		}
+
+		c.Locals("orgID", orgID.Hex())
+		c.Locals("orgRole", string(member.Role))
+		return c.Next()
+	}
+}
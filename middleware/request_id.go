@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"log/slog"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// validRequestID limits incoming request IDs to a safe character set and length
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,128}$`)
+
+// RequestIDMiddleware honors a valid incoming X-Request-ID header or generates a new ID.
+// The ID is echoed in the response and attached to a request-scoped logger.
+func RequestIDMiddleware(c *fiber.Ctx) error {
+	requestID := c.Get(fiber.HeaderXRequestID)
+	if !validRequestID.MatchString(requestID) {
+		requestID = utils.UUIDv4()
+	}
+
+	c.Set(fiber.HeaderXRequestID, requestID)
+	c.Locals("requestID", requestID)
+	c.Locals("logger", slog.Default().With("request_id", requestID))
+
+	return c.Next()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"strconv"
+
+	"myfibergotemplate/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SecurityHeadersMiddleware sets HSTS, CSP, X-Frame-Options, Referrer-Policy and X-Content-Type-Options on every response
+func SecurityHeadersMiddleware(cfg config.SecurityConfig) fiber.Handler {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(cfg.HSTSMaxAge)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		if cfg.ContentSecurityPolicy != "" {
+			c.Set(fiber.HeaderContentSecurityPolicy, cfg.ContentSecurityPolicy)
+		}
+		if cfg.FrameOptions != "" {
+			c.Set(fiber.HeaderXFrameOptions, cfg.FrameOptions)
+		}
+		if cfg.ReferrerPolicy != "" {
+			c.Set(fiber.HeaderReferrerPolicy, cfg.ReferrerPolicy)
+		}
+
+		// Browsers ignore HSTS over plain HTTP; Protocol honours X-Forwarded-Proto from trusted proxies
+		if hsts != "" && c.Protocol() == "https" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What an API key may do on its merchant's behalf
+const (
+	APIKeyScopeRead  = "read"  // Make GET and HEAD requests
+	APIKeyScopeWrite = "write" // Make requests that change data
+)
+
+// APIKey lets a merchant's backend call the API as the merchant. Only a hash of the secret is stored;
+// the prefix identifies the key in lists and logs.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"-" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	SecretHash string             `json:"-" bson:"secret_hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"` // Unset for keys that do not expire
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	LastUsedIP string             `json:"last_used_ip,omitempty" bson:"last_used_ip,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	RevokedAt  *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
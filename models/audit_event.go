@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditChange is the before and after value of a changed field, rendered as text
+type AuditChange struct {
+	Before string `json:"before" bson:"before"`
+	After  string `json:"after" bson:"after"`
+}
+
+// AuditEvent is an append-only record of a security or administrative event.
+// Each event stores the hash of the previous one so tampering breaks the chain.
+type AuditEvent struct {
+	ID             primitive.ObjectID     `json:"id" bson:"_id"`
+	Sequence       int64                  `json:"sequence" bson:"sequence"`
+	Timestamp      time.Time              `json:"timestamp" bson:"timestamp"`
+	Action         string                 `json:"action" bson:"action"`
+	Outcome        AuditOutcome           `json:"outcome" bson:"outcome"`
+	ActorID        string                 `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorRole      string                 `json:"actor_role,omitempty" bson:"actor_role,omitempty"`
+	ImpersonatorID string                 `json:"impersonator_id,omitempty" bson:"impersonator_id,omitempty"` // The administrator acting as the actor
+	TargetType     string                 `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID       string                 `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP             string                 `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent      string                 `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestID      string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Changes        map[string]AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	Metadata       map[string]string      `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	PrevHash       string                 `json:"prev_hash" bson:"prev_hash"`
+	Hash           string                 `json:"hash" bson:"hash"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BulkAction string
+
+const (
+	BulkApprove            BulkAction = "approve"
+	BulkSuspend            BulkAction = "suspend"
+	BulkDelete             BulkAction = "delete"
+	BulkResendVerification BulkAction = "resend_verification"
+	BulkChangeRole         BulkAction = "change_role"
+)
+
+type BulkJobStatus string
+
+const (
+	BulkJobQueued    BulkJobStatus = "queued"
+	BulkJobRunning   BulkJobStatus = "running"
+	BulkJobCompleted BulkJobStatus = "completed"
+	BulkJobFailed    BulkJobStatus = "failed"
+)
+
+type BulkItemStatus string
+
+const (
+	BulkItemSucceeded    BulkItemStatus = "succeeded"
+	BulkItemFailed       BulkItemStatus = "failed"
+	BulkItemSkipped      BulkItemStatus = "skipped"
+	BulkItemWouldSucceed BulkItemStatus = "would_succeed"
+)
+
+// UserFilter selects users by their attributes instead of by explicit IDs
+type UserFilter struct {
+	Status        Status     `json:"status,omitempty" bson:"status,omitempty"`
+	Role          Role       `json:"role,omitempty" bson:"role,omitempty"`
+	EmailStatus   *bool      `json:"email_status,omitempty" bson:"email_status,omitempty"`
+	Search        string     `json:"search,omitempty" bson:"search,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty" bson:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty" bson:"created_before,omitempty"`
+	Deleted       string     `json:"deleted,omitempty" bson:"deleted,omitempty"` // "include" or "only"; deleted users are excluded by default
+}
+
+// BulkJobItem records the outcome of a bulk action for a single user. Items are stored apart from their job,
+// in processing order.
+type BulkJobItem struct {
+	ID     primitive.ObjectID `json:"-" bson:"_id"`
+	JobID  primitive.ObjectID `json:"-" bson:"job_id"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Email  string             `json:"email,omitempty" bson:"email,omitempty"`
+	Status BulkItemStatus     `json:"status" bson:"status"`
+	Error  string             `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// BulkJob is a tracked bulk operation started by an administrator
+type BulkJob struct {
+	ID          primitive.ObjectID   `json:"id" bson:"_id"`
+	Action      BulkAction           `json:"action" bson:"action"`
+	Role        Role                 `json:"role,omitempty" bson:"role,omitempty"`
+	UserIDs     []primitive.ObjectID `json:"user_ids,omitempty" bson:"user_ids,omitempty"`
+	Filter      *UserFilter          `json:"filter,omitempty" bson:"filter,omitempty"`
+	DryRun      bool                 `json:"dry_run" bson:"dry_run"`
+	Status      BulkJobStatus        `json:"status" bson:"status"`
+	Total       int                  `json:"total" bson:"total"`
+	Processed   int                  `json:"processed" bson:"processed"`
+	Succeeded   int                  `json:"succeeded" bson:"succeeded"`
+	Failed      int                  `json:"failed" bson:"failed"`
+	Skipped     int                  `json:"skipped" bson:"skipped"`
+	Results     []BulkJobItem        `json:"results" bson:"-"` // Loaded from the bulk_job_items collection
+	Error       string               `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedBy   string               `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
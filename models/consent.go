@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ConsentType string
+
+const (
+	TermsAndConditionsConsent ConsentType = "terms_and_conditions"
+)
+
+// ConsentRecord is an append-only record of a user granting or withdrawing consent
+type ConsentRecord struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Type      ConsentType        `json:"type" bson:"type"`
+	Granted   bool               `json:"granted" bson:"granted"`
+	Version   string             `json:"version,omitempty" bson:"version,omitempty"` // Terms version, when the consent is for a versioned document
+	Source    string             `json:"source" bson:"source"`                       // Where the change happened, e.g. "signup" or "profile_update"
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of a login at an external identity provider
+const (
+	FederatedLogin      = "login"      // Sign in, linking or creating an account as needed
+	FederatedLink       = "link"       // Link the provider account to the signed-in user
+	FederatedInvitation = "invitation" // Accept an invitation, creating the account or adding the invitee to an organization
+)
+
+// FederatedIdentity links a user to their account at an external identity provider
+type FederatedIdentity struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Provider    string             `json:"provider" bson:"provider"`
+	Subject     string             `json:"subject" bson:"subject"` // The user's ID at the provider
+	Email       string             `json:"email,omitempty" bson:"email,omitempty"`
+	LinkedAt    time.Time          `json:"linked_at" bson:"linked_at"`
+	LastLoginAt *time.Time         `json:"last_login_at,omitempty" bson:"last_login_at,omitempty"`
+}
+
+// FederatedLoginState remembers a login started at an external identity provider until it calls back
+type FederatedLoginState struct {
+	ID           primitive.ObjectID  `bson:"_id"`
+	StateHash    string              `bson:"state_hash"`
+	Provider     string              `bson:"provider"`
+	Purpose      string              `bson:"purpose"`
+	UserID       *primitive.ObjectID `bson:"user_id,omitempty"`       // The user linking an account
+	InvitationID *primitive.ObjectID `bson:"invitation_id,omitempty"` // The invitation being accepted
+	Nonce        string              `bson:"nonce"`
+	CodeVerifier string              `bson:"code_verifier"`
+	ExpiresAt    time.Time           `bson:"expires_at"`
+	CreatedAt    time.Time           `bson:"created_at"`
+}
+
+// FederatedLoginCode is a short-lived, single-use code the frontend exchanges for a session after a federated login
+type FederatedLoginCode struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	CodeHash  string             `bson:"code_hash"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Provider  string             `bson:"provider"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitation asks someone, by email, to create an account or to join an organization. Administrators
+// invite to the platform with a role; organization owners and admins invite to their organization.
+// Only a hash of its token is stored.
+type Invitation struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id"`
+	TokenHash      string              `json:"-" bson:"token_hash"`
+	Email          string              `json:"email" bson:"email"`
+	Role           Role                `json:"role" bson:"role"`                                           // Role of the account created for the invitee
+	MerchantName   string              `json:"merchant_name,omitempty" bson:"merchant_name,omitempty"`     // Merchant name of the account created
+	PreApproved    bool                `json:"pre_approved" bson:"pre_approved"`                           // Whether the account created skips admin approval
+	OrganizationID *primitive.ObjectID `json:"organization_id,omitempty" bson:"organization_id,omitempty"` // The organization the invitee joins, if any
+	OrgRole        OrgRole             `json:"org_role,omitempty" bson:"org_role,omitempty"`               // Their role in it
+	UserID         *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`                 // The account created ahead of acceptance, for imported users
+	InvitedBy      primitive.ObjectID  `json:"invited_by" bson:"invited_by"`
+	ExpiresAt      time.Time           `json:"expires_at" bson:"expires_at"`
+	SentAt         time.Time           `json:"sent_at" bson:"sent_at"`
+	SendCount      int                 `json:"send_count" bson:"send_count"`
+	AcceptedAt     *time.Time          `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+	AcceptedBy     *primitive.ObjectID `json:"accepted_by,omitempty" bson:"accepted_by,omitempty"` // The user who accepted it
+	RevokedAt      *time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MagicLink is a single-use, short-lived link that signs a user in without a password
+type MagicLink struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	TokenHash  string             `bson:"token_hash"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	IPAddress  string             `bson:"ip_address,omitempty"`  // Set when the link is bound to the requesting IP address
+	DeviceHash string             `bson:"device_hash,omitempty"` // Set when the link is bound to the requesting browser
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	UsedAt     *time.Time         `bson:"used_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+}
+
+// MagicLinkRequest records a request for a sign-in link, whether or not the email has an account, so
+// requests can be rate limited without revealing which emails do
+type MagicLinkRequest struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Email     string             `bson:"email"` // Lowercased so the limit cannot be dodged by changing case
+	IPAddress string             `bson:"ip_address"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
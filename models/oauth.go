@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuth 2.0 grant types supported by the authorization server
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuth 2.0 and OpenID Connect scopes that clients can request
+const (
+	ScopeOpenID        = "openid"         // Receive an ID token and call the UserInfo endpoint
+	ScopeProfile       = "profile"        // Read the user's profile
+	ScopeEmail         = "email"          // Read the user's email address
+	ScopePhone         = "phone"          // Read the user's phone number
+	ScopeAddress       = "address"        // Read the user's address
+	ScopeProfileWrite  = "profile:write"  // Update the user's profile
+	ScopeOfflineAccess = "offline_access" // Receive a refresh token
+)
+
+// OAuthScopes describes each scope for consent screens
+var OAuthScopes = map[string]string{
+	ScopeOpenID:        "Sign you in with your TalentDev account",
+	ScopeProfile:       "View your merchant profile",
+	ScopeEmail:         "View your email address",
+	ScopePhone:         "View your phone number",
+	ScopeAddress:       "View your address",
+	ScopeProfileWrite:  "Update your merchant profile",
+	ScopeOfflineAccess: "Stay connected when you are not using the application",
+}
+
+type OAuthTokenType string
+
+const (
+	AccessToken  OAuthTokenType = "access_token"
+	RefreshToken OAuthTokenType = "refresh_token"
+)
+
+// OAuthClient is a partner application registered with the authorization server
+type OAuthClient struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id"`
+	ClientID         string             `json:"client_id" bson:"client_id"`
+	ClientSecretHash string             `json:"-" bson:"client_secret_hash,omitempty"`
+	Name             string             `json:"name" bson:"name"`
+	Confidential     bool               `json:"confidential" bson:"confidential"` // Public clients, e.g. mobile apps, have no secret
+	RedirectURIs     []string           `json:"redirect_uris" bson:"redirect_uris"`
+	LogoutURIs       []string           `json:"post_logout_redirect_uris,omitempty" bson:"post_logout_redirect_uris,omitempty"`
+	GrantTypes       []string           `json:"grant_types" bson:"grant_types"`
+	Scopes           []string           `json:"scopes" bson:"scopes"` // Scopes the client may request
+	CreatedBy        string             `json:"created_by" bson:"created_by"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	RevokedAt        *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// OAuthAuthorizationCode is a single-use code exchanged for tokens, bound to a PKCE challenge
+type OAuthAuthorizationCode struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id"`
+	CodeHash            string             `json:"-" bson:"code_hash"`
+	ClientID            string             `json:"client_id" bson:"client_id"`
+	UserID              primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RedirectURI         string             `json:"redirect_uri" bson:"redirect_uri"`
+	Scopes              []string           `json:"scopes" bson:"scopes"`
+	CodeChallenge       string             `json:"-" bson:"code_challenge"`
+	CodeChallengeMethod string             `json:"-" bson:"code_challenge_method"`
+	Nonce               string             `json:"-" bson:"nonce,omitempty"`
+	AuthTime            *time.Time         `json:"auth_time,omitempty" bson:"auth_time,omitempty"` // When the user last signed in
+	ExpiresAt           time.Time          `json:"expires_at" bson:"expires_at"`
+	UsedAt              *time.Time         `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// OAuthToken is an issued access or refresh token; only a hash of the token is stored.
+// Tokens descending from the same authorization share a family ID so they can be revoked together.
+type OAuthToken struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id"`
+	TokenHash string              `json:"-" bson:"token_hash"`
+	Type      OAuthTokenType      `json:"type" bson:"type"`
+	FamilyID  primitive.ObjectID  `json:"family_id" bson:"family_id"`
+	ClientID  string              `json:"client_id" bson:"client_id"`
+	UserID    *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"` // Empty for client_credentials tokens
+	Scopes    []string            `json:"scopes" bson:"scopes"`
+	AuthTime  *time.Time          `json:"auth_time,omitempty" bson:"auth_time,omitempty"`
+	ExpiresAt time.Time           `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+	RevokedAt *time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// OAuthConsent records the scopes a user has allowed a client to access
+type OAuthConsent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ClientID  string             `json:"client_id" bson:"client_id"`
+	Scopes    []string           `json:"scopes" bson:"scopes"`
+	GrantedAt time.Time          `json:"granted_at" bson:"granted_at"`
+	RevokedAt *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrgRole string
+
+// Roles of members within an organization
+const (
+	OrgOwner OrgRole = "owner" // Manages the organization and its members; there is exactly one
+	OrgAdmin OrgRole = "admin" // Edits the profile and invites staff
+	OrgStaff OrgRole = "staff" // Works under the merchant account
+)
+
+// Organization is a merchant's store, holding its profile and shared by its members
+type Organization struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	MerchantName string             `json:"merchant_name" bson:"merchant_name"`
+	Website      string             `json:"website" bson:"website"`
+	Address      string             `json:"address" bson:"address"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// OrganizationMember gives a user a role in an organization
+type OrganizationMember struct {
+	ID             primitive.ObjectID `json:"-" bson:"_id"`
+	OrganizationID primitive.ObjectID `json:"organization_id" bson:"organization_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role           OrgRole            `json:"role" bson:"role"`
+	JoinedAt       time.Time          `json:"joined_at" bson:"joined_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SAMLConnection is an organization's SAML 2.0 identity provider
+type SAMLConnection struct {
+	ID               primitive.ObjectID   `json:"id" bson:"_id"`
+	Slug             string               `json:"slug" bson:"slug"` // Used in URLs, e.g. /saml/acme/login
+	Organization     string               `json:"organization" bson:"organization"`
+	Domains          []string             `json:"domains" bson:"domains"` // Email domains the identity provider vouches for
+	IdPEntityID      string               `json:"idp_entity_id" bson:"idp_entity_id"`
+	IdPMetadata      string               `json:"-" bson:"idp_metadata"` // The identity provider's metadata XML
+	AttributeMapping SAMLAttributeMapping `json:"attribute_mapping" bson:"attribute_mapping"`
+	CreatedBy        string               `json:"created_by" bson:"created_by"`
+	CreatedAt        time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// SAMLAttributeMapping names the assertion attributes that fill in user fields; an empty name leaves the field alone.
+// Attributes are matched by Name or FriendlyName.
+type SAMLAttributeMapping struct {
+	Email          string `json:"email" bson:"email"` // Falls back to an email-formatted NameID
+	PersonInCharge string `json:"person_in_charge" bson:"person_in_charge"`
+	MerchantName   string `json:"merchant_name" bson:"merchant_name"`
+	PhoneNumber    string `json:"phone_number" bson:"phone_number"`
+	Website        string `json:"website" bson:"website"`
+	Address        string `json:"address" bson:"address"`
+}
+
+// SAMLRequest remembers an authentication request sent to an identity provider until it answers
+type SAMLRequest struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	RelayStateHash string             `bson:"relay_state_hash"`
+	RequestID      string             `bson:"request_id"` // Must match InResponseTo in the assertion
+	Connection     string             `bson:"connection"`
+	ExpiresAt      time.Time          `bson:"expires_at"`
+	CreatedAt      time.Time          `bson:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a sign-in on one device. The session token carries its ID, so revoking the session
+// signs that device out.
+type Session struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id"`
+	UserID         primitive.ObjectID  `json:"-" bson:"user_id"`
+	DeviceHash     string              `json:"-" bson:"device_hash"` // Identifies the browser, to notice sign-ins from new devices
+	DeviceName     string              `json:"device" bson:"device_name"`
+	UserAgent      string              `json:"user_agent" bson:"user_agent"`
+	IPAddress      string              `json:"ip_address" bson:"ip_address"`
+	Location       *SessionLocation    `json:"location,omitempty" bson:"location,omitempty"`
+	Method         string              `json:"method" bson:"method"`                                       // How the user signed in
+	ImpersonatorID *primitive.ObjectID `json:"impersonator_id,omitempty" bson:"impersonator_id,omitempty"` // The administrator using the session, for impersonation
+	Current        bool                `json:"current" bson:"-"`                                           // Set when listing sessions, for the session making the request
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+	LastSeenAt     time.Time           `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt      time.Time           `json:"expires_at" bson:"expires_at"`
+	RevokedAt      *time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// SessionLocation is the approximate location of a session's IP address
+type SessionLocation struct {
+	City        string `json:"city,omitempty" bson:"city,omitempty"`
+	Region      string `json:"region,omitempty" bson:"region,omitempty"`
+	Country     string `json:"country,omitempty" bson:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty" bson:"country_code,omitempty"`
+}
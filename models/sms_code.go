@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of a code sent by SMS
+const (
+	SMSVerifyPhone = "verify_phone" // Proving the user owns their phone number
+	SMSSignIn      = "signin"       // Confirming a sign-in
+)
+
+// SMSCode is a short-lived one-time code sent to a user's phone
+type SMSCode struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	UserID      primitive.ObjectID `bson:"user_id"`
+	Purpose     string             `bson:"purpose"`
+	PhoneNumber string             `bson:"phone_number"`
+	CodeHash    string             `bson:"code_hash"`
+	TokenHash   string             `bson:"token_hash,omitempty"`   // Identifies a sign-in waiting for its code
+	FirstMethod string             `bson:"first_method,omitempty"` // How the user signed in before the code
+	Attempts    int                `bson:"attempts"`
+	ExpiresAt   time.Time          `bson:"expires_at"`
+	CreatedAt   time.Time          `bson:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TermsVersion is a published version of the terms and conditions
+type TermsVersion struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	Version     string             `json:"version" bson:"version" validate:"required"`
+	URL         string             `json:"url" bson:"url"`
+	Summary     string             `json:"summary,omitempty" bson:"summary,omitempty"`
+	Required    bool               `json:"required" bson:"required"` // Whether users must accept this version before signing in
+	PublishedAt time.Time          `json:"published_at" bson:"published_at"`
+	CreatedBy   string             `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// TermsAcceptance records a user accepting a specific version of the terms and conditions
+type TermsAcceptance struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Version    string             `json:"version" bson:"version"`
+	Source     string             `json:"source" bson:"source"`
+	IP         string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent  string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	AcceptedAt time.Time          `json:"accepted_at" bson:"accepted_at"`
+}
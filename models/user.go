@@ -16,24 +16,35 @@ const (
 type Status string
 
 const (
-	Approved Status = "approved"
-	Pending  Status = "pending"
+	Approved  Status = "approved"
+	Pending   Status = "pending"
+	Suspended Status = "suspended"
 )
 
 type User struct {
-	ID                 primitive.ObjectID `bson:"_id"`
-	MerchantName       string             `json:"merchant_name" bson:"merchant_name" validate:"required"`
-	Status             Status             `json:"status" bson:"status" validate:"omitempty,oneof=approved pending"`
-	Email              string             `json:"email" bson:"email" validate:"required,email"`
-	EmailStatus        bool               `json:"email_status" bson:"email_status"`
-	Role               Role               `json:"role" bson:"role" validate:"required,oneof=administrator merchant"`
-	PersonInCharge     string             `json:"person_in_charge" bson:"person_in_charge" validate:"required"`
-	PhoneNumber        string             `json:"phone_number" bson:"phone_number"`
-	Website            string             `json:"website" bson:"website"`
-	Address            string             `json:"address" bson:"address"`
-	Password           string             `json:"password,omitempty" bson:"password"`
-	VerificationToken  string             `json:"-" bson:"verification_token,omitempty"`
-	TermsAndConditions bool               `json:"terms_and_conditions" bson:"terms_and_conditions" validate:"required"`
-	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
+	ID                 primitive.ObjectID   `bson:"_id"`
+	MerchantName       string               `json:"merchant_name" bson:"-" validate:"required"` // Held by the user's organization; see services.LoadMerchantProfile
+	Status             Status               `json:"status" bson:"status" validate:"omitempty,oneof=approved pending suspended"`
+	Email              string               `json:"email" bson:"email" validate:"required,email"`
+	EmailStatus        bool                 `json:"email_status" bson:"email_status"`
+	Role               Role                 `json:"role" bson:"role" validate:"required,oneof=administrator merchant"`
+	PersonInCharge     string               `json:"person_in_charge" bson:"person_in_charge" validate:"required"`
+	PhoneNumber        string               `json:"phone_number" bson:"phone_number"`
+	PhoneVerified      bool                 `json:"phone_verified" bson:"phone_verified"`
+	PhoneVerifiedAt    *time.Time           `json:"phone_verified_at,omitempty" bson:"phone_verified_at,omitempty"`
+	Website            string               `json:"website" bson:"-"` // Held by the user's organization
+	Address            string               `json:"address" bson:"-"` // Held by the user's organization
+	Password           string               `json:"password,omitempty" bson:"password"`
+	VerificationToken  string               `json:"-" bson:"verification_token,omitempty"`
+	TermsAndConditions bool                 `json:"terms_and_conditions" bson:"terms_and_conditions" validate:"required"`
+	TermsVersion       string               `json:"terms_version,omitempty" bson:"terms_version,omitempty"`
+	TermsAcceptedAt    *time.Time           `json:"terms_accepted_at,omitempty" bson:"terms_accepted_at,omitempty"`
+	PasskeyRequired    bool                 `json:"passkey_required,omitempty" bson:"passkey_required,omitempty"`   // Sign-ins are confirmed with a passkey
+	SMSCodeRequired    bool                 `json:"sms_code_required,omitempty" bson:"sms_code_required,omitempty"` // Sign-ins are confirmed with a code sent by SMS
+	CreatedAt          time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time            `json:"updated_at" bson:"updated_at"`
+	DeletedAt          *time.Time           `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy          string               `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	DeletedMemberships []OrganizationMember `json:"-" bson:"deleted_memberships,omitempty"` // Organization memberships removed on deletion, given back on restore
+	AnonymizedAt       *time.Time           `json:"anonymized_at,omitempty" bson:"anonymized_at,omitempty"`
 }
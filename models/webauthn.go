@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ceremonies a WebAuthn session can belong to
+const (
+	WebAuthnRegistration = "registration"  // Adding a passkey to the signed-in user
+	WebAuthnSignIn       = "signin"        // Signing in with a passkey alone
+	WebAuthnSecondFactor = "second_factor" // Confirming a sign-in with a passkey
+)
+
+// WebAuthnCredential is a passkey or security key registered to a user
+type WebAuthnCredential struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	UserID          primitive.ObjectID `json:"-" bson:"user_id"`
+	Name            string             `json:"name" bson:"name"`
+	CredentialID    []byte             `json:"-" bson:"credential_id"`
+	PublicKey       []byte             `json:"-" bson:"public_key"`
+	AttestationType string             `json:"-" bson:"attestation_type"`
+	Transports      []string           `json:"transports,omitempty" bson:"transports,omitempty"`
+	AAGUID          []byte             `json:"-" bson:"aaguid,omitempty"`
+	SignCount       uint32             `json:"sign_count" bson:"sign_count"`
+	BackupEligible  bool               `json:"backup_eligible" bson:"backup_eligible"` // A synced passkey rather than a device-bound key
+	BackupState     bool               `json:"backup_state" bson:"backup_state"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt      *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+// WebAuthnSession holds the challenge of a WebAuthn ceremony until the browser answers it
+type WebAuthnSession struct {
+	ID          primitive.ObjectID  `bson:"_id"`
+	TokenHash   string              `bson:"token_hash"`
+	Purpose     string              `bson:"purpose"`
+	UserID      *primitive.ObjectID `bson:"user_id,omitempty"`      // Unset for passkey sign-in, where the passkey names the user
+	FirstMethod string              `bson:"first_method,omitempty"` // How the user signed in before a second factor
+	Data        []byte              `bson:"data"`                   // The ceremony's challenge and options, as the WebAuthn library stores them
+	ExpiresAt   time.Time           `bson:"expires_at"`
+}
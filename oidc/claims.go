@@ -0,0 +1,36 @@
+package oidc
+
+import (
+	"slices"
+
+	"myfibergotemplate/models"
+)
+
+// UserClaims maps a user to the standard OpenID Connect claims released by the granted scopes
+func UserClaims(user models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": user.ID.Hex(),
+	}
+
+	if slices.Contains(scopes, models.ScopeProfile) {
+		claims["name"] = user.PersonInCharge
+		claims["merchant_name"] = user.MerchantName
+		if user.Website != "" {
+			claims["website"] = user.Website
+		}
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if slices.Contains(scopes, models.ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailStatus
+	}
+	if slices.Contains(scopes, models.ScopePhone) && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = false
+	}
+	if slices.Contains(scopes, models.ScopeAddress) && user.Address != "" {
+		claims["address"] = map[string]string{"formatted": user.Address}
+	}
+
+	return claims
+}
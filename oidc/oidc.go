@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"myfibergotemplate/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	issuer     string
+	signingKey *rsa.PrivateKey
+	keyID      string
+)
+
+// Init loads the ID token signing key, or generates a temporary one when no key file is configured.
+// Tokens signed with a temporary key cannot be verified after a restart.
+func Init(cfg config.OIDCConfig) error {
+	issuer = cfg.Issuer
+
+	if cfg.SigningKeyFile == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		setSigningKey(key)
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot read OIDC signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("OIDC signing key is not PEM encoded")
+	}
+
+	// Accept both PKCS#1 ("RSA PRIVATE KEY") and PKCS#8 ("PRIVATE KEY") encodings
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return fmt.Errorf("cannot parse OIDC signing key: %w", err8)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return errors.New("OIDC signing key must be an RSA key")
+		}
+		key = rsaKey
+	}
+
+	setSigningKey(key)
+	return nil
+}
+
+// setSigningKey installs the key and derives its key ID from the public key
+func setSigningKey(key *rsa.PrivateKey) {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	signingKey = key
+	keyID = base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// Issuer returns the issuer identifier placed in ID tokens and the discovery document
+func Issuer() string {
+	return issuer
+}
+
+// Sign signs claims as an RS256 JWT, adding the issuer
+func Sign(claims jwt.MapClaims) (string, error) {
+	if signingKey == nil {
+		return "", errors.New("OIDC provider is not initialized")
+	}
+	claims["iss"] = issuer
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(signingKey)
+}
+
+// ParseIDTokenHint verifies an ID token we issued, accepting expired tokens as logout hints allow
+func ParseIDTokenHint(tokenString string) (jwt.MapClaims, error) {
+	if signingKey == nil {
+		return nil, errors.New("OIDC provider is not initialized")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return &signingKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["iss"] != issuer {
+		return nil, errors.New("ID token was not issued by this provider")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public signing key as a JSON Web Key Set
+func JWKS() map[string]interface{} {
+	if signingKey == nil {
+		return map[string]interface{}{"keys": []interface{}{}}
+	}
+
+	publicKey := signingKey.PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	}
+}
+
+// AccessTokenHash returns the at_hash claim for an access token: the left half of its SHA-256 digest
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,237 @@
+// Package passkey runs WebAuthn registration and authentication ceremonies for FiberAuth users.
+package passkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Timeout is how long the browser has to complete a ceremony
+const Timeout = 5 * time.Minute
+
+// ErrCloned is returned when an authenticator's signature counter went backwards, which means its key was copied
+var ErrCloned = errors.New("authenticator may be cloned")
+
+// The relying party, set by Init
+var relyingParty *webauthn.WebAuthn
+
+// Init configures the relying party passkeys are registered with
+func Init(cfg config.WebAuthnConfig) error {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.Origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: Timeout, TimeoutUVD: Timeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: Timeout, TimeoutUVD: Timeout},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	relyingParty = rp
+	return nil
+}
+
+// User is a FiberAuth user together with their registered credentials
+type User struct {
+	user        models.User
+	credentials []models.WebAuthnCredential
+}
+
+// NewUser wraps a user and their credentials for a ceremony
+func NewUser(user models.User, credentials []models.WebAuthnCredential) *User {
+	return &User{user: user, credentials: credentials}
+}
+
+// WebAuthnID is the user handle stored in the passkey: the user's ObjectID
+func (u *User) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+// WebAuthnName is the account name shown when choosing a passkey
+func (u *User) WebAuthnName() string {
+	return u.user.Email
+}
+
+// WebAuthnDisplayName is the person's name shown when choosing a passkey
+func (u *User) WebAuthnDisplayName() string {
+	if u.user.PersonInCharge != "" {
+		return u.user.PersonInCharge
+	}
+	return u.user.MerchantName
+}
+
+// WebAuthnCredentials converts the stored credentials to the library's form
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(stored.Transports))
+		for _, transport := range stored.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              stored.CredentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    stored.AAGUID,
+				SignCount: stored.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// UserID returns the ObjectID a passkey's user handle refers to
+func UserID(userHandle []byte) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+	if len(userHandle) != len(id) {
+		return id, errors.New("invalid user handle")
+	}
+	copy(id[:], userHandle)
+	return id, nil
+}
+
+// BeginRegistration returns the options for creating a new passkey and the session data to keep until it is answered.
+// The user's existing credentials are excluded so the same authenticator is not registered twice.
+func BeginRegistration(user *User) (*protocol.CredentialCreation, []byte, error) {
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := relyingParty.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return creation, data, nil
+}
+
+// FinishRegistration verifies the browser's answer to a registration and returns the new credential, ready to store
+func FinishRegistration(user *User, sessionData, response []byte) (*models.WebAuthnCredential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &session); err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, err
+	}
+	credential, err := relyingParty.CreateCredential(user, session, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	return &models.WebAuthnCredential{
+		ID:              primitive.NewObjectID(),
+		UserID:          user.user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+// BeginLogin returns the options for confirming a sign-in with one of the user's credentials.
+// Without a user any passkey for this site may be used, and it must verify the person holding it.
+func BeginLogin(user *User) (*protocol.CredentialAssertion, []byte, error) {
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		err       error
+	)
+	if user != nil {
+		assertion, session, err = relyingParty.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	} else {
+		assertion, session, err = relyingParty.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return assertion, data, nil
+}
+
+// FinishLogin verifies the browser's answer to a sign-in. When user is nil the passkey names the user,
+// who is loaded with lookup. It returns the credential that was used, with its new signature count.
+func FinishLogin(user *User, lookup func(userID primitive.ObjectID) (*User, error), sessionData, response []byte) (*models.WebAuthnCredential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &session); err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, err
+	}
+
+	var credential *webauthn.Credential
+	if user != nil {
+		credential, err = relyingParty.ValidateLogin(user, session, parsed)
+	} else {
+		credential, err = relyingParty.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			userID, err := UserID(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			if user, err = lookup(userID); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}, session, parsed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrCloned
+	}
+
+	for _, stored := range user.credentials {
+		if bytes.Equal(stored.CredentialID, credential.ID) {
+			stored.SignCount = credential.Authenticator.SignCount
+			stored.BackupState = credential.Flags.BackupState
+			return &stored, nil
+		}
+	}
+	return nil, errors.New("credential not found")
+}
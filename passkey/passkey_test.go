@@ -0,0 +1,241 @@
+package passkey
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/models"
+	"myfibergotemplate/passkey/passkeytest"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testRPID   = "id.example.com"
+	testOrigin = "https://id.example.com"
+)
+
+// registerTestPasskey registers a new software authenticator for a new user
+func registerTestPasskey(t *testing.T) (models.User, *models.WebAuthnCredential, *passkeytest.Authenticator) {
+	t.Helper()
+
+	if err := Init(config.WebAuthnConfig{RPID: testRPID, RPDisplayName: "Test", Origins: []string{testOrigin}}); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: primitive.NewObjectID(), Email: "jane@example.com", MerchantName: "Jane's"}
+	authenticator := passkeytest.NewAuthenticator(testRPID, testOrigin)
+
+	creation, session, err := BeginRegistration(NewUser(user, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Register(sentToBrowser(t, creation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := FinishRegistration(NewUser(user, nil), session, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, credential, authenticator
+}
+
+// signIn answers a discoverable sign-in with authenticator, as the user with credential
+func signIn(t *testing.T, user models.User, credential models.WebAuthnCredential, authenticator *passkeytest.Authenticator) (*models.WebAuthnCredential, error) {
+	t.Helper()
+
+	assertion, session, err := BeginLogin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Assert(sentToBrowser(t, assertion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(userID primitive.ObjectID) (*User, error) {
+		if userID != user.ID {
+			return nil, errors.New("unknown user")
+		}
+		return NewUser(user, []models.WebAuthnCredential{credential}), nil
+	}
+	return FinishLogin(nil, lookup, session, response)
+}
+
+// sentToBrowser returns options as the browser receives them, encoded as JSON
+func sentToBrowser[T any](t *testing.T, options *T) *T {
+	t.Helper()
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received T
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatal(err)
+	}
+	return &received
+}
+
+func TestRegistration(t *testing.T) {
+	user, credential, authenticator := registerTestPasskey(t)
+
+	if credential.UserID != user.ID {
+		t.Errorf("credential belongs to %s, want %s", credential.UserID.Hex(), user.ID.Hex())
+	}
+	if string(credential.CredentialID) != string(authenticator.CredentialID()) {
+		t.Error("credential ID differs from the authenticator's")
+	}
+	if credential.AttestationType != "none" || len(credential.PublicKey) == 0 || credential.SignCount != 0 {
+		t.Errorf("credential is %+v", credential)
+	}
+
+	// The passkey cannot be registered again for the same user
+	creation, _, err := BeginRegistration(NewUser(user, []models.WebAuthnCredential{*credential}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excluded := creation.Response.CredentialExcludeList; len(excluded) != 1 || string(excluded[0].CredentialID) != string(credential.CredentialID) {
+		t.Errorf("excluded credentials are %v, want the registered passkey", excluded)
+	}
+}
+
+func TestRegistrationChecksChallenge(t *testing.T) {
+	user, _, _ := registerTestPasskey(t)
+	authenticator := passkeytest.NewAuthenticator(testRPID, testOrigin)
+
+	creation, _, err := BeginRegistration(NewUser(user, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherSession, err := BeginRegistration(NewUser(user, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Register(creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishRegistration(NewUser(user, nil), otherSession, response); err == nil {
+		t.Error("passkey registered in answer to another challenge")
+	}
+}
+
+func TestRegistrationChecksOrigin(t *testing.T) {
+	user, _, _ := registerTestPasskey(t)
+	authenticator := passkeytest.NewAuthenticator(testRPID, "https://attacker.example")
+
+	creation, session, err := BeginRegistration(NewUser(user, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Register(creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishRegistration(NewUser(user, nil), session, response); err == nil {
+		t.Error("passkey registered from another origin")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	user, credential, authenticator := registerTestPasskey(t)
+
+	for want := uint32(1); want <= 2; want++ {
+		used, err := signIn(t, user, *credential, authenticator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used.ID != credential.ID || used.SignCount != want {
+			t.Errorf("used credential %s with count %d, want %s with count %d", used.ID.Hex(), used.SignCount, credential.ID.Hex(), want)
+		}
+		credential = used
+	}
+}
+
+func TestLoginAsExpectedUser(t *testing.T) {
+	user, credential, authenticator := registerTestPasskey(t)
+
+	assertion, session, err := BeginLogin(NewUser(user, []models.WebAuthnCredential{*credential}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed := assertion.Response.AllowedCredentials; len(allowed) != 1 || string(allowed[0].CredentialID) != string(credential.CredentialID) {
+		t.Errorf("allowed credentials are %v, want the user's passkey", allowed)
+	}
+	response, err := authenticator.Assert(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishLogin(NewUser(user, []models.WebAuthnCredential{*credential}), nil, session, response); err != nil {
+		t.Fatal(err)
+	}
+
+	// Somebody else's passkey does not confirm the sign-in
+	other, otherCredential, _ := registerTestPasskey(t)
+	expected := NewUser(other, []models.WebAuthnCredential{*otherCredential})
+	assertion, session, err = BeginLogin(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = authenticator.Assert(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishLogin(expected, nil, session, response); err == nil {
+		t.Error("another user's passkey confirmed the sign-in")
+	}
+}
+
+func TestLoginRejectsClonedAuthenticator(t *testing.T) {
+	user, credential, authenticator := registerTestPasskey(t)
+
+	for i := 0; i < 3; i++ {
+		used, err := signIn(t, user, *credential, authenticator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		credential = used
+	}
+
+	// A copy of the key that has signed less often than the original
+	authenticator.SignCount = 1
+	if _, err := signIn(t, user, *credential, authenticator); !errors.Is(err, ErrCloned) {
+		t.Errorf("signature counter going backwards gave %v, want ErrCloned", err)
+	}
+}
+
+func TestLoginChecksChallenge(t *testing.T) {
+	user, credential, authenticator := registerTestPasskey(t)
+
+	assertion, _, err := BeginLogin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherSession, err := BeginLogin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := authenticator.Assert(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := func(primitive.ObjectID) (*User, error) {
+		return NewUser(user, []models.WebAuthnCredential{*credential}), nil
+	}
+	if _, err := FinishLogin(nil, lookup, otherSession, response); err == nil {
+		t.Error("assertion accepted in answer to another challenge")
+	}
+}
+
+func TestUserID(t *testing.T) {
+	id := primitive.NewObjectID()
+	if got, err := UserID(NewUser(models.User{ID: id}, nil).WebAuthnID()); err != nil || got != id {
+		t.Errorf("UserID returned %s, %v, want %s", got.Hex(), err, id.Hex())
+	}
+	if _, err := UserID([]byte("short")); err == nil {
+		t.Error("UserID accepted a malformed user handle")
+	}
+}
@@ -0,0 +1,176 @@
+// Package passkeytest provides a software authenticator for testing passkey ceremonies.
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// Authenticator is a platform authenticator holding one P-256 passkey. It answers ceremonies the way a browser
+// would send them to the server, with "none" attestation and a user who is always present and verified.
+type Authenticator struct {
+	RPID   string
+	Origin string
+
+	// SignCount is the signature counter, incremented before each assertion is signed
+	SignCount uint32
+
+	credentialID []byte
+	userHandle   []byte
+	key          *ecdsa.PrivateKey
+}
+
+// NewAuthenticator returns an authenticator for the relying party rpID, used from a page at origin
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	return &Authenticator{RPID: rpID, Origin: origin}
+}
+
+// CredentialID is the ID of the passkey created by Register
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register creates a passkey for the user in creation and returns the browser's response to it
+func (a *Authenticator) Register(creation *protocol.CredentialCreation) ([]byte, error) {
+	userHandle, err := userHandle(creation.Response.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: an all-zero AAGUID, the credential ID with its length, then the public key
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedCredData, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(credentialID)))
+	authData = append(authData, credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.key = key
+	a.credentialID = credentialID
+	a.userHandle = userHandle
+	a.SignCount = 0
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData(protocol.CreateCeremony, creation.Response.Challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+// Assert signs the challenge in assertion with the passkey and returns the browser's response to it
+func (a *Authenticator) Assert(assertion *protocol.CredentialAssertion) ([]byte, error) {
+	if a.key == nil {
+		return nil, errors.New("no passkey registered")
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, a.SignCount)
+	clientData := a.clientData(protocol.AssertCeremony, assertion.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+// authenticatorData starts the authenticator data with the relying party ID hash, flags and signature counter
+func (a *Authenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// clientData is the JSON the browser collects for a ceremony
+func (a *Authenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge.String(),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// userHandle reads the user handle from creation options, whether built by the server or decoded from JSON
+func userHandle(id any) ([]byte, error) {
+	switch id := id.(type) {
+	case protocol.URLEncodedBase64:
+		return id, nil
+	case []byte:
+		return id, nil
+	case string:
+		return base64.RawURLEncoding.DecodeString(id)
+	default:
+		return nil, fmt.Errorf("unsupported user handle %T", id)
+	}
+}
@@ -3,12 +3,39 @@ package routes
 import (
 	"myfibergotemplate/handlers"
 	"myfibergotemplate/middleware"
+	"myfibergotemplate/models"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // SetupRoutes sets up all the routes for the application
 func SetupRoutes(app *fiber.App) {
+	// Liveness and readiness probes
+	app.Get("/healthz", handlers.HealthzHandler)
+	app.Get("/readyz", handlers.ReadyzHandler)
+
+	// OAuth 2.0 authorization server endpoints
+	app.Get("/oauth/authorize", handlers.AuthorizeHandler)
+	app.Post("/oauth/token", handlers.TokenHandler)
+	app.Post("/oauth/introspect", handlers.IntrospectHandler)
+	app.Post("/oauth/revoke", handlers.RevokeTokenHandler)
+
+	// OpenID Connect provider endpoints
+	app.Get("/.well-known/openid-configuration", handlers.OpenIDConfigurationHandler)
+	app.Get("/.well-known/jwks.json", handlers.JWKSHandler)
+	app.Get("/userinfo", middleware.ScopedAuthMiddleware(models.ScopeOpenID), handlers.UserInfoHandler)
+	app.Post("/userinfo", middleware.ScopedAuthMiddleware(models.ScopeOpenID), handlers.UserInfoHandler)
+	app.Get("/oauth/logout", handlers.EndSessionHandler)
+
+	// Sign-in with external identity providers
+	app.Get("/auth/federated/:provider/start", handlers.FederatedStartHandler)
+	app.Get("/auth/federated/:provider/callback", handlers.FederatedCallbackHandler)
+
+	// SAML single sign-on endpoints - one service provider per connection
+	app.Get("/saml/:slug/metadata", handlers.SAMLMetadataHandler)
+	app.Get("/saml/:slug/login", handlers.SAMLLoginHandler)
+	app.Post("/saml/:slug/acs", handlers.SAMLACSHandler)
+
 	api := app.Group("/api")
 
 	// Signup route
@@ -17,27 +44,152 @@ func SetupRoutes(app *fiber.App) {
 	// Sign-in route
 	api.Post("/signin", handlers.SignInHandler)
 
+	// Passwordless sign-in routes
+	api.Post("/signin/magic-link", handlers.RequestMagicLinkHandler)
+	api.Post("/signin/magic-link/verify", handlers.VerifyMagicLinkHandler)
+	api.Post("/signin/passkey/begin", handlers.BeginPasskeySignInHandler)
+	api.Post("/signin/passkey/finish", handlers.FinishPasskeySignInHandler)
+	api.Post("/signin/sms/verify", handlers.VerifySMSSignInHandler)
+
+	// Passkey routes - for the signed-in user
+	api.Post("/webauthn/register/begin", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.BeginPasskeyRegistrationHandler)
+	api.Post("/webauthn/register/finish", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.FinishPasskeyRegistrationHandler)
+	api.Get("/webauthn/credentials", middleware.AuthMiddleware, handlers.ListPasskeysHandler)
+	api.Patch("/webauthn/credentials/:id", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.RenamePasskeyHandler)
+	api.Delete("/webauthn/credentials/:id", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.DeletePasskeyHandler)
+	api.Put("/webauthn/required", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.SetPasskeyRequiredHandler)
+
+	// Phone verification routes - for the signed-in user
+	api.Post("/phone/verification", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.SendPhoneVerificationHandler)
+	api.Post("/phone/verify", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.VerifyPhoneHandler)
+	api.Put("/phone/sms-required", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.SetSMSCodeRequiredHandler)
+
+	// Session routes - for the signed-in user
+	api.Post("/signout", middleware.AuthMiddleware, handlers.SignOutHandler)
+	api.Get("/csrf", middleware.AuthMiddleware, handlers.CSRFTokenHandler)
+	api.Get("/sessions", middleware.AuthMiddleware, handlers.ListSessionsHandler)
+	api.Delete("/sessions", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.RevokeOtherSessionsHandler)
+	api.Delete("/sessions/:id", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.RevokeSessionHandler)
+
+	// API key routes - for the signed-in merchant
+	api.Get("/api-keys", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.ListAPIKeysHandler)
+	api.Post("/api-keys", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.CreateAPIKeyHandler)
+	api.Delete("/api-keys/:id", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.RevokeAPIKeyHandler)
+
+	// Organization routes - access depends on the member's role in the organization
+	api.Post("/organizations/invitations/accept", handlers.AcceptInvitationHandler)
+	api.Get("/organizations", middleware.AuthMiddleware, handlers.ListOrganizationsHandler)
+	api.Post("/organizations", middleware.AuthMiddleware, handlers.CreateOrganizationHandler)
+	api.Get("/organizations/:orgId", middleware.AuthMiddleware, middleware.OrganizationMiddleware(), handlers.GetOrganizationHandler)
+	api.Patch("/organizations/:orgId", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.UpdateOrganizationHandler)
+	api.Get("/organizations/:orgId/members", middleware.AuthMiddleware, middleware.OrganizationMiddleware(), handlers.ListOrganizationMembersHandler)
+	api.Patch("/organizations/:orgId/members/:userId", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner), handlers.UpdateOrganizationMemberHandler)
+	api.Delete("/organizations/:orgId/members/:userId", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.RemoveOrganizationMemberHandler)
+	api.Post("/organizations/:orgId/leave", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, middleware.OrganizationMiddleware(), handlers.LeaveOrganizationHandler)
+	api.Post("/organizations/:orgId/transfer", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, middleware.OrganizationMiddleware(models.OrgOwner), handlers.TransferOrganizationOwnershipHandler)
+	api.Get("/organizations/:orgId/invitations", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.ListOrganizationInvitationsHandler)
+	api.Post("/organizations/:orgId/invitations", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.InviteOrganizationMemberHandler)
+	api.Post("/organizations/:orgId/invitations/:invitationId/resend", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.ResendOrganizationInvitationHandler)
+	api.Delete("/organizations/:orgId/invitations/:invitationId", middleware.AuthMiddleware, middleware.OrganizationMiddleware(models.OrgOwner, models.OrgAdmin), handlers.RevokeOrganizationInvitationHandler)
+
+	// Federated sign-in routes
+	api.Get("/auth/federated/providers", handlers.ListFederatedProvidersHandler)
+	api.Post("/auth/federated/exchange", handlers.FederatedExchangeHandler)
+
+	// SAML connection lookup by email domain
+	api.Get("/saml/discover", handlers.SAMLDiscoverHandler)
+
+	// Linked provider account routes - for the signed-in user
+	api.Get("/auth/federated/identities", middleware.AuthMiddleware, handlers.ListFederatedIdentitiesHandler)
+	api.Post("/auth/federated/:provider/link", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.LinkFederatedIdentityHandler)
+	api.Delete("/auth/federated/identities/:provider", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.UnlinkFederatedIdentityHandler)
+
 	// Email verification route
 	api.Get("/verify", handlers.VerifyEmailHandler)
 
+	// Accept invitation route
+	api.Post("/invitations/accept", handlers.AcceptInvitationHandler)
+
+	// Invitation routes - create accounts with a pre-assigned role, protected by AdminOnlyMiddleware
+	api.Get("/invitations", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListInvitationsHandler)
+	api.Post("/invitations", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.CreateInvitationHandler)
+	api.Post("/invitations/:id/resend", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ResendInvitationHandler)
+	api.Delete("/invitations/:id", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.RevokeInvitationHandler)
+
+	// Terms and conditions routes
+	api.Get("/terms/current", handlers.GetCurrentTermsHandler)
+	api.Post("/terms/accept", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.AcceptTermsHandler)
+	api.Get("/terms", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListTermsVersionsHandler)
+	api.Post("/terms", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.CreateTermsVersionHandler)
+	api.Get("/terms/report", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.TermsAcceptanceReportHandler)
+
+	// OAuth consent screen routes - for the signed-in user
+	api.Get("/oauth/authorize", middleware.OptionalAuthMiddleware, handlers.GetAuthorizationRequestHandler)
+	api.Post("/oauth/authorize", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.DecideAuthorizationHandler)
+	api.Get("/oauth/consents", middleware.AuthMiddleware, handlers.ListOAuthConsentsHandler)
+	api.Delete("/oauth/consents/:clientId", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.RevokeOAuthConsentHandler)
+
+	// OAuth client registration routes - protected by AdminOnlyMiddleware
+	api.Get("/oauth/clients", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListOAuthClientsHandler)
+	api.Post("/oauth/clients", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.CreateOAuthClientHandler)
+	api.Delete("/oauth/clients/:clientId", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.RevokeOAuthClientHandler)
+
+	// SAML connection routes - protected by AdminOnlyMiddleware
+	api.Get("/saml/connections", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListSAMLConnectionsHandler)
+	api.Post("/saml/connections", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.CreateSAMLConnectionHandler)
+	api.Patch("/saml/connections/:slug", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.UpdateSAMLConnectionHandler)
+	api.Put("/saml/connections/:slug/metadata", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.UploadSAMLMetadataHandler)
+	api.Delete("/saml/connections/:slug", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.DeleteSAMLConnectionHandler)
+
 	// Seed admin route
 	api.Post("/seed/admin", handlers.SeedAdminHandler)
 
 	// Get all users route - protected by AdminOnlyMiddleware
 	api.Get("/users", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.GetAllUsersHandler)
 
+	// Export and import users routes - protected by AdminOnlyMiddleware
+	api.Get("/users/export", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ExportUsersHandler)
+	api.Post("/users/import", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ImportUsersHandler)
+
+	// Bulk user operation routes - protected by AdminOnlyMiddleware
+	api.Post("/users/bulk", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.CreateBulkUserJobHandler)
+	api.Get("/users/bulk/jobs", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListBulkUserJobsHandler)
+	api.Get("/users/bulk/jobs/:jobId", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.GetBulkUserJobHandler)
+
+	// Audit log routes - protected by AdminOnlyMiddleware
+	api.Get("/audit/events", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ListAuditEventsHandler)
+	api.Get("/audit/verify", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.VerifyAuditChainHandler)
+
 	// Approve user route - protected by AdminOnlyMiddleware
 	api.Patch("/users/:id/approve", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ApproveUserHandler)
 
-	// Get user by ID route - accessible to the user themselves or administrators
-	api.Get("/users/:id", middleware.AuthMiddleware, middleware.OwnDataOrAdminMiddleware, handlers.GetUserByIDHandler)
+	// Restore deleted user route - protected by AdminOnlyMiddleware
+	api.Post("/users/:id/restore", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.RestoreUserHandler)
+
+	// Reset passkeys route - for users who lost their authenticators, protected by AdminOnlyMiddleware
+	api.Delete("/users/:id/passkeys", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ResetUserPasskeysHandler)
+
+	// Impersonation route - lets support staff act as a merchant, protected by AdminOnlyMiddleware
+	api.Post("/admin/impersonate/:id", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.ImpersonateUserHandler)
+
+	// Revoke sessions route - signs a user out on every device, protected by AdminOnlyMiddleware
+	api.Delete("/users/:id/sessions", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.RevokeUserSessionsHandler)
+
+	// Personal data export route - accessible to the user themselves or administrators
+	api.Get("/users/:id/export", middleware.AuthMiddleware, middleware.OwnDataOrAdminMiddleware, handlers.ExportUserDataHandler)
+
+	// Anonymize user route - protected by AdminOnlyMiddleware
+	api.Post("/users/:id/anonymize", middleware.AuthMiddleware, middleware.AdminOnlyMiddleware, handlers.AnonymizeUserHandler)
+
+	// Get user by ID route - accessible to the user themselves, administrators, or applications with the profile scope
+	api.Get("/users/:id", middleware.ScopedAuthMiddleware(models.ScopeProfile), middleware.OwnDataOrAdminMiddleware, handlers.GetUserByIDHandler)
 
 	// Forgot password route
 	api.Post("/forgot-password", handlers.ForgotPasswordHandler)
 
-	// Edit user route - accessible to the user themselves or administrators
-	api.Patch("/users/:id", middleware.AuthMiddleware, handlers.EditUserHandler)
+	// Edit user route - accessible to the user themselves, administrators, or applications with the profile:write scope
+	api.Patch("/users/:id", middleware.ScopedAuthMiddleware(models.ScopeProfileWrite), handlers.EditUserHandler)
 
-	// Delete user route - accessible to the user themselves or administrators
-	api.Delete("/users/:id", middleware.AuthMiddleware, handlers.DeleteUserHandler)
+	// Delete user route - accessible to the user themselves or administrators, but not while impersonating or with an API key
+	api.Delete("/users/:id", middleware.AuthMiddleware, middleware.InteractiveOnlyMiddleware, handlers.DeleteUserHandler)
 }
@@ -0,0 +1,92 @@
+package samlsso
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"myfibergotemplate/federation"
+	"myfibergotemplate/models"
+	"myfibergotemplate/utils"
+
+	"github.com/crewjam/saml"
+)
+
+// Attribute names commonly used for the email address by Entra ID, ADFS, Okta and LDAP-based identity providers
+var emailAttributes = []string{
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	"urn:oid:0.9.2342.19200300.100.1.3",
+	"mail",
+	"email",
+}
+
+// DefaultAttributeMapping is used for connections created without a mapping
+func DefaultAttributeMapping() models.SAMLAttributeMapping {
+	return models.SAMLAttributeMapping{
+		Email:          "email",
+		PersonInCharge: "displayName",
+	}
+}
+
+// Identity maps a validated assertion to the user it describes. The email address counts as verified
+// only when its domain is one the connection's identity provider vouches for.
+func Identity(connection models.SAMLConnection, assertion *saml.Assertion) (*federation.Identity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("assertion has no subject")
+	}
+	nameID := assertion.Subject.NameID
+
+	mapping := connection.AttributeMapping
+	email := attribute(assertion, mapping.Email)
+	for _, name := range emailAttributes {
+		if email == "" {
+			email = attribute(assertion, name)
+		}
+	}
+	if email == "" && (nameID.Format == string(saml.EmailAddressNameIDFormat) || utils.IsValidEmail(nameID.Value)) {
+		email = nameID.Value
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	identity := &federation.Identity{
+		Provider:   "saml:" + connection.Slug,
+		Subject:    nameID.Value,
+		Email:      email,
+		Name:       attribute(assertion, mapping.PersonInCharge),
+		Attributes: make(map[string]string),
+	}
+	if _, domain, ok := strings.Cut(email, "@"); ok {
+		identity.EmailVerified = slices.Contains(connection.Domains, domain)
+	}
+
+	// Profile fields the identity provider is the source of truth for
+	fields := map[string]string{
+		"person_in_charge": mapping.PersonInCharge,
+		"merchant_name":    mapping.MerchantName,
+		"phone_number":     mapping.PhoneNumber,
+		"website":          mapping.Website,
+		"address":          mapping.Address,
+	}
+	for field, name := range fields {
+		if value := attribute(assertion, name); value != "" {
+			identity.Attributes[field] = value
+		}
+	}
+
+	return identity, nil
+}
+
+// attribute returns the first value of the assertion attribute with the given Name or FriendlyName
+func attribute(assertion *saml.Assertion, name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
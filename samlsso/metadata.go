@@ -0,0 +1,72 @@
+package samlsso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+const maxMetadataSize = 1 << 20 // 1 MB
+
+// httpClient fetches identity provider metadata
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// ParseIdPMetadata parses identity provider metadata, which must describe a single sign-on service and its signing certificate
+func ParseIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	metadata, err := samlsp.ParseMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if metadata.EntityID == "" || len(metadata.IDPSSODescriptors) == 0 {
+		return nil, errors.New("metadata does not describe an identity provider")
+	}
+
+	// Requests are sent with the HTTP-Redirect binding
+	descriptor := metadata.IDPSSODescriptors[0]
+	hasRedirectBinding := false
+	for _, service := range descriptor.SingleSignOnServices {
+		if service.Binding == saml.HTTPRedirectBinding {
+			hasRedirectBinding = true
+		}
+	}
+	if !hasRedirectBinding {
+		return nil, errors.New("metadata has no HTTP-Redirect single sign-on service")
+	}
+
+	hasCertificate := false
+	for _, keyDescriptor := range descriptor.KeyDescriptors {
+		if (keyDescriptor.Use == "" || keyDescriptor.Use == "signing") && len(keyDescriptor.KeyInfo.X509Data.X509Certificates) > 0 {
+			hasCertificate = true
+		}
+	}
+	if !hasCertificate {
+		return nil, errors.New("metadata has no signing certificate")
+	}
+
+	return metadata, nil
+}
+
+// FetchIdPMetadata downloads identity provider metadata from its published URL
+func FetchIdPMetadata(ctx context.Context, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+}
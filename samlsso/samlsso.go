@@ -0,0 +1,113 @@
+package samlsso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/models"
+
+	"github.com/crewjam/saml"
+)
+
+var (
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+)
+
+// Init loads the service provider's key pair, or generates a temporary self-signed one when none is configured.
+// Identity providers must be given the new metadata whenever a temporary certificate changes.
+func Init(cfg config.SAMLConfig) error {
+	if cfg.CertificateFile == "" || cfg.KeyFile == "" {
+		return generateKeyPair()
+	}
+
+	pair, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load SAML key pair: %w", err)
+	}
+	rsaKey, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("SAML key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("cannot parse SAML certificate: %w", err)
+	}
+
+	key, certificate = rsaKey, cert
+	return nil
+}
+
+// generateKeyPair creates a self-signed certificate valid for a year
+func generateKeyPair() error {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "TalentDev SAML service provider"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &rsaKey.PublicKey, rsaKey)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	key, certificate = rsaKey, cert
+	return nil
+}
+
+// ServiceProvider returns the service provider for a connection. Each connection has its own entity ID and
+// endpoints under /saml/<slug>, so one organization's assertions are never accepted for another.
+func ServiceProvider(connection models.SAMLConnection, backendURL string) (*saml.ServiceProvider, error) {
+	if key == nil {
+		return nil, errors.New("SAML service provider is not initialized")
+	}
+
+	idpMetadata, err := ParseIdPMetadata([]byte(connection.IdPMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	base := backendURL + "/saml/" + connection.Slug
+	metadataURL, err := url.Parse(base + "/metadata")
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(base + "/acs")
+	if err != nil {
+		return nil, err
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		Key:               key,
+		Certificate:       certificate,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.PersistentNameIDFormat,
+		SignatureMethod:   "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+	}, nil
+}
@@ -0,0 +1,390 @@
+package samlsso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/models"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+)
+
+const testRequestID = "id-test-request"
+
+// newTestIdP creates a throwaway identity provider with its own signing key
+func newTestIdP(t *testing.T, entityID string) *saml.IdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test identity provider"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadataURL, _ := url.Parse(entityID)
+	ssoURL, _ := url.Parse(entityID + "/sso")
+	return &saml.IdentityProvider{
+		Key:             key,
+		Certificate:     cert,
+		MetadataURL:     *metadataURL,
+		SSOURL:          *ssoURL,
+		SignatureMethod: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+	}
+}
+
+// newTestConnection returns a connection trusting idp for the acme.example domain
+func newTestConnection(t *testing.T, idp *saml.IdentityProvider) models.SAMLConnection {
+	t.Helper()
+
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.SAMLConnection{
+		Slug:             "acme",
+		Organization:     "Acme",
+		Domains:          []string{"acme.example"},
+		IdPEntityID:      idp.MetadataURL.String(),
+		IdPMetadata:      string(metadata),
+		AttributeMapping: DefaultAttributeMapping(),
+	}
+}
+
+// newTestServiceProvider returns the service provider of connection, with a freshly generated key pair
+func newTestServiceProvider(t *testing.T, connection models.SAMLConnection) *saml.ServiceProvider {
+	t.Helper()
+
+	if err := Init(config.SAMLConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sp, err := ServiceProvider(connection, "https://api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+// signedResponse has idp answer testRequestID with a signed assertion about nameID carrying attributes.
+// modify may change the assertion before it is signed.
+func signedResponse(t *testing.T, idp *saml.IdentityProvider, sp *saml.ServiceProvider, nameID string, attributes map[string]string, modify func(*saml.Assertion)) []byte {
+	t.Helper()
+
+	now := saml.TimeNow()
+	spMetadata := sp.Metadata()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     idp,
+		Request:                 saml.AuthnRequest{ID: testRequestID},
+		ServiceProviderMetadata: spMetadata,
+		SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+		ACSEndpoint:             &saml.IndexedEndpoint{Binding: saml.HTTPPostBinding, Location: sp.AcsURL.String()},
+		Now:                     now,
+	}
+
+	var samlAttributes []saml.Attribute
+	for name, value := range attributes {
+		samlAttributes = append(samlAttributes, saml.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values:     []saml.AttributeValue{{Type: "xs:string", Value: value}},
+		})
+	}
+
+	req.Assertion = &saml.Assertion{
+		ID:           "id-test-assertion",
+		IssueInstant: now,
+		Version:      "2.0",
+		Issuer:       saml.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: idp.MetadataURL.String()},
+		Subject: &saml.Subject{
+			NameID: &saml.NameID{Format: string(saml.PersistentNameIDFormat), Value: nameID},
+			SubjectConfirmations: []saml.SubjectConfirmation{{
+				Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+				SubjectConfirmationData: &saml.SubjectConfirmationData{
+					InResponseTo: testRequestID,
+					NotOnOrAfter: now.Add(saml.MaxIssueDelay),
+					Recipient:    sp.AcsURL.String(),
+				},
+			}},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:            now.Add(-time.Minute),
+			NotOnOrAfter:         now.Add(saml.MaxIssueDelay),
+			AudienceRestrictions: []saml.AudienceRestriction{{Audience: saml.Audience{Value: sp.EntityID}}},
+		},
+		AuthnStatements: []saml.AuthnStatement{{
+			AuthnInstant: now,
+			AuthnContext: saml.AuthnContext{
+				AuthnContextClassRef: &saml.AuthnContextClassRef{Value: "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"},
+			},
+		}},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: samlAttributes}},
+	}
+	if modify != nil {
+		modify(req.Assertion)
+	}
+
+	if err := req.MakeResponse(); err != nil {
+		t.Fatal(err)
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(req.ResponseEl)
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidAssertion(t *testing.T) {
+	idp := newTestIdP(t, "https://idp.acme.example/metadata")
+	connection := newTestConnection(t, idp)
+	sp := newTestServiceProvider(t, connection)
+
+	response := signedResponse(t, idp, sp, "employee-42", map[string]string{
+		"email":       " Jane.Doe@ACME.example ",
+		"displayName": "Jane Doe",
+	}, nil)
+
+	assertion, err := sp.ParseXMLResponse(response, []string{testRequestID})
+	if err != nil {
+		t.Fatalf("valid response rejected: %v", privateError(err))
+	}
+
+	identity, err := Identity(connection, assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Provider != "saml:acme" || identity.Subject != "employee-42" {
+		t.Errorf("identity is %s/%s, want saml:acme/employee-42", identity.Provider, identity.Subject)
+	}
+	if identity.Email != "jane.doe@acme.example" {
+		t.Errorf("email is %q, want it trimmed and lowercased", identity.Email)
+	}
+	if !identity.EmailVerified {
+		t.Error("email in one of the connection's domains is not verified")
+	}
+	if identity.Name != "Jane Doe" || identity.Attributes["person_in_charge"] != "Jane Doe" {
+		t.Errorf("name is %q and person_in_charge %q, want Jane Doe", identity.Name, identity.Attributes["person_in_charge"])
+	}
+}
+
+func TestRejectedResponses(t *testing.T) {
+	idp := newTestIdP(t, "https://idp.acme.example/metadata")
+	connection := newTestConnection(t, idp)
+	sp := newTestServiceProvider(t, connection)
+	attributes := map[string]string{"email": "jane.doe@acme.example"}
+
+	tests := []struct {
+		name       string
+		idp        *saml.IdentityProvider
+		requestIDs []string
+		modify     func(*saml.Assertion)
+	}{
+		{
+			name:       "wrong audience",
+			idp:        idp,
+			requestIDs: []string{testRequestID},
+			modify: func(assertion *saml.Assertion) {
+				assertion.Conditions.AudienceRestrictions[0].Audience.Value = "https://api.example.com/saml/other/metadata"
+			},
+		},
+		{
+			name:       "expired assertion",
+			idp:        idp,
+			requestIDs: []string{testRequestID},
+			modify: func(assertion *saml.Assertion) {
+				past := saml.TimeNow().Add(-time.Hour)
+				assertion.IssueInstant = past
+				assertion.Conditions.NotBefore = past
+				assertion.Conditions.NotOnOrAfter = past.Add(saml.MaxIssueDelay)
+				assertion.Subject.SubjectConfirmations[0].SubjectConfirmationData.NotOnOrAfter = past.Add(saml.MaxIssueDelay)
+			},
+		},
+		{
+			name:       "wrong recipient",
+			idp:        idp,
+			requestIDs: []string{testRequestID},
+			modify: func(assertion *saml.Assertion) {
+				assertion.Subject.SubjectConfirmations[0].SubjectConfirmationData.Recipient = "https://api.example.com/saml/other/acs"
+			},
+		},
+		{
+			name:       "unsolicited response",
+			idp:        idp,
+			requestIDs: []string{"id-another-request"},
+		},
+		{
+			name:       "signed by another identity provider",
+			idp:        newTestIdP(t, "https://idp.acme.example/metadata"),
+			requestIDs: []string{testRequestID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := signedResponse(t, tt.idp, sp, "employee-42", attributes, tt.modify)
+			if _, err := sp.ParseXMLResponse(response, tt.requestIDs); err == nil {
+				t.Error("response was accepted")
+			}
+		})
+	}
+}
+
+func TestEmailOutsideConnectionDomains(t *testing.T) {
+	idp := newTestIdP(t, "https://idp.acme.example/metadata")
+	connection := newTestConnection(t, idp)
+	sp := newTestServiceProvider(t, connection)
+
+	for _, email := range []string{"jane.doe@other.example", "jane.doe@sub.acme.example", "jane.doe@acme.example.evil"} {
+		response := signedResponse(t, idp, sp, "employee-42", map[string]string{"email": email}, nil)
+		assertion, err := sp.ParseXMLResponse(response, []string{testRequestID})
+		if err != nil {
+			t.Fatalf("valid response rejected: %v", privateError(err))
+		}
+
+		identity, err := Identity(connection, assertion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Email != email {
+			t.Errorf("email is %q, want %q", identity.Email, email)
+		}
+		if identity.EmailVerified {
+			t.Errorf("%s is verified although its domain is not one of the connection's", email)
+		}
+	}
+}
+
+func TestAttributeMapping(t *testing.T) {
+	idp := newTestIdP(t, "https://idp.acme.example/metadata")
+	connection := newTestConnection(t, idp)
+	connection.AttributeMapping = models.SAMLAttributeMapping{
+		Email:          "mail",
+		PersonInCharge: "cn",
+		MerchantName:   "company",
+		PhoneNumber:    "telephoneNumber",
+		Address:        "postalAddress",
+	}
+	sp := newTestServiceProvider(t, connection)
+
+	response := signedResponse(t, idp, sp, "employee-42", map[string]string{
+		"mail":            "jane.doe@acme.example",
+		"email":           "ignored@acme.example",
+		"cn":              "Jane Doe",
+		"company":         "Acme Trading",
+		"telephoneNumber": "+60 12-345 6789",
+		"postalAddress":   "1 Jalan Example, Kuala Lumpur",
+		"website":         "https://ignored.example",
+	}, nil)
+	assertion, err := sp.ParseXMLResponse(response, []string{testRequestID})
+	if err != nil {
+		t.Fatalf("valid response rejected: %v", privateError(err))
+	}
+
+	identity, err := Identity(connection, assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Email != "jane.doe@acme.example" {
+		t.Errorf("email is %q, want the mapped attribute", identity.Email)
+	}
+	want := map[string]string{
+		"person_in_charge": "Jane Doe",
+		"merchant_name":    "Acme Trading",
+		"phone_number":     "+60 12-345 6789",
+		"address":          "1 Jalan Example, Kuala Lumpur",
+	}
+	if len(identity.Attributes) != len(want) {
+		t.Errorf("attributes are %v, want %v", identity.Attributes, want)
+	}
+	for field, value := range want {
+		if identity.Attributes[field] != value {
+			t.Errorf("%s is %q, want %q", field, identity.Attributes[field], value)
+		}
+	}
+}
+
+func TestEmailFallbacks(t *testing.T) {
+	idp := newTestIdP(t, "https://idp.acme.example/metadata")
+	connection := newTestConnection(t, idp)
+	sp := newTestServiceProvider(t, connection)
+
+	tests := []struct {
+		name       string
+		nameID     string
+		attributes map[string]string
+		want       string
+	}{
+		{
+			name:       "well-known attribute",
+			nameID:     "employee-42",
+			attributes: map[string]string{"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "jane.doe@acme.example"},
+			want:       "jane.doe@acme.example",
+		},
+		{
+			name:   "email-formatted NameID",
+			nameID: "Jane.Doe@acme.example",
+			want:   "jane.doe@acme.example",
+		},
+		{
+			name:   "no email",
+			nameID: "employee-42",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := signedResponse(t, idp, sp, tt.nameID, tt.attributes, nil)
+			assertion, err := sp.ParseXMLResponse(response, []string{testRequestID})
+			if err != nil {
+				t.Fatalf("valid response rejected: %v", privateError(err))
+			}
+
+			identity, err := Identity(connection, assertion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Email != tt.want {
+				t.Errorf("email is %q, want %q", identity.Email, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertionWithoutSubject(t *testing.T) {
+	connection := models.SAMLConnection{Slug: "acme", Domains: []string{"acme.example"}}
+	if _, err := Identity(connection, &saml.Assertion{}); err == nil {
+		t.Error("assertion without a subject was accepted")
+	}
+}
+
+// privateError returns the reason the library keeps out of Error()
+func privateError(err error) error {
+	if invalid, ok := err.(*saml.InvalidResponseError); ok {
+		return invalid.PrivateErr
+	}
+	return err
+}
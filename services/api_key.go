@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyPrefix starts every API key, followed by the key's public ID and its secret: tdk_<id>_<secret>
+const APIKeyPrefix = "tdk_"
+
+const apiKeyUseInterval = time.Minute // How often a key's last-used time is updated
+
+// ErrInvalidAPIKey is returned for API keys that are unknown, revoked or expired, or whose owner can no longer use them
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// EnsureAPIKeyIndexes creates the lookup indexes of API keys
+func EnsureAPIKeyIndexes(ctx context.Context) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// NewAPIKey stores an API key and returns it. The key is only available here; afterwards just its prefix is known.
+func NewAPIKey(ctx context.Context, key *models.APIKey) (string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		panic(err) // The system's random source is unusable; there is no safe way to continue
+	}
+	key.ID = primitive.NewObjectID()
+	key.Prefix = APIKeyPrefix + hex.EncodeToString(id)
+	secret := NewOAuthSecret("")
+	key.SecretHash = HashOAuthSecret(secret)
+	key.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, key); err != nil {
+		return "", err
+	}
+	return key.Prefix + "_" + secret, nil
+}
+
+// AuthenticateAPIKey returns an active API key and its owner, and records that the key was used from ip
+func AuthenticateAPIKey(ctx context.Context, rawKey, ip string) (*models.APIKey, *models.User, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	// The public ID holds no underscore, so the first one after it starts the secret
+	id, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, APIKeyPrefix), "_")
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) || !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	err := collection.FindOne(ctx, bson.M{"prefix": APIKeyPrefix + id, "revoked_at": bson.M{"$exists": false}}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(HashOAuthSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	// Keys only work for approved merchants, so suspending or promoting the owner stops them
+	var user models.User
+	err = database.GetMongoClient().Database("talentdevgo").Collection("users").FindOne(ctx, bson.M{
+		"_id":        key.UserID,
+		"role":       models.Merchant,
+		"status":     models.Approved,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only write when the last-used time is out of date, rather than on every request
+	now := time.Now()
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"_id": key.ID, "$or": bson.A{
+			bson.M{"last_used_at": bson.M{"$exists": false}},
+			bson.M{"last_used_at": bson.M{"$lt": now.Add(-apiKeyUseInterval)}},
+		}},
+		bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &key, &user, nil
+}
+
+// APIKeysForUser returns a user's API keys, newest first, including revoked ones
+func APIKeysForUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CountActiveAPIKeys returns how many unrevoked API keys a user has
+func CountActiveAPIKeys(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	return collection.CountDocuments(ctx, bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}})
+}
+
+// RevokeAPIKeys revokes the unrevoked API keys matching filter and returns how many were revoked
+func RevokeAPIKeys(ctx context.Context, filter bson.M) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("api_keys")
+
+	filter["revoked_at"] = bson.M{"$exists": false}
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
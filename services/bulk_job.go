@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BulkJobStaleAfter is how long a running job may go without saving its progress before it is taken to have
+// stopped with the instance that ran it. Running jobs save their progress well within this time.
+const BulkJobStaleAfter = 5 * time.Minute
+
+// EnsureBulkJobIndexes creates the lookup indexes of the per-user results of bulk jobs
+func EnsureBulkJobIndexes(ctx context.Context) error {
+	items := database.GetMongoClient().Database("talentdevgo").Collection("bulk_job_items")
+
+	_, err := items.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+// FailStaleBulkJobs marks failed the queued and running jobs whose progress has not been saved for
+// BulkJobStaleAfter, such as jobs of an instance that was restarted, and returns how many were marked
+func FailStaleBulkJobs(ctx context.Context) (int64, error) {
+	jobs := database.GetMongoClient().Database("talentdevgo").Collection("bulk_jobs")
+
+	now := time.Now()
+	filter := bson.M{
+		"status":     bson.M{"$in": bson.A{models.BulkJobQueued, models.BulkJobRunning}},
+		"updated_at": bson.M{"$lt": now.Add(-BulkJobStaleAfter)},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":       models.BulkJobFailed,
+		"error":        "Job was interrupted before it finished",
+		"completed_at": now,
+		"updated_at":   now,
+	}}
+	result, err := jobs.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// StartBulkJobSweeper marks stale bulk jobs failed now and then periodically, until ctx is cancelled
+func StartBulkJobSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sweepCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			failed, err := FailStaleBulkJobs(sweepCtx)
+			cancel()
+
+			if err != nil {
+				slog.Error("Failed to mark stale bulk jobs", "error", err)
+			} else if failed > 0 {
+				slog.Info("Marked interrupted bulk jobs failed", "count", failed)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordConsent appends a consent change to the user's consent history
+func RecordConsent(ctx context.Context, record models.ConsentRecord) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("consents")
+
+	record.ID = primitive.NewObjectID()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	_, err := collection.InsertOne(ctx, record)
+	return err
+}
+
+// ConsentHistory returns a user's consent changes, oldest first
+func ConsentHistory(ctx context.Context, userID primitive.ObjectID) ([]models.ConsentRecord, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("consents")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := []models.ConsentRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/federation"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lifetimes of a federated login in progress and of the code that completes it
+const (
+	federatedStateTTL = 10 * time.Minute
+	federatedCodeTTL  = 2 * time.Minute
+)
+
+// Errors returned while completing a federated login
+var (
+	ErrFederatedStateInvalid = errors.New("unknown or expired login state")
+	ErrIdentityLinked        = errors.New("provider account is already linked")
+)
+
+// EnsureFederationIndexes creates the lookup indexes and expires abandoned logins
+func EnsureFederationIndexes(ctx context.Context) error {
+	db := database.GetMongoClient().Database("talentdevgo")
+
+	indexes := map[string][]mongo.IndexModel{
+		"federated_identities": {
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "provider", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"federated_login_states": {
+			{Keys: bson.D{{Key: "state_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"federated_login_codes": {
+			{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for name, indexModels := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartFederatedLogin stores the state, nonce and PKCE verifier of a new login and returns the provider's sign-in URL.
+// login sets the purpose, and the user or invitation the login is for.
+func StartFederatedLogin(ctx context.Context, provider *federation.Provider, redirectURI string, login models.FederatedLoginState) (string, error) {
+	state := NewOAuthSecret("")
+	login.ID = primitive.NewObjectID()
+	login.StateHash = HashOAuthSecret(state)
+	login.Provider = provider.Name
+	login.Nonce = NewOAuthSecret("")
+	login.CodeVerifier = NewOAuthSecret("")
+	login.ExpiresAt = time.Now().Add(federatedStateTTL)
+	login.CreatedAt = time.Now()
+
+	sum := sha256.Sum256([]byte(login.CodeVerifier))
+	authURL, err := provider.AuthCodeURL(ctx, redirectURI, state, login.Nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", err
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_login_states")
+	if _, err := collection.InsertOne(ctx, login); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// ConsumeFederatedLoginState returns and deletes the login matching state, so each state is used once
+func ConsumeFederatedLoginState(ctx context.Context, provider, state string) (*models.FederatedLoginState, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_login_states")
+
+	var login models.FederatedLoginState
+	err := collection.FindOneAndDelete(ctx, bson.M{"state_hash": HashOAuthSecret(state), "provider": provider}).Decode(&login)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrFederatedStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return nil, ErrFederatedStateInvalid
+	}
+	return &login, nil
+}
+
+// FindFederatedIdentity returns the link for an account at a provider
+func FindFederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_identities")
+
+	var identity models.FederatedIdentity
+	if err := collection.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// LinkFederatedIdentity links a provider account to a user; a user can link one account per provider
+func LinkFederatedIdentity(ctx context.Context, userID primitive.ObjectID, identity *federation.Identity) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_identities")
+
+	now := time.Now()
+	_, err := collection.InsertOne(ctx, models.FederatedIdentity{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LinkedAt:    now,
+		LastLoginAt: &now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+// TouchFederatedIdentity records a sign-in through a linked provider account
+func TouchFederatedIdentity(ctx context.Context, id primitive.ObjectID, email string) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_identities")
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_login_at": time.Now(), "email": email}})
+	return err
+}
+
+// FederatedIdentitiesForUser returns the provider accounts linked to a user
+func FederatedIdentitiesForUser(ctx context.Context, userID primitive.ObjectID) ([]models.FederatedIdentity, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_identities")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"linked_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	identities := []models.FederatedIdentity{}
+	if err := cursor.All(ctx, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// UnlinkFederatedIdentities removes the provider account links matching filter
+func UnlinkFederatedIdentities(ctx context.Context, filter bson.M) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_identities")
+
+	_, err := collection.DeleteMany(ctx, filter)
+	return err
+}
+
+// NewFederatedLoginCode returns a single-use code that lets the frontend complete a federated sign-in
+func NewFederatedLoginCode(ctx context.Context, userID primitive.ObjectID, provider string) (string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_login_codes")
+
+	code := NewOAuthSecret("")
+	_, err := collection.InsertOne(ctx, models.FederatedLoginCode{
+		ID:        primitive.NewObjectID(),
+		CodeHash:  HashOAuthSecret(code),
+		UserID:    userID,
+		Provider:  provider,
+		ExpiresAt: time.Now().Add(federatedCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// FindFederatedLoginCode returns the unused, unexpired login code matching code
+func FindFederatedLoginCode(ctx context.Context, code string) (*models.FederatedLoginCode, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_login_codes")
+
+	var loginCode models.FederatedLoginCode
+	err := collection.FindOne(ctx, bson.M{
+		"code_hash":  HashOAuthSecret(code),
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&loginCode)
+	if err != nil {
+		return nil, err
+	}
+	return &loginCode, nil
+}
+
+// UseFederatedLoginCode marks a login code as used, reporting false when it was already used
+func UseFederatedLoginCode(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("federated_login_codes")
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewInvitation stores an invitation and returns its token. Earlier pending invitations of the same
+// email to the same organization, or to the platform, are revoked, so only the latest link works.
+func NewInvitation(ctx context.Context, invitation *models.Invitation) (string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	if _, err := RevokeInvitations(ctx, bson.M{"organization_id": invitation.OrganizationID, "email": invitation.Email}); err != nil {
+		return "", err
+	}
+
+	token := utils.GenerateVerificationToken()
+	invitation.ID = primitive.NewObjectID()
+	invitation.TokenHash = utils.HashVerificationToken(token)
+	invitation.CreatedAt = time.Now()
+	invitation.SentAt = invitation.CreatedAt
+	invitation.SendCount = 1
+
+	if _, err := collection.InsertOne(ctx, invitation); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// FindPendingInvitation returns the unexpired invitation matching token that was neither accepted nor revoked
+func FindPendingInvitation(ctx context.Context, token string) (*models.Invitation, error) {
+	return findPendingInvitation(ctx, bson.M{"token_hash": utils.HashVerificationToken(token)})
+}
+
+// FindPendingInvitationByID returns an invitation by ID if it can still be accepted
+func FindPendingInvitationByID(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	return findPendingInvitation(ctx, bson.M{"_id": id})
+}
+
+func findPendingInvitation(ctx context.Context, filter bson.M) (*models.Invitation, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	filter["accepted_at"] = bson.M{"$exists": false}
+	filter["revoked_at"] = bson.M{"$exists": false}
+	filter["expires_at"] = bson.M{"$gt": time.Now()}
+
+	var invitation models.Invitation
+	if err := collection.FindOne(ctx, filter).Decode(&invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// AcceptInvitation marks an invitation as accepted by userID, reporting false when it was already used or revoked
+func AcceptInvitation(ctx context.Context, id, userID primitive.ObjectID) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "accepted_at": bson.M{"$exists": false}, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"accepted_at": time.Now(), "accepted_by": userID}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// ResendInvitation gives the invitation matching filter a new token and a fresh expiry of the same length
+// as the original, and returns it with the token. The previous link stops working. Expired invitations can
+// be resent; accepted and revoked ones cannot.
+func ResendInvitation(ctx context.Context, filter bson.M) (*models.Invitation, string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	filter["accepted_at"] = bson.M{"$exists": false}
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	var invitation models.Invitation
+	if err := collection.FindOne(ctx, filter).Decode(&invitation); err != nil {
+		return nil, "", err
+	}
+
+	token := utils.GenerateVerificationToken()
+	invitation.TokenHash = utils.HashVerificationToken(token)
+	invitation.ExpiresAt = time.Now().Add(invitation.ExpiresAt.Sub(invitation.SentAt))
+	invitation.SentAt = time.Now()
+	invitation.SendCount++
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": invitation.ID, "accepted_at": bson.M{"$exists": false}, "revoked_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set": bson.M{"token_hash": invitation.TokenHash, "expires_at": invitation.ExpiresAt, "sent_at": invitation.SentAt},
+			"$inc": bson.M{"send_count": 1},
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	if result.MatchedCount == 0 {
+		return nil, "", mongo.ErrNoDocuments
+	}
+	return &invitation, token, nil
+}
+
+// PendingInvitations returns the invitations matching filter that can still be accepted, newest first
+func PendingInvitations(ctx context.Context, filter bson.M) ([]models.Invitation, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	filter["accepted_at"] = bson.M{"$exists": false}
+	filter["revoked_at"] = bson.M{"$exists": false}
+	filter["expires_at"] = bson.M{"$gt": time.Now()}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	invitations := []models.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// RevokeInvitations revokes the pending invitations matching filter and returns how many were revoked
+func RevokeInvitations(ctx context.Context, filter bson.M) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	filter["accepted_at"] = bson.M{"$exists": false}
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const magicLinkRequestTTL = time.Hour // How long requests are kept for rate limiting
+
+// EnsureMagicLinkIndexes creates the lookup indexes and expires unused links and old requests
+func EnsureMagicLinkIndexes(ctx context.Context) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_links")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Requests are only kept for as long as they count towards the rate limit
+	requests := database.GetMongoClient().Database("talentdevgo").Collection("magic_link_requests")
+	_, err = requests.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "ip_address", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(magicLinkRequestTTL.Seconds()))},
+	})
+	return err
+}
+
+// NewMagicLink stores a sign-in link for a user and returns its token. When the link is bound to the
+// requesting browser it also returns the device token that browser must present with it.
+func NewMagicLink(ctx context.Context, cfg config.MagicLinkConfig, userID primitive.ObjectID, ip string) (string, string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_links")
+
+	token := utils.GenerateVerificationToken()
+	link := models.MagicLink{
+		ID:        primitive.NewObjectID(),
+		TokenHash: utils.HashVerificationToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(cfg.TTL),
+		CreatedAt: time.Now(),
+	}
+	if cfg.BindIP {
+		link.IPAddress = ip
+	}
+	var deviceToken string
+	if cfg.BindDevice {
+		deviceToken = utils.GenerateVerificationToken()
+		link.DeviceHash = utils.HashVerificationToken(deviceToken)
+	}
+
+	if _, err := collection.InsertOne(ctx, link); err != nil {
+		return "", "", err
+	}
+	return token, deviceToken, nil
+}
+
+// RecordMagicLinkRequest stores a request for a sign-in link to email from ip
+func RecordMagicLinkRequest(ctx context.Context, email, ip string) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_link_requests")
+
+	_, err := collection.InsertOne(ctx, models.MagicLinkRequest{
+		ID:        primitive.NewObjectID(),
+		Email:     strings.ToLower(email),
+		IPAddress: ip,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// CountRecentMagicLinkRequests returns how many links were requested for email, and from ip, since the given time
+func CountRecentMagicLinkRequests(ctx context.Context, email, ip string, since time.Time) (int64, int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_link_requests")
+
+	byEmail, err := collection.CountDocuments(ctx, bson.M{"email": strings.ToLower(email), "created_at": bson.M{"$gt": since}})
+	if err != nil {
+		return 0, 0, err
+	}
+	byIP, err := collection.CountDocuments(ctx, bson.M{"ip_address": ip, "created_at": bson.M{"$gt": since}})
+	if err != nil {
+		return 0, 0, err
+	}
+	return byEmail, byIP, nil
+}
+
+// FindMagicLink returns the unused, unexpired link matching token
+func FindMagicLink(ctx context.Context, token string) (*models.MagicLink, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_links")
+
+	var link models.MagicLink
+	err := collection.FindOne(ctx, bson.M{
+		"token_hash": utils.HashVerificationToken(token),
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&link)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// MagicLinkBoundTo reports whether a link may be used from the given IP address and device token
+func MagicLinkBoundTo(link *models.MagicLink, ip, deviceToken string) bool {
+	if link.IPAddress != "" && link.IPAddress != ip {
+		return false
+	}
+	if link.DeviceHash != "" {
+		hash := utils.HashVerificationToken(deviceToken)
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(link.DeviceHash)) == 1
+	}
+	return true
+}
+
+// UseMagicLink marks a link as used, reporting false when it was already used. The user's other
+// outstanding links are spent with it, so older emails in the inbox cannot be used afterwards.
+func UseMagicLink(ctx context.Context, link *models.MagicLink) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("magic_links")
+
+	now := time.Now()
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": link.ID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount != 1 {
+		return false, nil
+	}
+
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"user_id": link.UserID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	return true, err
+}
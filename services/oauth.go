@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Prefixes make issued secrets recognizable, e.g. to tell OAuth access tokens from first-party JWTs
+const (
+	OAuthClientIDPrefix     = "tdc_"
+	OAuthClientSecretPrefix = "tdcs_"
+	OAuthCodePrefix         = "tdac_"
+	OAuthAccessTokenPrefix  = "tdat_"
+	OAuthRefreshTokenPrefix = "tdrt_"
+)
+
+// ErrInvalidClient is returned when a client is unknown, revoked or fails authentication
+var ErrInvalidClient = errors.New("invalid client")
+
+// IssuedOAuthTokens holds the tokens returned to a client; the raw values are never stored
+type IssuedOAuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    int
+	Scopes       []string
+}
+
+// NewOAuthSecret returns a random URL-safe value with the given prefix
+func NewOAuthSecret(prefix string) string {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err) // The system's random source is unusable; there is no safe way to continue
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// HashOAuthSecret returns the stored form of a client secret, code or token
+func HashOAuthSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsOAuthAccessToken reports whether a bearer token was issued by the authorization server
+func IsOAuthAccessToken(token string) bool {
+	return strings.HasPrefix(token, OAuthAccessTokenPrefix)
+}
+
+// VerifyPKCE checks a code verifier against the S256 code challenge sent with the authorization request
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ParseScopes splits a space-delimited scope parameter, dropping duplicates
+func ParseScopes(scope string) []string {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ScopesAllowed reports whether every requested scope is in allowed
+func ScopesAllowed(requested, allowed []string) bool {
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnsureOAuthIndexes creates the lookup indexes and expires used-up codes and tokens
+func EnsureOAuthIndexes(ctx context.Context) error {
+	db := database.GetMongoClient().Database("talentdevgo")
+
+	indexes := map[string][]mongo.IndexModel{
+		"oauth_clients": {
+			{Keys: bson.D{{Key: "client_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		"oauth_codes": {
+			{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"oauth_tokens": {
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "family_id", Value: 1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}}},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		"oauth_consents": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+	}
+
+	for name, indexModels := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindOAuthClient returns the active client with the given client ID
+func FindOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_clients")
+
+	var client models.OAuthClient
+	err := collection.FindOne(ctx, bson.M{"client_id": clientID, "revoked_at": bson.M{"$exists": false}}).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AuthenticateOAuthClient checks a client's credentials; public clients authenticate with their client ID alone
+func AuthenticateOAuthClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := FindOAuthClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(HashOAuthSecret(clientSecret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// IssueOAuthTokens stores and returns a new access token, and a refresh token when withRefresh is set.
+// The grant supplies the client, user, scopes, family and authentication time shared by the new tokens.
+func IssueOAuthTokens(ctx context.Context, cfg config.OAuthConfig, grant models.OAuthToken, withRefresh bool) (IssuedOAuthTokens, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_tokens")
+	now := time.Now()
+
+	issued := IssuedOAuthTokens{
+		AccessToken: NewOAuthSecret(OAuthAccessTokenPrefix),
+		ExpiresIn:   int(cfg.AccessTokenTTL.Seconds()),
+		Scopes:      grant.Scopes,
+	}
+
+	accessToken := grant
+	accessToken.ID = primitive.NewObjectID()
+	accessToken.TokenHash = HashOAuthSecret(issued.AccessToken)
+	accessToken.Type = models.AccessToken
+	accessToken.ExpiresAt = now.Add(cfg.AccessTokenTTL)
+	accessToken.CreatedAt = now
+	accessToken.RevokedAt = nil
+	tokens := []interface{}{accessToken}
+
+	if withRefresh {
+		issued.RefreshToken = NewOAuthSecret(OAuthRefreshTokenPrefix)
+		refreshToken := accessToken
+		refreshToken.ID = primitive.NewObjectID()
+		refreshToken.TokenHash = HashOAuthSecret(issued.RefreshToken)
+		refreshToken.Type = models.RefreshToken
+		refreshToken.ExpiresAt = now.Add(cfg.RefreshTokenTTL)
+		tokens = append(tokens, refreshToken)
+	}
+
+	if _, err := collection.InsertMany(ctx, tokens); err != nil {
+		return IssuedOAuthTokens{}, err
+	}
+	return issued, nil
+}
+
+// FindOAuthToken returns the stored token matching a raw token value, whether or not it is still active
+func FindOAuthToken(ctx context.Context, token string) (*models.OAuthToken, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_tokens")
+
+	var stored models.OAuthToken
+	if err := collection.FindOne(ctx, bson.M{"token_hash": HashOAuthSecret(token)}).Decode(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// FindActiveOAuthToken returns the stored token matching a raw token value if it is neither revoked nor expired
+func FindActiveOAuthToken(ctx context.Context, token string) (*models.OAuthToken, error) {
+	stored, err := FindOAuthToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, mongo.ErrNoDocuments
+	}
+	return stored, nil
+}
+
+// RevokeOAuthTokens revokes every active token matching filter
+func RevokeOAuthTokens(ctx context.Context, filter bson.M) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_tokens")
+
+	filter["revoked_at"] = bson.M{"$exists": false}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	return err
+}
+
+// OAuthUserActive reports whether a user can still be issued tokens and act through them
+func OAuthUserActive(ctx context.Context, userID primitive.ObjectID) bool {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	count, err := collection.CountDocuments(ctx, bson.M{
+		"_id":        userID,
+		"status":     models.Approved,
+		"deleted_at": bson.M{"$exists": false},
+	}, options.Count().SetLimit(1))
+	return err == nil && count > 0
+}
+
+// OAuthConsentCovers reports whether the user has already allowed the client every requested scope
+func OAuthConsentCovers(ctx context.Context, userID primitive.ObjectID, clientID string, scopes []string) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_consents")
+
+	var consent models.OAuthConsent
+	err := collection.FindOne(ctx, bson.M{"user_id": userID, "client_id": clientID, "revoked_at": bson.M{"$exists": false}}).Decode(&consent)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return ScopesAllowed(scopes, consent.Scopes), nil
+}
+
+// GrantOAuthConsent records that the user allowed the client the given scopes, in addition to any granted before
+func GrantOAuthConsent(ctx context.Context, userID primitive.ObjectID, clientID string, scopes []string) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_consents")
+
+	filter := bson.M{"user_id": userID, "client_id": clientID}
+
+	// Start from a clean scope list when the previous consent was revoked
+	var existing models.OAuthConsent
+	err := collection.FindOne(ctx, filter).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err == nil && existing.RevokedAt == nil {
+		for _, scope := range existing.Scopes {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"scopes": scopes, "granted_at": time.Now()},
+		"$unset":       bson.M{"revoked_at": ""},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+	}
+	_, err = collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// OAuthConsentsForUser returns the clients a user has allowed access to, excluding revoked consents
+func OAuthConsentsForUser(ctx context.Context, userID primitive.ObjectID) ([]models.OAuthConsent, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("oauth_consents")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}, options.Find().SetSort(bson.M{"granted_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	consents := []models.OAuthConsent{}
+	if err := cursor.All(ctx, &consents); err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyMember is returned when adding a user to an organization they already belong to
+var ErrAlreadyMember = errors.New("user is already a member of the organization")
+
+// ErrOwnershipChanged is returned when the owner or the new owner changed during a transfer
+var ErrOwnershipChanged = errors.New("organization ownership changed during the transfer")
+
+// MerchantProfileFields are the fields of a user's merchant profile, which their organization holds
+var MerchantProfileFields = []string{"merchant_name", "website", "address"}
+
+// UserOrganization is an organization together with the user's role in it
+type UserOrganization struct {
+	models.Organization `bson:",inline"`
+	Role                models.OrgRole `json:"role" bson:"role"`
+}
+
+// EnsureOrganizationIndexes creates the lookup indexes of organizations, their members and invitations
+func EnsureOrganizationIndexes(ctx context.Context) error {
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+	_, err := members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	invitations := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+	_, err = invitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+	})
+	return err
+}
+
+// CreateOrganization stores a new organization owned by ownerID
+func CreateOrganization(ctx context.Context, org *models.Organization, ownerID primitive.ObjectID) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+
+	org.ID = primitive.NewObjectID()
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	if _, err := collection.InsertOne(ctx, org); err != nil {
+		return err
+	}
+	return AddOrganizationMember(ctx, org.ID, ownerID, models.OrgOwner)
+}
+
+// CreateMerchantOrganization creates the organization of a new merchant from their profile
+func CreateMerchantOrganization(ctx context.Context, user models.User) error {
+	return CreateOrganization(ctx, &models.Organization{
+		MerchantName: user.MerchantName,
+		Website:      user.Website,
+		Address:      user.Address,
+	}, user.ID)
+}
+
+// BackfillMerchantOrganizations creates an organization for every merchant who does not belong to one,
+// such as merchants who signed up before organizations existed, from the profile stored on their account.
+// The profile copies are then removed from all accounts. It returns how many organizations were created.
+func BackfillMerchantOrganizations(ctx context.Context) (int, error) {
+	users := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	// Deleted merchants are included so that restoring them brings their profile back
+	cursor, err := users.Find(ctx, bson.M{"role": models.Merchant, "anonymized_at": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// Accounts created before organizations existed still hold the profile themselves
+	type legacyProfile struct {
+		MerchantName string `bson:"merchant_name"`
+		Website      string `bson:"website"`
+		Address      string `bson:"address"`
+	}
+
+	created := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return created, err
+		}
+		var profile legacyProfile
+		if err := cursor.Decode(&profile); err != nil {
+			return created, err
+		}
+		user.MerchantName, user.Website, user.Address = profile.MerchantName, profile.Website, profile.Address
+
+		// Deletion removes memberships, so only deleted merchants who still hold a profile of their own lack one
+		if user.DeletedAt != nil && profile == (legacyProfile{}) {
+			continue
+		}
+
+		count, err := members.CountDocuments(ctx, bson.M{"user_id": user.ID}, options.Count().SetLimit(1))
+		if err != nil {
+			return created, err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := CreateMerchantOrganization(ctx, user); err != nil {
+			return created, err
+		}
+		created++
+	}
+	if err := cursor.Err(); err != nil {
+		return created, err
+	}
+
+	unset := bson.M{}
+	for _, field := range MerchantProfileFields {
+		unset[field] = ""
+	}
+	_, err = users.UpdateMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"merchant_name": bson.M{"$exists": true}},
+		bson.M{"website": bson.M{"$exists": true}},
+		bson.M{"address": bson.M{"$exists": true}},
+	}}, bson.M{"$unset": unset})
+	return created, err
+}
+
+// FindOrganization returns an organization by ID
+func FindOrganization(ctx context.Context, id primitive.ObjectID) (*models.Organization, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+
+	var org models.Organization
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&org); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// OrganizationsForUser returns the organizations a user belongs to and their role in each
+func OrganizationsForUser(ctx context.Context, userID primitive.ObjectID) ([]UserOrganization, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$sort", Value: bson.M{"joined_at": 1}}},
+		{{Key: "$lookup", Value: bson.M{"from": "organizations", "localField": "organization_id", "foreignField": "_id", "as": "organization"}}},
+		{{Key: "$unwind", Value: "$organization"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{"$mergeObjects": bson.A{"$organization", bson.M{"role": "$role"}}}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	organizations := []UserOrganization{}
+	if err := cursor.All(ctx, &organizations); err != nil {
+		return nil, err
+	}
+	return organizations, nil
+}
+
+// UpdateOrganization sets profile fields of an organization
+func UpdateOrganization(ctx context.Context, id primitive.ObjectID, fields bson.M) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+
+	fields["updated_at"] = time.Now()
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	return err
+}
+
+// LoadMerchantProfile fills in a user's merchant profile from their organization
+func LoadMerchantProfile(ctx context.Context, user *models.User) error {
+	users := []models.User{*user}
+	if err := LoadMerchantProfiles(ctx, users); err != nil {
+		return err
+	}
+	*user = users[0]
+	return nil
+}
+
+// LoadMerchantProfiles fills in the merchant profiles of users from their organizations: the one each owns,
+// or else the first they joined. Users who belong to no organization, such as administrators, have none.
+func LoadMerchantProfiles(ctx context.Context, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+	organizations := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+
+	userIDs := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	cursor, err := members.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}}, options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var memberships []models.OrganizationMember
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return err
+	}
+
+	orgIDs := make(map[primitive.ObjectID]primitive.ObjectID, len(users))
+	for _, membership := range memberships {
+		if _, ok := orgIDs[membership.UserID]; !ok || membership.Role == models.OrgOwner {
+			orgIDs[membership.UserID] = membership.OrganizationID
+		}
+	}
+	if len(orgIDs) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(orgIDs))
+	for _, id := range orgIDs {
+		ids = append(ids, id)
+	}
+	cursor, err = organizations.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var orgs []models.Organization
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return err
+	}
+	orgsByID := make(map[primitive.ObjectID]models.Organization, len(orgs))
+	for _, org := range orgs {
+		orgsByID[org.ID] = org
+	}
+
+	for i := range users {
+		org := orgsByID[orgIDs[users[i].ID]]
+		users[i].MerchantName, users[i].Website, users[i].Address = org.MerchantName, org.Website, org.Address
+	}
+	return nil
+}
+
+// OrganizationMemberIDs returns the IDs of the users who belong to an organization matching filter
+func OrganizationMemberIDs(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	organizations := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	orgIDs, err := organizations.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []primitive.ObjectID{}
+	if len(orgIDs) == 0 {
+		return userIDs, nil
+	}
+	ids, err := members.Distinct(ctx, "user_id", bson.M{"organization_id": bson.M{"$in": orgIDs}})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if userID, ok := id.(primitive.ObjectID); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// OwnedOrganization returns the organization a user owns, or the first one if they own several
+func OwnedOrganization(ctx context.Context, userID primitive.ObjectID) (*models.Organization, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	var owner models.OrganizationMember
+	err := collection.FindOne(ctx, bson.M{"user_id": userID, "role": models.OrgOwner}, options.FindOne().SetSort(bson.D{{Key: "joined_at", Value: 1}})).Decode(&owner)
+	if err != nil {
+		return nil, err
+	}
+	return FindOrganization(ctx, owner.OrganizationID)
+}
+
+// FindOrganizationMember returns a user's membership of an organization
+func FindOrganizationMember(ctx context.Context, orgID, userID primitive.ObjectID) (*models.OrganizationMember, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	var member models.OrganizationMember
+	if err := collection.FindOne(ctx, bson.M{"organization_id": orgID, "user_id": userID}).Decode(&member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// OrganizationMembershipsForUser returns a user's memberships of organizations
+func OrganizationMembershipsForUser(ctx context.Context, userID primitive.ObjectID) ([]models.OrganizationMember, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	memberships := []models.OrganizationMember{}
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// OrganizationMembers returns an organization's members, owner first, then in the order they joined
+func OrganizationMembers(ctx context.Context, orgID primitive.ObjectID) ([]models.OrganizationMember, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	cursor, err := collection.Find(ctx, bson.M{"organization_id": orgID}, options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	members := []models.OrganizationMember{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	// Move the owner to the front
+	for i, member := range members {
+		if member.Role == models.OrgOwner && i > 0 {
+			copy(members[1:i+1], members[:i])
+			members[0] = member
+			break
+		}
+	}
+	return members, nil
+}
+
+// AddOrganizationMember gives a user a role in an organization
+func AddOrganizationMember(ctx context.Context, orgID, userID primitive.ObjectID, role models.OrgRole) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	_, err := collection.InsertOne(ctx, models.OrganizationMember{
+		ID:             primitive.NewObjectID(),
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           role,
+		JoinedAt:       time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyMember
+	}
+	return err
+}
+
+// SetOrganizationMemberRole changes a member's role, reporting false when they are not a member
+func SetOrganizationMemberRole(ctx context.Context, orgID, userID primitive.ObjectID, role models.OrgRole) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	result, err := collection.UpdateOne(ctx, bson.M{"organization_id": orgID, "user_id": userID}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// TransferOrganizationOwnership makes a member the owner, and the previous owner an admin. Both changes are
+// made in one transaction, so the organization never has no owner or two; ErrOwnershipChanged is returned
+// when fromUserID is no longer the owner or toUserID no longer a member.
+func TransferOrganizationOwnership(ctx context.Context, orgID, fromUserID, toUserID primitive.ObjectID) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	session, err := database.GetMongoClient().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		demoted, err := collection.UpdateOne(sc,
+			bson.M{"organization_id": orgID, "user_id": fromUserID, "role": models.OrgOwner},
+			bson.M{"$set": bson.M{"role": models.OrgAdmin}})
+		if err != nil {
+			return nil, err
+		}
+		promoted, err := collection.UpdateOne(sc,
+			bson.M{"organization_id": orgID, "user_id": toUserID, "role": bson.M{"$ne": models.OrgOwner}},
+			bson.M{"$set": bson.M{"role": models.OrgOwner}})
+		if err != nil {
+			return nil, err
+		}
+		if demoted.MatchedCount == 0 || promoted.MatchedCount == 0 {
+			return nil, ErrOwnershipChanged
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// RemoveOrganizationMembers removes the memberships matching filter and returns how many were removed
+func RemoveOrganizationMembers(ctx context.Context, filter bson.M) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// DeleteEmptyOrganizations deletes those of the given organizations that have no members left, together with
+// their invitations, and returns how many were deleted
+func DeleteEmptyOrganizations(ctx context.Context, orgIDs []primitive.ObjectID) (int, error) {
+	organizations := database.GetMongoClient().Database("talentdevgo").Collection("organizations")
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+	invitations := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+
+	deleted := 0
+	for _, orgID := range orgIDs {
+		count, err := members.CountDocuments(ctx, bson.M{"organization_id": orgID}, options.Count().SetLimit(1))
+		if err != nil {
+			return deleted, err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := invitations.DeleteMany(ctx, bson.M{"organization_id": orgID}); err != nil {
+			return deleted, err
+		}
+		result, err := organizations.DeleteOne(ctx, bson.M{"_id": orgID})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(result.DeletedCount)
+	}
+	return deleted, nil
+}
+
+// OwnsSharedOrganization reports whether a user owns an organization that has other members
+func OwnsSharedOrganization(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID, "role": models.OrgOwner})
+	if err != nil {
+		return false, err
+	}
+	var owned []models.OrganizationMember
+	if err := cursor.All(ctx, &owned); err != nil {
+		return false, err
+	}
+	for _, membership := range owned {
+		others, err := collection.CountDocuments(ctx, bson.M{"organization_id": membership.OrganizationID, "user_id": bson.M{"$ne": userID}}, options.Count().SetLimit(1))
+		if err != nil || others > 0 {
+			return others > 0, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"github.com/crewjam/saml"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// samlRequestTTL is how long a user has to sign in at the identity provider
+const samlRequestTTL = 10 * time.Minute
+
+// ErrSAMLRequestInvalid is returned when a response does not answer a request we sent
+var ErrSAMLRequestInvalid = errors.New("unknown or expired SAML request")
+
+// EnsureSAMLIndexes creates the lookup indexes and expires unanswered requests
+func EnsureSAMLIndexes(ctx context.Context) error {
+	db := database.GetMongoClient().Database("talentdevgo")
+
+	indexes := map[string][]mongo.IndexModel{
+		"saml_connections": {
+			{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "domains", Value: 1}}},
+		},
+		"saml_requests": {
+			{Keys: bson.D{{Key: "relay_state_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for name, indexModels := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindSAMLConnection returns the connection with the given slug
+func FindSAMLConnection(ctx context.Context, slug string) (*models.SAMLConnection, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+
+	var connection models.SAMLConnection
+	if err := collection.FindOne(ctx, bson.M{"slug": slug}).Decode(&connection); err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+// FindSAMLConnectionByDomain returns the connection whose identity provider vouches for an email domain
+func FindSAMLConnectionByDomain(ctx context.Context, domain string) (*models.SAMLConnection, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_connections")
+
+	var connection models.SAMLConnection
+	if err := collection.FindOne(ctx, bson.M{"domains": domain}).Decode(&connection); err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+// StartSAMLLogin records a new authentication request and returns the identity provider URL to send the browser to
+func StartSAMLLogin(ctx context.Context, sp *saml.ServiceProvider, connection string) (string, error) {
+	request, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+
+	relayState := NewOAuthSecret("")
+	redirectURL, err := request.Redirect(relayState, sp)
+	if err != nil {
+		return "", err
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_requests")
+	_, err = collection.InsertOne(ctx, models.SAMLRequest{
+		ID:             primitive.NewObjectID(),
+		RelayStateHash: HashOAuthSecret(relayState),
+		RequestID:      request.ID,
+		Connection:     connection,
+		ExpiresAt:      time.Now().Add(samlRequestTTL),
+		CreatedAt:      time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return redirectURL.String(), nil
+}
+
+// ConsumeSAMLRequest returns and deletes the request matching a relay state, so each response is accepted once
+func ConsumeSAMLRequest(ctx context.Context, connection, relayState string) (*models.SAMLRequest, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("saml_requests")
+
+	var request models.SAMLRequest
+	err := collection.FindOneAndDelete(ctx, bson.M{"relay_state_hash": HashOAuthSecret(relayState), "connection": connection}).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSAMLRequestInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(request.ExpiresAt) {
+		return nil, ErrSAMLRequestInvalid
+	}
+	return &request, nil
+}
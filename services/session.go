@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionLifetime is how long a session token is valid for
+const SessionLifetime = 72 * time.Hour
+
+const sessionRetention = 30 * 24 * time.Hour // How long ended sessions are kept, so returning devices are still recognised
+const sessionTouchInterval = 5 * time.Minute // How often a session's last-seen time is updated
+
+// ErrSessionEnded is returned for sessions that were revoked or have expired
+var ErrSessionEnded = errors.New("session has ended")
+
+// EnsureSessionIndexes creates the lookup indexes and removes sessions some time after they expire
+func EnsureSessionIndexes(ctx context.Context) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "device_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(sessionRetention.Seconds()))},
+	})
+	return err
+}
+
+// StartSession stores a new session for a user, lasting SessionLifetime unless it already has an expiry.
+// It reports whether the session is on a device the user has not signed in on before; a user's first
+// session is not counted as a new device.
+func StartSession(ctx context.Context, session *models.Session) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	previous, err := collection.CountDocuments(ctx, bson.M{"user_id": session.UserID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	known, err := collection.CountDocuments(ctx, bson.M{"user_id": session.UserID, "device_hash": session.DeviceHash}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = now.Add(SessionLifetime)
+	}
+
+	if _, err := collection.InsertOne(ctx, session); err != nil {
+		return false, err
+	}
+	return previous > 0 && known == 0, nil
+}
+
+// CheckSession returns ErrSessionEnded unless the session is still active, and records that it was seen
+func CheckSession(ctx context.Context, id primitive.ObjectID) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	var session models.Session
+	err := collection.FindOne(ctx, bson.M{
+		"_id":        id,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrSessionEnded
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only write when the last-seen time is out of date, rather than on every request
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_seen_at": time.Now()}})
+	}
+	return err
+}
+
+// SessionCSRFToken returns the CSRF token of a session kept in a cookie. It is derived from the
+// session ID, so it needs no storage and changes with every sign-in.
+func SessionCSRFToken(secret string, sessionID primitive.ObjectID) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf:" + sessionID.Hex()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SessionsForUser returns a user's sessions, most recently used first. Unless includeEnded is set,
+// only active sessions are returned.
+func SessionsForUser(ctx context.Context, userID primitive.ObjectID, includeEnded bool) ([]models.Session, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	filter := bson.M{"user_id": userID}
+	if !includeEnded {
+		filter["revoked_at"] = bson.M{"$exists": false}
+		filter["expires_at"] = bson.M{"$gt": time.Now()}
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSessions ends the active sessions matching filter and returns how many were ended
+func RevokeSessions(ctx context.Context, filter bson.M) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	filter["revoked_at"] = bson.M{"$exists": false}
+	filter["expires_at"] = bson.M{"$gt": time.Now()}
+
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeleteSessions removes the sessions matching filter, along with the devices and addresses they record
+func DeleteSessions(ctx context.Context, filter bson.M) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sessions")
+
+	_, err := collection.DeleteMany(ctx, filter)
+	return err
+}
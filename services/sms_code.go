@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Limits on codes sent by SMS, which cost money and can be guessed
+const (
+	SMSCodeCooldown      = time.Minute // Minimum time between two codes to the same user
+	maxSMSCodesPerHour   = 5           // Codes sent to one user per hour
+	maxSMSCodeAttempts   = 5           // Wrong guesses before a code stops working
+	smsCodeDigits        = 6
+	smsCodeLimitInterval = time.Hour
+)
+
+// Errors returned when sending or checking a code
+var (
+	ErrSMSCodeCooldown = errors.New("a code was sent moments ago")
+	ErrSMSCodeLimit    = errors.New("too many codes sent")
+	ErrSMSCodeInvalid  = errors.New("invalid or expired code")
+)
+
+// EnsureSMSCodeIndexes creates the lookup indexes and expires unused codes
+func EnsureSMSCodeIndexes(ctx context.Context) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sms_codes")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// IssueSMSCode stores a new code for smsCode's user and purpose, replacing any earlier one, and returns the code.
+// Sign-in codes also get a token that identifies the sign-in waiting for them.
+func IssueSMSCode(ctx context.Context, ttl time.Duration, smsCode models.SMSCode) (string, string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sms_codes")
+
+	// Rate limiting across all purposes, as every code is a paid message
+	var latest models.SMSCode
+	err := collection.FindOne(ctx, bson.M{"user_id": smsCode.UserID}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&latest)
+	if err == nil && time.Since(latest.CreatedAt) < SMSCodeCooldown {
+		return "", "", ErrSMSCodeCooldown
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", "", err
+	}
+	sent, err := collection.CountDocuments(ctx, bson.M{"user_id": smsCode.UserID, "created_at": bson.M{"$gt": time.Now().Add(-smsCodeLimitInterval)}})
+	if err != nil {
+		return "", "", err
+	}
+	if sent >= maxSMSCodesPerHour {
+		return "", "", ErrSMSCodeLimit
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", "", err
+	}
+	code := fmt.Sprintf("%0*d", smsCodeDigits, n.Int64())
+
+	smsCode.ID = primitive.NewObjectID()
+	smsCode.CodeHash = smsCodeHash(smsCode.ID, code)
+	smsCode.ExpiresAt = time.Now().Add(ttl)
+	smsCode.CreatedAt = time.Now()
+	var token string
+	if smsCode.Purpose == models.SMSSignIn {
+		token = NewOAuthSecret("")
+		smsCode.TokenHash = HashOAuthSecret(token)
+	}
+
+	// Only the newest code works, but earlier ones are kept until they expire so they count towards the limits
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"user_id": smsCode.UserID, "purpose": smsCode.Purpose, "attempts": bson.M{"$lt": maxSMSCodeAttempts}},
+		bson.M{"$set": bson.M{"attempts": maxSMSCodeAttempts}},
+	)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := collection.InsertOne(ctx, smsCode); err != nil {
+		return "", "", err
+	}
+	return code, token, nil
+}
+
+// CheckSMSCode checks code against the newest unexpired code matching filter. A matching code is spent;
+// a wrong guess counts against it.
+func CheckSMSCode(ctx context.Context, filter bson.M, code string) (*models.SMSCode, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("sms_codes")
+
+	filter["expires_at"] = bson.M{"$gt": time.Now()}
+	filter["attempts"] = bson.M{"$lt": maxSMSCodeAttempts}
+
+	var smsCode models.SMSCode
+	err := collection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&smsCode)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSMSCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(smsCodeHash(smsCode.ID, code)), []byte(smsCode.CodeHash)) != 1 {
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": smsCode.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrSMSCodeInvalid
+	}
+
+	// Spend the code; a concurrent check may have done so first
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": smsCode.ID, "attempts": bson.M{"$lt": maxSMSCodeAttempts}},
+		bson.M{"$set": bson.M{"attempts": maxSMSCodeAttempts}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount != 1 {
+		return nil, ErrSMSCodeInvalid
+	}
+	return &smsCode, nil
+}
+
+// smsCodeHash is the stored form of a code, salted with its ID
+func smsCodeHash(id primitive.ObjectID, code string) string {
+	return HashOAuthSecret(id.Hex() + ":" + code)
+}
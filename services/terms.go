@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureTermsIndexes keeps each terms version registered once
+func EnsureTermsIndexes(ctx context.Context) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("terms_versions")
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// CurrentTermsVersion returns the most recently published terms version, or nil if none is registered
+func CurrentTermsVersion(ctx context.Context) (*models.TermsVersion, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("terms_versions")
+
+	opts := options.FindOne().SetSort(bson.M{"published_at": -1})
+	filter := bson.M{"published_at": bson.M{"$lte": time.Now()}}
+
+	var version models.TermsVersion
+	if err := collection.FindOne(ctx, filter, opts).Decode(&version); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// TermsAcceptanceRequired reports whether a user still has to accept the current terms version
+func TermsAcceptanceRequired(user models.User, current *models.TermsVersion) bool {
+	return current != nil && current.Required && user.TermsVersion != current.Version
+}
+
+// AcceptTerms records a user accepting a terms version and updates their current acceptance.
+// An empty version records consent when no terms versions have been registered yet.
+func AcceptTerms(ctx context.Context, acceptance models.TermsAcceptance) error {
+	users := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	acceptance.ID = primitive.NewObjectID()
+	acceptance.AcceptedAt = time.Now()
+
+	update := bson.M{
+		"terms_and_conditions": true,
+		"terms_accepted_at":    acceptance.AcceptedAt,
+		"updated_at":           acceptance.AcceptedAt,
+	}
+	if acceptance.Version != "" {
+		acceptances := database.GetMongoClient().Database("talentdevgo").Collection("terms_acceptances")
+		if _, err := acceptances.InsertOne(ctx, acceptance); err != nil {
+			return err
+		}
+		update["terms_version"] = acceptance.Version
+	}
+
+	if _, err := users.UpdateOne(ctx, bson.M{"_id": acceptance.UserID}, bson.M{"$set": update}); err != nil {
+		return err
+	}
+
+	// Keep the consent history in step with the acceptance records
+	return RecordConsent(ctx, models.ConsentRecord{
+		UserID:    acceptance.UserID,
+		Type:      models.TermsAndConditionsConsent,
+		Granted:   true,
+		Version:   acceptance.Version,
+		Source:    acceptance.Source,
+		IP:        acceptance.IP,
+		UserAgent: acceptance.UserAgent,
+		CreatedAt: acceptance.AcceptedAt,
+	})
+}
+
+// TermsAcceptanceHistory returns every terms version a user has accepted, oldest first
+func TermsAcceptanceHistory(ctx context.Context, userID primitive.ObjectID) ([]models.TermsAcceptance, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("terms_acceptances")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"accepted_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	acceptances := []models.TermsAcceptance{}
+	if err := cursor.All(ctx, &acceptances); err != nil {
+		return nil, err
+	}
+	return acceptances, nil
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"myfibergotemplate/config"
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrOwnsSharedOrganization is returned when deleting a user who owns an organization with other members
+var ErrOwnsSharedOrganization = errors.New("user owns an organization with other members")
+
+// SoftDeleteUser marks a user as deleted by deletedBy, signs them out everywhere, stops their API keys and
+// application tokens and removes them from organizations, recording the memberships for RestoreUser. It
+// reports false when there is no such undeleted user. An organization with other members needs a new owner
+// before its owner can be deleted.
+func SoftDeleteUser(ctx context.Context, userID primitive.ObjectID, deletedBy string) (bool, error) {
+	shared, err := OwnsSharedOrganization(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if shared {
+		return false, ErrOwnsSharedOrganization
+	}
+
+	memberships, err := OrganizationMembershipsForUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	fields := bson.M{"deleted_at": time.Now(), "deleted_by": deletedBy, "updated_at": time.Now()}
+	if len(memberships) > 0 {
+		fields["deleted_memberships"] = memberships
+	}
+	update := bson.M{"$set": fields}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userID, "deleted_at": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+
+	if _, err := RevokeSessions(ctx, bson.M{"user_id": userID}); err != nil {
+		return true, err
+	}
+	if _, err := RevokeAPIKeys(ctx, bson.M{"user_id": userID}); err != nil {
+		return true, err
+	}
+	if err := RevokeOAuthTokens(ctx, bson.M{"user_id": userID}); err != nil {
+		return true, err
+	}
+	if _, err := RemoveOrganizationMembers(ctx, bson.M{"user_id": userID}); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// RestoreUser undoes the soft deletion of a user and gives them back the organization memberships removed
+// with it, returning how many were given back. Memberships of organizations that no longer exist are dropped,
+// and an owner whose organization has since got a new owner returns as an admin.
+func RestoreUser(ctx context.Context, user models.User) (int, error) {
+	members := database.GetMongoClient().Database("talentdevgo").Collection("organization_members")
+
+	// Memberships go first, so a restore that fails part way can be retried
+	restored := 0
+	for _, membership := range user.DeletedMemberships {
+		if _, err := FindOrganization(ctx, membership.OrganizationID); errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		} else if err != nil {
+			return restored, err
+		}
+		if membership.Role == models.OrgOwner {
+			owners, err := members.CountDocuments(ctx, bson.M{"organization_id": membership.OrganizationID, "role": models.OrgOwner}, options.Count().SetLimit(1))
+			if err != nil {
+				return restored, err
+			}
+			if owners > 0 {
+				membership.Role = models.OrgAdmin
+			}
+		}
+		if _, err := members.InsertOne(ctx, membership); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return restored, err
+		}
+		restored++
+	}
+
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"deleted_at": "", "deleted_by": "", "deleted_memberships": ""},
+	}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	return restored, err
+}
+
+// AnonymizeUser scrubs a user's personal data while keeping the document and related records
+// so references to it stay valid. Anonymized users are also marked as deleted. Organizations left
+// without members are deleted, as their merchant profile was the user's.
+func AnonymizeUser(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID) error {
+	now := time.Now()
+
+	// An organization with other members needs a new owner first, as with deletion
+	shared, err := OwnsSharedOrganization(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return ErrOwnsSharedOrganization
+	}
+	orgIDs, err := formerOrganizationIDs(ctx, collection, userID)
+	if err != nil {
+		return err
+	}
+
+	// Block sign-in for users that were not deleted before being anonymized
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": userID, "deleted_at": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"deleted_at": now}})
+	if err != nil {
+		return err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"email":            "deleted+" + userID.Hex() + "@anonymized.invalid",
+			"email_status":     false,
+			"status":           models.Suspended,
+			"person_in_charge": "",
+			"phone_number":     "",
+			"phone_verified":   false,
+			"password":         "",
+			"anonymized_at":    now,
+			"updated_at":       now,
+		},
+		"$unset": bson.M{
+			"verification_token":  "",
+			"phone_verified_at":   "",
+			"passkey_required":    "",
+			"sms_code_required":   "",
+			"deleted_memberships": "",
+		},
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		return err
+	}
+
+	// Provider account links, passkeys, sessions and memberships identify the person, so they are removed
+	if err := UnlinkFederatedIdentities(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := DeleteWebAuthnCredentials(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if err := DeleteSessions(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := RemoveOrganizationMembers(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := DeleteEmptyOrganizations(ctx, orgIDs); err != nil {
+		return err
+	}
+	if err := removeUserFromRecords(ctx, userID); err != nil {
+		return err
+	}
+
+	// Keep the consent and terms history but drop the network identifiers it contains
+	for _, name := range []string{"consents", "terms_acceptances"} {
+		related := database.GetMongoClient().Database("talentdevgo").Collection(name)
+		_, err = related.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$unset": bson.M{"ip": "", "user_agent": ""}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeUser permanently removes a user together with every record that refers to them, including the
+// organizations left without members. The user document goes last, so a purge that fails part way is
+// retried on the next run.
+func PurgeUser(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID) error {
+	orgIDs, err := formerOrganizationIDs(ctx, collection, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := UnlinkFederatedIdentities(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := DeleteWebAuthnCredentials(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if err := DeleteSessions(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := RemoveOrganizationMembers(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := DeleteEmptyOrganizations(ctx, orgIDs); err != nil {
+		return err
+	}
+	if err := removeUserFromRecords(ctx, userID); err != nil {
+		return err
+	}
+
+	related := []string{
+		"api_keys", "consents", "terms_acceptances", "oauth_tokens", "oauth_codes", "oauth_consents",
+		"sms_codes", "magic_links", "webauthn_sessions", "federated_login_codes",
+	}
+	for _, name := range related {
+		_, err := database.GetMongoClient().Database("talentdevgo").Collection(name).DeleteMany(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = collection.DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// formerOrganizationIDs returns the organizations a user belongs to, or belonged to before they were deleted
+func formerOrganizationIDs(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var user models.User
+	err := collection.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"deleted_memberships": 1})).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	memberships, err := OrganizationMembershipsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgIDs := []primitive.ObjectID{}
+	for _, membership := range append(memberships, user.DeletedMemberships...) {
+		orgIDs = append(orgIDs, membership.OrganizationID)
+	}
+	return orgIDs, nil
+}
+
+// removeUserFromRecords deletes the invitations that created or were accepted by a user, and drops their
+// email from the results of bulk jobs
+func removeUserFromRecords(ctx context.Context, userID primitive.ObjectID) error {
+	invitations := database.GetMongoClient().Database("talentdevgo").Collection("invitations")
+	_, err := invitations.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"user_id": userID}, bson.M{"accepted_by": userID}}})
+	if err != nil {
+		return err
+	}
+
+	items := database.GetMongoClient().Database("talentdevgo").Collection("bulk_job_items")
+	_, err = items.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$unset": bson.M{"email": ""}})
+	return err
+}
+
+// PurgeExpiredUsers permanently removes or anonymizes users whose retention period has ended
+func PurgeExpiredUsers(ctx context.Context, cfg config.RetentionConfig) (int, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("users")
+
+	cutoff := time.Now().Add(-cfg.UserRetentionPeriod())
+	filter := bson.M{"deleted_at": bson.M{"$lt": cutoff}}
+
+	// Either delete the documents outright or scrub them in place
+	deleting := cfg.PurgeMode != "anonymize"
+	if !deleting {
+		filter["anonymized_at"] = bson.M{"$exists": false}
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	purged := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return purged, err
+		}
+		if deleting {
+			err = PurgeUser(ctx, collection, user.ID)
+		} else {
+			err = AnonymizeUser(ctx, collection, user.ID)
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, cursor.Err()
+}
+
+// StartUserPurger periodically purges users whose retention period has ended, until ctx is cancelled
+func StartUserPurger(ctx context.Context, interval time.Duration, cfg config.RetentionConfig) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			purged, err := PurgeExpiredUsers(purgeCtx, cfg)
+			cancel()
+
+			if err != nil {
+				slog.Error("Failed to purge deleted users", "error", err)
+			} else if purged > 0 {
+				slog.Info("Purged deleted users", "count", purged)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"myfibergotemplate/database"
+	"myfibergotemplate/models"
+	"myfibergotemplate/passkey"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCredentialRegistered is returned when an authenticator is already registered
+var ErrCredentialRegistered = errors.New("credential is already registered")
+
+// EnsureWebAuthnIndexes creates the credential lookup indexes and expires abandoned ceremonies
+func EnsureWebAuthnIndexes(ctx context.Context) error {
+	db := database.GetMongoClient().Database("talentdevgo")
+
+	indexes := map[string][]mongo.IndexModel{
+		"webauthn_credentials": {
+			{Keys: bson.D{{Key: "credential_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		},
+		"webauthn_sessions": {
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for name, indexModels := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebAuthnCredentialsForUser returns a user's registered credentials, oldest first
+func WebAuthnCredentialsForUser(ctx context.Context, userID primitive.ObjectID) ([]models.WebAuthnCredential, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_credentials")
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	credentials := []models.WebAuthnCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// AddWebAuthnCredential stores a newly registered credential
+func AddWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_credentials")
+
+	_, err := collection.InsertOne(ctx, credential)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCredentialRegistered
+	}
+	return err
+}
+
+// RecordWebAuthnCredentialUse stores a credential's new signature count and when it was used
+func RecordWebAuthnCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_credentials")
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": credential.ID}, bson.M{"$set": bson.M{
+		"sign_count":   credential.SignCount,
+		"backup_state": credential.BackupState,
+		"last_used_at": time.Now(),
+	}})
+	return err
+}
+
+// RenameWebAuthnCredential renames one of a user's credentials, reporting false when it does not exist
+func RenameWebAuthnCredential(ctx context.Context, userID, id primitive.ObjectID, name string) (bool, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_credentials")
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, bson.M{"$set": bson.M{"name": name}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// DeleteWebAuthnCredentials removes the credentials matching filter
+func DeleteWebAuthnCredentials(ctx context.Context, filter bson.M) (int64, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_credentials")
+
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// StartWebAuthnSession stores a ceremony's session data and returns the token that identifies it
+func StartWebAuthnSession(ctx context.Context, session models.WebAuthnSession) (string, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_sessions")
+
+	token := NewOAuthSecret("")
+	session.ID = primitive.NewObjectID()
+	session.TokenHash = HashOAuthSecret(token)
+	session.ExpiresAt = time.Now().Add(passkey.Timeout)
+
+	if _, err := collection.InsertOne(ctx, session); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeWebAuthnSession removes and returns the unexpired session of one of the given ceremonies,
+// so each challenge is answered once
+func ConsumeWebAuthnSession(ctx context.Context, token string, purposes ...string) (*models.WebAuthnSession, error) {
+	collection := database.GetMongoClient().Database("talentdevgo").Collection("webauthn_sessions")
+
+	var session models.WebAuthnSession
+	err := collection.FindOneAndDelete(ctx, bson.M{
+		"token_hash": HashOAuthSecret(token),
+		"purpose":    bson.M{"$in": purposes},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
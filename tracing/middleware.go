@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for every request, continuing any W3C trace context sent by the client.
+// The span's context is stored as the request's user context so handlers can create child spans.
+func Middleware(c *fiber.Ctx) error {
+	// Extract the incoming traceparent and tracestate headers
+	carrier := propagation.MapCarrier{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		carrier.Set(string(key), string(value))
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+	ctx, span := Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(c.IP()),
+			semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+	err := c.Next()
+
+	// Name the span after the matched route now that routing has happened
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = http.StatusInternalServerError
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if requestID, ok := c.Locals("requestID").(string); ok {
+		span.SetAttributes(attribute.String("request.id", requestID))
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, strconv.Itoa(status))
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return err
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+
+	"myfibergotemplate/tracing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword hashes a password with bcrypt, tracing the time spent hashing
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// CheckPassword compares a password with a bcrypt hash, tracing the time spent comparing
+func CheckPassword(ctx context.Context, hashedPassword, password string) error {
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPhoneNumber is returned for phone numbers that cannot be written in E.164 form
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// NormalizePhoneNumber returns a phone number in E.164 form, such as +60123456789. Spaces, dashes, dots and
+// brackets are ignored, and a leading 00 is read as +. Numbers without a country code are completed with
+// defaultCountryCode, dropping the national trunk prefix 0; without one they are rejected.
+func NormalizePhoneNumber(number, defaultCountryCode string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(number))
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case defaultCountryCode == "":
+		return "", ErrInvalidPhoneNumber
+	case strings.HasPrefix(digits, "0"):
+		digits = defaultCountryCode + digits[1:]
+	case !strings.HasPrefix(digits, defaultCountryCode):
+		digits = defaultCountryCode + digits
+	}
+
+	// E.164 numbers have at most 15 digits and country codes never start with 0
+	if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+	return "+" + digits, nil
+}
+
+// MaskPhoneNumber hides all but the country code and last three digits of an E.164 phone number
+func MaskPhoneNumber(number string) string {
+	if len(number) < 7 {
+		return strings.Repeat("*", len(number))
+	}
+	return number[:3] + strings.Repeat("*", len(number)-6) + number[len(number)-3:]
+}
@@ -0,0 +1,62 @@
+package utils
+
+import "strings"
+
+// Browsers and operating systems recognised in user agents, most specific first, since most
+// browsers also name the engines they are compatible with
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"FxiOS/", "Firefox"},
+		{"Firefox/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Macintosh", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeUserAgent names the browser and operating system of a user agent, e.g. "Chrome on Windows".
+// Other clients are named by their product, e.g. "curl".
+func DescribeUserAgent(userAgent string) string {
+	var browser, system string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	// Not a browser: use the product name that starts the user agent
+	product, _, _ := strings.Cut(userAgent, "/")
+	product = strings.TrimSpace(product)
+	if product == "" || product == "Mozilla" || len(product) > 64 {
+		return "Unknown device"
+	}
+	return product
+}
@@ -2,8 +2,9 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
-	"log"
+	"net/mail"
 )
 
 // GenerateVerificationToken generates a random token for email verification
@@ -11,7 +12,19 @@ func GenerateVerificationToken() string {
 	bytes := make([]byte, 16) // Create a slice to hold 16 random bytes
 	// Fill the slice with random bytes
 	if _, err := rand.Read(bytes); err != nil {
-		log.Fatal(err) // If there's an error generating random bytes, log a fatal error
+		panic(err) // The system's random source is unusable; there is no safe way to continue
 	}
 	return hex.EncodeToString(bytes) // Convert the bytes to a hexadecimal string and return it
 }
+
+// HashVerificationToken returns the form of a token that is stored, so a database leak does not expose usable links
+func HashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsValidEmail reports whether the given string is a plain email address
+func IsValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}